@@ -2,18 +2,42 @@ package api
 
 import (
 	"database/sql"
+	"errors"
 	"github.com/lib/pq"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
+	"github.com/leilei3167/bank/apiutil"
 	db "github.com/leilei3167/bank/db/sqlc"
+	"github.com/leilei3167/bank/db/util"
+	"github.com/leilei3167/bank/token"
 )
 
+//返回给客户端的账户,余额同时以最小单位的整数和格式化后的十进制字符串表示
+type accountResponse struct {
+	db.Account
+	BalanceDecimal string `json:"balance_decimal"`
+}
+
+func newAccountResponse(account db.Account) accountResponse {
+	return accountResponse{
+		Account:        account,
+		BalanceDecimal: util.Currencies.FormatAmount(account.Balance, account.Currency),
+	}
+}
+
+func newAccountsResponse(accounts []db.Account) []accountResponse {
+	resp := make([]accountResponse, 0, len(accounts))
+	for _, account := range accounts {
+		resp = append(resp, newAccountResponse(account))
+	}
+	return resp
+}
+
 //构建所需的数据,在此可用binding来验证输入的字段
 type createAccountRequest struct {
-	Owner    string `json:"owner" binding:"required"`
 	Currency string `json:"currency" binding:"required,currency" ` //必须字段
-} //只允许传入owner 和 币种,余额创建时默认为0
+} //只允许传入币种,owner为当前登录的用户,余额创建时默认为0
 
 func (server *Server) createAccount(ctx *gin.Context) {
 	var req createAccountRequest
@@ -22,8 +46,10 @@ func (server *Server) createAccount(ctx *gin.Context) {
 		return
 	}
 	//没有错误的话执行创建,此时req已经被填充了字段
+	//只能为自己创建账户
+	authPayload := ctx.MustGet(authorizationPayloadKey).(*token.Payload)
 	arg := db.CreateAccountParams{
-		Owner:    req.Owner,
+		Owner:    authPayload.Username,
 		Currency: req.Currency,
 		Balance:  0, //金额初始化为0
 	}
@@ -32,8 +58,13 @@ func (server *Server) createAccount(ctx *gin.Context) {
 		if pqErr, ok := err.(*pq.Error); ok {
 			//log.Println(pqErr.Code.Name())
 			switch pqErr.Code.Name() {
-			case "foreign_key_violation", "unique_violation":
+			case "foreign_key_violation":
 				ctx.JSON(http.StatusForbidden, errorRespones(err))
+				return
+			case "unique_violation":
+				//同一个用户的同一种货币已经有账户
+				ctx.JSON(http.StatusConflict, errorRespones(err))
+				return
 			}
 
 		}
@@ -41,7 +72,7 @@ func (server *Server) createAccount(ctx *gin.Context) {
 		return
 	}
 	//没有错误即处理完成,返回成功消息和account
-	ctx.JSON(http.StatusOK, account)
+	ctx.JSON(http.StatusOK, newAccountResponse(account))
 
 }
 
@@ -65,18 +96,24 @@ func (server *Server) getAccount(ctx *gin.Context) {
 		}
 		//其他错误
 		ctx.JSON(http.StatusInternalServerError, errorRespones(err))
+		return
+	}
 
+	//只能查询属于自己的账户
+	authPayload := ctx.MustGet(authorizationPayloadKey).(*token.Payload)
+	if account.Owner != authPayload.Username {
+		err := errors.New("account doesn't belong to the authenticated user")
+		ctx.JSON(http.StatusForbidden, errorRespones(err))
+		return
 	}
 	//没有错误
-	ctx.JSON(http.StatusOK, account)
+	ctx.JSON(http.StatusOK, newAccountResponse(account))
 
 }
 
 //分页显示数据
 type ListAccountRequest struct {
-	//uri标签告诉gin,参数的名称
-	PageID   int32 `form:"page_id" binding:"required,min=1" `          //非空,并且最小值为1
-	PageSize int32 `form:"page_size" binding:"required,min=5,max=10" ` //非空,并且最小值为1
+	pageRequest
 }
 
 func (server *Server) ListAccount(ctx *gin.Context) {
@@ -87,12 +124,19 @@ func (server *Server) ListAccount(ctx *gin.Context) {
 		return
 	}
 
-	arg := db.ListAccountsParams{
-		Limit:  req.PageSize,                    //页面的大小,5-10
-		Offset: (req.PageID - 1) * req.PageSize, //第几页
+	//只列出当前用户的账户
+	authPayload := ctx.MustGet(authorizationPayloadKey).(*token.Payload)
+	if !req.isOffset() {
+		server.listAccountsByCursor(ctx, req.pageRequest, authPayload.Username)
+		return
+	}
+	arg := db.ListAccountsByOwnerParams{
+		Owner:  authPayload.Username,
+		Limit:  req.PageSize, //页面的大小,5-10
+		Offset: req.offset(), //第几页
 	}
 
-	account, err := server.store.ListAccounts(ctx, arg)
+	account, err := server.store.ListAccountsByOwner(ctx, arg)
 	if err != nil { //此处错误有2种,一种查不到,一种是查询出错
 		if err == sql.ErrNoRows {
 			ctx.JSON(http.StatusNotFound, errorRespones(err))
@@ -100,9 +144,46 @@ func (server *Server) ListAccount(ctx *gin.Context) {
 		}
 		//其他错误
 		ctx.JSON(http.StatusInternalServerError, errorRespones(err))
-
+		return
 	}
 	//没有错误
-	ctx.JSON(http.StatusOK, account)
+	ctx.JSON(http.StatusOK, newAccountsResponse(account))
+
+}
+
+//游标分页列出账户,owner为空时列出所有账户(只有后台管理使用)
+func (server *Server) listAccountsByCursor(ctx *gin.Context, req pageRequest, owner string) {
+	page, err := server.cursorPage(req)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, errorRespones(err))
+		return
+	}
 
+	var accounts []db.Account
+	if owner == "" {
+		accounts, err = server.store.ListAccountsAfter(ctx, db.ListAccountsAfterParams{
+			AfterID:    page.AfterID,
+			LimitCount: page.QueryLimit(),
+		})
+	} else {
+		accounts, err = server.store.ListAccountsByOwnerAfter(ctx, db.ListAccountsByOwnerAfterParams{
+			Owner:      owner,
+			AfterID:    page.AfterID,
+			LimitCount: page.QueryLimit(),
+		})
+	}
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorRespones(err))
+		return
+	}
+
+	var nextCursor string
+	if page.HasMore(len(accounts)) {
+		accounts = accounts[:page.Limit]
+		nextCursor = apiutil.EncodePageCursor(accounts[len(accounts)-1].ID)
+	}
+	ctx.JSON(http.StatusOK, cursorPageResponse{
+		Items:      newAccountsResponse(accounts),
+		NextCursor: nextCursor,
+	})
 }
@@ -10,12 +10,14 @@ import (
 	mockdb "github.com/leilei3167/bank/db/mock"
 	db "github.com/leilei3167/bank/db/sqlc"
 	"github.com/leilei3167/bank/db/util"
+	"github.com/leilei3167/bank/token"
 	"github.com/stretchr/testify/require"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"strconv"
 	"testing"
+	"time"
 )
 
 func randomAccount() db.Account {
@@ -35,6 +37,7 @@ func TestGetAccount(t *testing.T) {
 	testCases := []struct {
 		name          string
 		accountID     int64
+		setupAuth     func(t *testing.T, request *http.Request, tokenMaker token.Maker)
 		buildStubs    func(store *mockdb.MockStore)                           //每一个测试用例都需要构建独立的mock
 		checkResponse func(t *testing.T, recorder *httptest.ResponseRecorder) //用于检测得到的数据
 
@@ -42,6 +45,9 @@ func TestGetAccount(t *testing.T) {
 		{
 			name:      "OKcase",
 			accountID: account.ID,
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.Maker) {
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, account.Owner, util.DepositorRole, time.Minute)
+			},
 			buildStubs: func(store *mockdb.MockStore) {
 				store.EXPECT().GetAccount(gomock.Any(),
 					gomock.Eq(account.ID)).Times(1).Return(account, nil)
@@ -55,6 +61,9 @@ func TestGetAccount(t *testing.T) {
 		{
 			name:      "NotFound",
 			accountID: account.ID, //使用相同的ID也可以,因为每个case模拟的store都是独立的
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.Maker) {
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, account.Owner, util.DepositorRole, time.Minute)
+			},
 			buildStubs: func(store *mockdb.MockStore) {
 				store.EXPECT().GetAccount(gomock.Any(),
 					//期望的到查询不到的错误和返回一个空的Account结构体
@@ -70,6 +79,9 @@ func TestGetAccount(t *testing.T) {
 		{
 			name:      "InternalError",
 			accountID: account.ID,
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.Maker) {
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, account.Owner, util.DepositorRole, time.Minute)
+			},
 			buildStubs: func(store *mockdb.MockStore) {
 				store.EXPECT().GetAccount(gomock.Any(),
 					gomock.Eq(account.ID)).Times(1).
@@ -83,6 +95,9 @@ func TestGetAccount(t *testing.T) {
 		{
 			name:      "BadRequest",
 			accountID: 0, //输入一个无效的id
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.Maker) {
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, account.Owner, util.DepositorRole, time.Minute)
+			},
 			buildStubs: func(store *mockdb.MockStore) {
 				store.EXPECT().GetAccount(gomock.Any(),
 					gomock.Any()).Times(0)
@@ -93,6 +108,34 @@ func TestGetAccount(t *testing.T) {
 				//requireBodyMatchAccount(t, recorder.Body, account) 不需要对比
 			},
 		},
+		{
+			name:      "UnauthorizedUser",
+			accountID: account.ID,
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.Maker) {
+				//其他用户不能查询该账户
+				addAuthorization(t, request, tokenMaker, authorizationTypeBearer, "unauthorized_user", util.DepositorRole, time.Minute)
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetAccount(gomock.Any(),
+					gomock.Eq(account.ID)).Times(1).Return(account, nil)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusForbidden, recorder.Code)
+			},
+		},
+		{
+			name:      "NoAuthorization",
+			accountID: account.ID,
+			setupAuth: func(t *testing.T, request *http.Request, tokenMaker token.Maker) {
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				//未鉴权的请求不会到达数据库
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusUnauthorized, recorder.Code)
+			},
+		},
 	}
 	for i := range testCases { //遍历每一个case并执行子测试
 		tc := testCases[i]
@@ -103,11 +146,14 @@ func TestGetAccount(t *testing.T) {
 			store := mockdb.NewMockStore(ctrl)
 			tc.buildStubs(store)
 			//构建api请求,创建Server,用httptest创建一个recorder
-			server := NewServer(store)
+			stubActiveSession(store)
+
+			server := newTestServer(t, store)
 			recorder := httptest.NewRecorder()
 			url := fmt.Sprintf("/accounts/%d", tc.accountID)
 			request, err := http.NewRequest("GET", url, nil)
 			require.NoError(t, err)
+			tc.setupAuth(t, request, server.tokenMaker)
 			//调用ServeHTTP方法传入recorder和请求,recorder相当于response,body就是bytes.buffer
 			server.router.ServeHTTP(recorder, request)
 			//接下来需要对比查询到的account和我们生成的account是否一致
@@ -121,10 +167,12 @@ func requireBodyMatchAccount(t *testing.T, body *bytes.Buffer, account db.Accoun
 	data, err := ioutil.ReadAll(body)
 	require.NoError(t, err)
 
-	var gotAccount db.Account
+	var gotAccount accountResponse
 	err = json.Unmarshal(data, &gotAccount) //从recorder中读出的数据
 	require.NoError(t, err)
-	require.Equal(t, gotAccount, account) //得到的和输入的值一致
+	require.Equal(t, gotAccount.Account, account) //得到的和输入的值一致
+	//余额同时以十进制字符串返回
+	require.Equal(t, util.FormatMinorUnits(account.Balance, 2), gotAccount.BalanceDecimal)
 
 }
 
@@ -139,7 +187,6 @@ func TestCreateAccount(t *testing.T) {
 		{
 			Name: "OK",
 			Body: gin.H{
-				"owner":    account.Owner,
 				"currency": account.Currency,
 			},
 			BuildMock: func(store *mockdb.MockStore) {
@@ -160,7 +207,6 @@ func TestCreateAccount(t *testing.T) {
 		{
 			Name: "Internal",
 			Body: gin.H{
-				"owner":    account.Owner,
 				"currency": account.Currency,
 			},
 			BuildMock: func(store *mockdb.MockStore) {
@@ -195,13 +241,16 @@ func TestCreateAccount(t *testing.T) {
 			tc.BuildMock(store)
 
 			//构建调用api
-			server := NewServer(store)
+			stubActiveSession(store)
+
+			server := newTestServer(t, store)
 			recorder := httptest.NewRecorder()
 			url := "/accounts"
 			body, err := json.Marshal(tc.Body)
 			require.NoError(t, err)
 			request, err := http.NewRequest("POST", url, bytes.NewReader(body))
 			require.NoError(t, err)
+			addAuthorization(t, request, server.tokenMaker, authorizationTypeBearer, account.Owner, util.DepositorRole, time.Minute)
 			server.router.ServeHTTP(recorder, request)
 			tc.checkResponse(t, recorder)
 		})
@@ -236,11 +285,12 @@ func TestListAccount(t *testing.T) {
 				pageSize: n,
 			},
 			build: func(store *mockdb.MockStore) {
-				arg := db.ListAccountsParams{
+				arg := db.ListAccountsByOwnerParams{
+					Owner:  accounts[0].Owner,
 					Limit:  int32(n),
 					Offset: 0,
 				}
-				store.EXPECT().ListAccounts(gomock.Any(), gomock.Eq(arg)).Times(1).
+				store.EXPECT().ListAccountsByOwner(gomock.Any(), gomock.Eq(arg)).Times(1).
 					Return(accounts, nil)
 			},
 			check: func(recorder *httptest.ResponseRecorder) {
@@ -256,7 +306,7 @@ func TestListAccount(t *testing.T) {
 				pageSize: 1000,
 			},
 			build: func(store *mockdb.MockStore) {
-				store.EXPECT().ListAccounts(gomock.Any(), gomock.Any()).Times(0)
+				store.EXPECT().ListAccountsByOwner(gomock.Any(), gomock.Any()).Times(0)
 			},
 			check: func(recorder *httptest.ResponseRecorder) {
 				require.Equal(t, recorder.Code, http.StatusBadRequest)
@@ -269,11 +319,12 @@ func TestListAccount(t *testing.T) {
 				pageSize: n,
 			},
 			build: func(store *mockdb.MockStore) {
-				arg := db.ListAccountsParams{
+				arg := db.ListAccountsByOwnerParams{
+					Owner:  accounts[0].Owner,
 					Limit:  int32(n),
 					Offset: 0,
 				}
-				store.EXPECT().ListAccounts(gomock.Any(), arg).Times(1).
+				store.EXPECT().ListAccountsByOwner(gomock.Any(), arg).Times(1).
 					Return([]db.Account{}, sql.ErrNoRows)
 
 			},
@@ -288,11 +339,12 @@ func TestListAccount(t *testing.T) {
 				pageSize: n,
 			},
 			build: func(store *mockdb.MockStore) {
-				arg := db.ListAccountsParams{
+				arg := db.ListAccountsByOwnerParams{
+					Owner:  accounts[0].Owner,
 					Limit:  int32(n),
 					Offset: 0,
 				}
-				store.EXPECT().ListAccounts(gomock.Any(), arg).Times(1).
+				store.EXPECT().ListAccountsByOwner(gomock.Any(), arg).Times(1).
 					Return([]db.Account{}, sql.ErrConnDone)
 			},
 			check: func(recorder *httptest.ResponseRecorder) {
@@ -310,7 +362,9 @@ func TestListAccount(t *testing.T) {
 			tc.build(store)
 
 			//构建API调用
-			server := NewServer(store)
+			stubActiveSession(store)
+
+			server := newTestServer(t, store)
 			recorder := httptest.NewRecorder()
 			url := fmt.Sprintf("/accounts")
 			request, err := http.NewRequest("GET", url, nil)
@@ -320,6 +374,7 @@ func TestListAccount(t *testing.T) {
 			q.Add("page_id", strconv.Itoa(tc.query.pageID))
 			q.Add("page_size", strconv.Itoa(tc.query.pageSize))
 			request.URL.RawQuery = q.Encode()
+			addAuthorization(t, request, server.tokenMaker, authorizationTypeBearer, accounts[0].Owner, util.DepositorRole, time.Minute)
 			server.router.ServeHTTP(recorder, request)
 
 			//检查返回值
@@ -0,0 +1,135 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	db "github.com/leilei3167/bank/db/sqlc"
+)
+
+//以下处理器只注册在/admin路由组下,只有银行职员可以访问
+
+//列出银行中所有的账户
+func (server *Server) adminListAccounts(ctx *gin.Context) {
+	var req ListAccountRequest
+	if err := ctx.ShouldBindQuery(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorRespones(err))
+		return
+	}
+
+	if !req.isOffset() {
+		server.listAccountsByCursor(ctx, req.pageRequest, "")
+		return
+	}
+
+	arg := db.ListAccountsParams{
+		Limit:  req.PageSize,
+		Offset: req.offset(),
+	}
+	accounts, err := server.store.ListAccounts(ctx, arg)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorRespones(err))
+		return
+	}
+	ctx.JSON(http.StatusOK, newAccountsResponse(accounts))
+}
+
+//分页列出所有用户
+type listUsersRequest struct {
+	PageID   int32 `form:"page_id" binding:"required,min=1"`
+	PageSize int32 `form:"page_size" binding:"required,min=5,max=10"`
+}
+
+func (server *Server) adminListUsers(ctx *gin.Context) {
+	var req listUsersRequest
+	if err := ctx.ShouldBindQuery(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorRespones(err))
+		return
+	}
+
+	arg := db.ListUsersParams{
+		Limit:  req.PageSize,
+		Offset: (req.PageID - 1) * req.PageSize,
+	}
+	users, err := server.store.ListUsers(ctx, arg)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorRespones(err))
+		return
+	}
+
+	//同样不能返回哈希后的密码
+	resp := make([]ResUser, 0, len(users))
+	for _, user := range users {
+		resp = append(resp, newUserResponse(user))
+	}
+	ctx.JSON(http.StatusOK, resp)
+}
+
+//冻结账户,冻结后的账户不能转入或转出
+func (server *Server) adminFreezeAccount(ctx *gin.Context) {
+	server.setAccountFrozen(ctx, true)
+}
+
+func (server *Server) adminUnfreezeAccount(ctx *gin.Context) {
+	server.setAccountFrozen(ctx, false)
+}
+
+func (server *Server) setAccountFrozen(ctx *gin.Context, frozen bool) {
+	var req getAccountRequest
+	if err := ctx.ShouldBindUri(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorRespones(err))
+		return
+	}
+
+	account, err := server.store.SetAccountFrozen(ctx, db.SetAccountFrozenParams{
+		ID:       req.ID,
+		IsFrozen: frozen,
+	})
+	if err != nil {
+		if err == sql.ErrNoRows {
+			ctx.JSON(http.StatusNotFound, errorRespones(err))
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, errorRespones(err))
+		return
+	}
+	ctx.JSON(http.StatusOK, newAccountResponse(account))
+}
+
+//查看任意一笔转账
+func (server *Server) adminGetTransfer(ctx *gin.Context) {
+	var req getTransferRequest
+	if err := ctx.ShouldBindUri(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorRespones(err))
+		return
+	}
+
+	transfer, fromAccount, toAccount, ok := server.loadTransfer(ctx, req.ID)
+	if !ok {
+		return
+	}
+	ctx.JSON(http.StatusOK, newTransferResponse(transfer, fromAccount.Currency, toAccount.Currency))
+}
+
+//最近一次对账的报告,包括后台任务和命令行执行的对账,还没有执行过时返回404
+func (server *Server) adminGetReconciliation(ctx *gin.Context) {
+	run, err := server.store.GetLatestReconciliationRun(ctx)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			ctx.JSON(http.StatusNotFound, errorRespones(err))
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, errorRespones(err))
+		return
+	}
+
+	var report db.ReconciliationReport
+	if err := json.Unmarshal(run.Report, &report); err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorRespones(err))
+		return
+	}
+	report.RunID = run.ID
+	ctx.JSON(http.StatusOK, report)
+}
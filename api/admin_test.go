@@ -0,0 +1,214 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	mockdb "github.com/leilei3167/bank/db/mock"
+	db "github.com/leilei3167/bank/db/sqlc"
+	"github.com/leilei3167/bank/db/util"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAdminAPI(t *testing.T) {
+	account := randomAccount()
+	user, _ := randomUser(t)
+	transfer := db.Transfer{
+		ID:             util.RandomInt(1, 1000),
+		FromAccountID:  account.ID,
+		ToAccountID:    account.ID + 1,
+		Amount:         10,
+		CreditedAmount: 10,
+		ExchangeRate:   "1",
+	}
+	reconciliationReport := db.ReconciliationReport{
+		AccountsChecked: 1,
+		AccountDrifts: []db.AccountDrift{
+			{AccountID: account.ID, Currency: account.Currency, Balance: 100, EntriesTotal: 90, Drift: 10},
+		},
+		TransferDrifts: []db.TransferDrift{},
+	}
+
+	testCases := []struct {
+		name          string
+		method        string
+		url           string
+		role          string
+		buildStubs    func(store *mockdb.MockStore)
+		checkResponse func(recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name:   "ListAccountsOK",
+			method: http.MethodGet,
+			url:    "/admin/accounts?page_id=1&page_size=5",
+			role:   util.BankerRole,
+			buildStubs: func(store *mockdb.MockStore) {
+				arg := db.ListAccountsParams{Limit: 5, Offset: 0}
+				store.EXPECT().ListAccounts(gomock.Any(), gomock.Eq(arg)).Times(1).Return([]db.Account{account}, nil)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+				requireBodyMatchAccounts(t, recorder.Body, []db.Account{account})
+			},
+		},
+		{
+			name:   "ListAccountsForbidden",
+			method: http.MethodGet,
+			url:    "/admin/accounts?page_id=1&page_size=5",
+			role:   util.DepositorRole,
+			buildStubs: func(store *mockdb.MockStore) {
+				//普通用户不能访问后台路由
+				store.EXPECT().ListAccounts(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusForbidden, recorder.Code)
+			},
+		},
+		{
+			name:   "ListUsersOK",
+			method: http.MethodGet,
+			url:    "/admin/users?page_id=1&page_size=5",
+			role:   util.BankerRole,
+			buildStubs: func(store *mockdb.MockStore) {
+				arg := db.ListUsersParams{Limit: 5, Offset: 0}
+				store.EXPECT().ListUsers(gomock.Any(), gomock.Eq(arg)).Times(1).Return([]db.User{user}, nil)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+
+				var gotUsers []db.User
+				err := json.Unmarshal(recorder.Body.Bytes(), &gotUsers)
+				require.NoError(t, err)
+				require.Len(t, gotUsers, 1)
+				require.Equal(t, user.Username, gotUsers[0].Username)
+				require.Empty(t, gotUsers[0].HashedPassword)
+			},
+		},
+		{
+			name:   "FreezeAccountOK",
+			method: http.MethodPost,
+			url:    fmt.Sprintf("/admin/accounts/%d/freeze", account.ID),
+			role:   util.BankerRole,
+			buildStubs: func(store *mockdb.MockStore) {
+				arg := db.SetAccountFrozenParams{ID: account.ID, IsFrozen: true}
+				frozen := account
+				frozen.IsFrozen = true
+				store.EXPECT().SetAccountFrozen(gomock.Any(), gomock.Eq(arg)).Times(1).Return(frozen, nil)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+			},
+		},
+		{
+			name:   "UnfreezeAccountNotFound",
+			method: http.MethodPost,
+			url:    fmt.Sprintf("/admin/accounts/%d/unfreeze", account.ID),
+			role:   util.BankerRole,
+			buildStubs: func(store *mockdb.MockStore) {
+				arg := db.SetAccountFrozenParams{ID: account.ID, IsFrozen: false}
+				store.EXPECT().SetAccountFrozen(gomock.Any(), gomock.Eq(arg)).Times(1).Return(db.Account{}, sql.ErrNoRows)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusNotFound, recorder.Code)
+			},
+		},
+		{
+			name:   "GetTransferOK",
+			method: http.MethodGet,
+			url:    fmt.Sprintf("/admin/transfers/%d", transfer.ID),
+			role:   util.BankerRole,
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetTransfer(gomock.Any(), gomock.Eq(transfer.ID)).Times(1).Return(transfer, nil)
+
+				toAccount := account
+				toAccount.ID = transfer.ToAccountID
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(transfer.FromAccountID)).Times(1).Return(account, nil)
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(transfer.ToAccountID)).Times(1).Return(toAccount, nil)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+
+				var got transferResponse
+				err := json.Unmarshal(recorder.Body.Bytes(), &got)
+				require.NoError(t, err)
+				require.Equal(t, transfer.ID, got.ID)
+				require.Equal(t, "0.10", got.AmountDecimal)
+				require.Equal(t, "0.10", got.CreditedAmountDecimal)
+			},
+		},
+		{
+			name:   "GetTransferForbidden",
+			method: http.MethodGet,
+			url:    fmt.Sprintf("/admin/transfers/%d", transfer.ID),
+			role:   util.DepositorRole,
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetTransfer(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusForbidden, recorder.Code)
+			},
+		},
+		{
+			name:   "GetReconciliationOK",
+			method: http.MethodGet,
+			url:    "/admin/reconciliation",
+			role:   util.BankerRole,
+			buildStubs: func(store *mockdb.MockStore) {
+				data, err := json.Marshal(reconciliationReport)
+				require.NoError(t, err)
+				run := db.ReconciliationRun{ID: 7, HasDrift: true, Report: data}
+				store.EXPECT().GetLatestReconciliationRun(gomock.Any()).Times(1).Return(run, nil)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+
+				var got db.ReconciliationReport
+				err := json.Unmarshal(recorder.Body.Bytes(), &got)
+				require.NoError(t, err)
+				require.Equal(t, int64(7), got.RunID)
+				require.Equal(t, reconciliationReport.AccountDrifts, got.AccountDrifts)
+			},
+		},
+		{
+			name:   "GetReconciliationNotFound",
+			method: http.MethodGet,
+			url:    "/admin/reconciliation",
+			role:   util.BankerRole,
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetLatestReconciliationRun(gomock.Any()).Times(1).Return(db.ReconciliationRun{}, sql.ErrNoRows)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusNotFound, recorder.Code)
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			store := mockdb.NewMockStore(ctrl)
+			tc.buildStubs(store)
+			stubActiveSession(store)
+
+			server := newTestServer(t, store)
+			recorder := httptest.NewRecorder()
+
+			request, err := http.NewRequest(tc.method, tc.url, nil)
+			require.NoError(t, err)
+
+			addAuthorization(t, request, server.tokenMaker, authorizationTypeBearer, "staff", tc.role, time.Minute)
+			server.router.ServeHTTP(recorder, request)
+			tc.checkResponse(recorder)
+		})
+	}
+}
@@ -0,0 +1,80 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/leilei3167/bank/apiutil"
+	db "github.com/leilei3167/bank/db/sqlc"
+	"github.com/leilei3167/bank/db/util"
+	"github.com/leilei3167/bank/token"
+)
+
+//存取款的金额以账户的货币计,currency必须和账户一致
+type cashRequest struct {
+	Amount   int64  `json:"amount" binding:"required,min=1"`
+	Currency string `json:"currency" binding:"required,currency"`
+}
+
+//只返回客户账户这一方,清算账户是内部的
+type cashResponse struct {
+	Account accountResponse `json:"account"`
+	Entry   entryResponse   `json:"entry"`
+}
+
+func (server *Server) createDeposit(ctx *gin.Context) {
+	server.moveCash(ctx, server.store.DepositTx)
+}
+
+func (server *Server) createWithdrawal(ctx *gin.Context) {
+	server.moveCash(ctx, server.store.WithdrawTx)
+}
+
+//存款和取款的处理流程相同,只是调用的store方法不同
+func (server *Server) moveCash(ctx *gin.Context, move func(context.Context, db.CashTxParams) (db.CashTxResult, error)) {
+	var uri getAccountRequest
+	if err := ctx.ShouldBindUri(&uri); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorRespones(err))
+		return
+	}
+	var req cashRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorRespones(err))
+		return
+	}
+
+	account, valid := server.validAccount(ctx, uri.ID)
+	if !valid {
+		return
+	}
+	//账户的拥有者或者银行职员才能取款,存款的路由已经限制了只有银行职员
+	authPayload := ctx.MustGet(authorizationPayloadKey).(*token.Payload)
+	if account.Owner != authPayload.Username && authPayload.Role != util.BankerRole {
+		err := errors.New("account doesn't belong to the authenticated user")
+		ctx.JSON(http.StatusForbidden, errorRespones(err))
+		return
+	}
+	if account.Currency != req.Currency {
+		err := fmt.Errorf("account [%v] currency mismatch:[%v]->[%v]",
+			account.ID, account.Currency, req.Currency)
+		ctx.JSON(http.StatusBadRequest, errorRespones(err))
+		return
+	}
+
+	result, err := move(ctx, db.CashTxParams{
+		AccountID: account.ID,
+		Amount:    req.Amount,
+	})
+	if err != nil {
+		ctx.JSON(apiutil.TransferErrorStatus(err), errorRespones(err))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, cashResponse{
+		Account: newAccountResponse(result.Account),
+		Entry:   newEntryResponse(result.Entry, result.Account.Currency),
+	})
+}
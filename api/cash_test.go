@@ -0,0 +1,254 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang/mock/gomock"
+	mockdb "github.com/leilei3167/bank/db/mock"
+	db "github.com/leilei3167/bank/db/sqlc"
+	"github.com/leilei3167/bank/db/util"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCashAPI(t *testing.T) {
+	account := randomAccount()
+	amount := int64(100)
+
+	//存取款之后的结果
+	depositResult := func() db.CashTxResult {
+		updated := account
+		updated.Balance += amount
+		return db.CashTxResult{
+			Account: updated,
+			Entry:   db.Entry{ID: 1, AccountID: account.ID, Amount: amount},
+		}
+	}
+
+	testCases := []struct {
+		name          string
+		path          string
+		body          gin.H
+		username      string
+		role          string
+		buildStubs    func(store *mockdb.MockStore)
+		checkResponse func(recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name:     "DepositOK",
+			path:     "deposits",
+			body:     gin.H{"amount": amount, "currency": account.Currency},
+			username: "staff",
+			role:     util.BankerRole,
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(account.ID)).Times(1).Return(account, nil)
+				arg := db.CashTxParams{AccountID: account.ID, Amount: amount}
+				store.EXPECT().DepositTx(gomock.Any(), gomock.Eq(arg)).Times(1).Return(depositResult(), nil)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+
+				var got cashResponse
+				err := json.Unmarshal(recorder.Body.Bytes(), &got)
+				require.NoError(t, err)
+				require.Equal(t, account.Balance+amount, got.Account.Balance)
+				require.Equal(t, amount, got.Entry.Amount)
+				require.Equal(t, "1.00", got.Entry.AmountDecimal)
+			},
+		},
+		{
+			//存款没有资金来源,账户的拥有者也不能给自己存款
+			name:     "DepositByOwner",
+			path:     "deposits",
+			body:     gin.H{"amount": amount, "currency": account.Currency},
+			username: account.Owner,
+			role:     util.DepositorRole,
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Any()).Times(0)
+				store.EXPECT().DepositTx(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusForbidden, recorder.Code)
+			},
+		},
+		{
+			name:     "DepositUnauthorizedUser",
+			path:     "deposits",
+			body:     gin.H{"amount": amount, "currency": account.Currency},
+			username: "unauthorized_user",
+			role:     util.DepositorRole,
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Any()).Times(0)
+				store.EXPECT().DepositTx(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusForbidden, recorder.Code)
+			},
+		},
+		{
+			name:     "DepositInvalidAmount",
+			path:     "deposits",
+			body:     gin.H{"amount": -amount, "currency": account.Currency},
+			username: "staff",
+			role:     util.BankerRole,
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Any()).Times(0)
+				store.EXPECT().DepositTx(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+		{
+			//银行职员也不能对外汇和手续费等系统账户存取款
+			name:     "DepositSystemAccount",
+			path:     "deposits",
+			body:     gin.H{"amount": amount, "currency": account.Currency},
+			username: "staff",
+			role:     util.BankerRole,
+			buildStubs: func(store *mockdb.MockStore) {
+				system := account
+				system.Owner = db.FeeAccountOwner
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(account.ID)).Times(1).Return(system, nil)
+				store.EXPECT().DepositTx(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+		{
+			name:     "WithdrawSystemAccount",
+			path:     "withdrawals",
+			body:     gin.H{"amount": amount, "currency": account.Currency},
+			username: "staff",
+			role:     util.BankerRole,
+			buildStubs: func(store *mockdb.MockStore) {
+				system := account
+				system.Owner = db.FXAccountOwner
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(account.ID)).Times(1).Return(system, nil)
+				store.EXPECT().WithdrawTx(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+		{
+			name:     "WithdrawOK",
+			path:     "withdrawals",
+			body:     gin.H{"amount": amount, "currency": account.Currency},
+			username: account.Owner,
+			role:     util.DepositorRole,
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(account.ID)).Times(1).Return(account, nil)
+				arg := db.CashTxParams{AccountID: account.ID, Amount: amount}
+				store.EXPECT().WithdrawTx(gomock.Any(), gomock.Eq(arg)).Times(1).Return(db.CashTxResult{Account: account}, nil)
+				store.EXPECT().DepositTx(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+			},
+		},
+		{
+			name:     "WithdrawInsufficientBalance",
+			path:     "withdrawals",
+			body:     gin.H{"amount": amount, "currency": account.Currency},
+			username: account.Owner,
+			role:     util.DepositorRole,
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(account.ID)).Times(1).Return(account, nil)
+				store.EXPECT().
+					WithdrawTx(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(db.CashTxResult{}, db.ErrInsufficientBalance)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+		{
+			name:     "WithdrawFrozenAccount",
+			path:     "withdrawals",
+			body:     gin.H{"amount": amount, "currency": account.Currency},
+			username: account.Owner,
+			role:     util.DepositorRole,
+			buildStubs: func(store *mockdb.MockStore) {
+				frozen := account
+				frozen.IsFrozen = true
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(account.ID)).Times(1).Return(frozen, nil)
+				store.EXPECT().WithdrawTx(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusForbidden, recorder.Code)
+			},
+		},
+		{
+			name:     "WithdrawFrozenDuringTx",
+			path:     "withdrawals",
+			body:     gin.H{"amount": amount, "currency": account.Currency},
+			username: account.Owner,
+			role:     util.DepositorRole,
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(account.ID)).Times(1).Return(account, nil)
+				store.EXPECT().WithdrawTx(gomock.Any(), gomock.Any()).Times(1).Return(db.CashTxResult{}, db.ErrAccountFrozen)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusForbidden, recorder.Code)
+			},
+		},
+		{
+			name:     "WithdrawCurrencyMismatch",
+			path:     "withdrawals",
+			body:     gin.H{"amount": amount, "currency": otherCurrency(account.Currency)},
+			username: account.Owner,
+			role:     util.DepositorRole,
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(account.ID)).Times(1).Return(account, nil)
+				store.EXPECT().WithdrawTx(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			store := mockdb.NewMockStore(ctrl)
+			tc.buildStubs(store)
+			stubActiveSession(store)
+
+			server := newTestServer(t, store)
+			recorder := httptest.NewRecorder()
+
+			data, err := json.Marshal(tc.body)
+			require.NoError(t, err)
+
+			url := fmt.Sprintf("/accounts/%d/%s", account.ID, tc.path)
+			request, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(data))
+			require.NoError(t, err)
+
+			addAuthorization(t, request, server.tokenMaker, authorizationTypeBearer, tc.username, tc.role, time.Minute)
+			server.router.ServeHTTP(recorder, request)
+			tc.checkResponse(recorder)
+		})
+	}
+}
+
+//返回一个和给定货币不同的已支持货币
+func otherCurrency(currency string) string {
+	if currency == util.USD {
+		return util.EUR
+	}
+	return util.USD
+}
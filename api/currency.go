@@ -0,0 +1,59 @@
+package api
+
+import (
+	"database/sql"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	db "github.com/leilei3167/bank/db/sqlc"
+	"github.com/leilei3167/bank/db/util"
+)
+
+//列出所有货币,包括已禁用的
+func (server *Server) adminListCurrencies(ctx *gin.Context) {
+	currencies, err := server.store.ListCurrencies(ctx)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorRespones(err))
+		return
+	}
+	ctx.JSON(http.StatusOK, currencies)
+}
+
+//禁用的货币不能再开户,该货币的已有账户也不能再转账、存取款或创建定时转账,只能查询,重新启用后恢复
+//已经创建的定时转账不经过验证器,到期时照常执行
+type currencyCodeRequest struct {
+	Code string `uri:"code" binding:"required,len=3"`
+}
+
+func (server *Server) adminEnableCurrency(ctx *gin.Context) {
+	server.setCurrencyEnabled(ctx, true)
+}
+
+func (server *Server) adminDisableCurrency(ctx *gin.Context) {
+	server.setCurrencyEnabled(ctx, false)
+}
+
+func (server *Server) setCurrencyEnabled(ctx *gin.Context, enabled bool) {
+	var req currencyCodeRequest
+	if err := ctx.ShouldBindUri(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorRespones(err))
+		return
+	}
+
+	currency, err := server.store.SetCurrencyEnabled(ctx, db.SetCurrencyEnabledParams{
+		Code:    req.Code,
+		Enabled: enabled,
+	})
+	if err != nil {
+		if err == sql.ErrNoRows {
+			ctx.JSON(http.StatusNotFound, errorRespones(err))
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, errorRespones(err))
+		return
+	}
+
+	//立即更新本实例的注册表,其他实例由worker.CurrencySyncer定期刷新
+	util.Currencies.Put(currency.RegistryCurrency())
+	ctx.JSON(http.StatusOK, currency)
+}
@@ -0,0 +1,170 @@
+package api
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang/mock/gomock"
+	mockdb "github.com/leilei3167/bank/db/mock"
+	db "github.com/leilei3167/bank/db/sqlc"
+	"github.com/leilei3167/bank/db/util"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCurrencyAdminAPI(t *testing.T) {
+	//测试会修改全局的注册表,结束后恢复
+	defer util.Currencies.Replace(util.DefaultCurrencies)
+
+	testCases := []struct {
+		name          string
+		method        string
+		url           string
+		role          string
+		buildStubs    func(store *mockdb.MockStore)
+		checkResponse func(recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name:   "ListCurrenciesOK",
+			method: http.MethodGet,
+			url:    "/admin/currencies",
+			role:   util.BankerRole,
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().ListCurrencies(gomock.Any()).Times(1).Return([]db.Currency{{Code: util.USD, Exponent: 2, Enabled: true}}, nil)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+			},
+		},
+		{
+			name:   "DisableCurrencyOK",
+			method: http.MethodPost,
+			url:    fmt.Sprintf("/admin/currencies/%s/disable", util.EUR),
+			role:   util.BankerRole,
+			buildStubs: func(store *mockdb.MockStore) {
+				arg := db.SetCurrencyEnabledParams{Code: util.EUR, Enabled: false}
+				store.EXPECT().
+					SetCurrencyEnabled(gomock.Any(), gomock.Eq(arg)).
+					Times(1).
+					Return(db.Currency{Code: util.EUR, Exponent: 2, Symbol: "€", Enabled: false}, nil)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+				//禁用后验证器不再接受该货币
+				require.False(t, util.IsSupportedCurrency(util.EUR))
+			},
+		},
+		{
+			name:   "EnableCurrencyOK",
+			method: http.MethodPost,
+			url:    fmt.Sprintf("/admin/currencies/%s/enable", util.EUR),
+			role:   util.BankerRole,
+			buildStubs: func(store *mockdb.MockStore) {
+				arg := db.SetCurrencyEnabledParams{Code: util.EUR, Enabled: true}
+				store.EXPECT().
+					SetCurrencyEnabled(gomock.Any(), gomock.Eq(arg)).
+					Times(1).
+					Return(db.Currency{Code: util.EUR, Exponent: 2, Symbol: "€", Enabled: true}, nil)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+				require.True(t, util.IsSupportedCurrency(util.EUR))
+			},
+		},
+		{
+			name:   "EnableCurrencyNotFound",
+			method: http.MethodPost,
+			url:    "/admin/currencies/XXX/enable",
+			role:   util.BankerRole,
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					SetCurrencyEnabled(gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(db.Currency{}, sql.ErrNoRows)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusNotFound, recorder.Code)
+			},
+		},
+		{
+			name:   "DisableCurrencyForbidden",
+			method: http.MethodPost,
+			url:    fmt.Sprintf("/admin/currencies/%s/disable", util.USD),
+			role:   util.DepositorRole,
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().SetCurrencyEnabled(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusForbidden, recorder.Code)
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			store := mockdb.NewMockStore(ctrl)
+			tc.buildStubs(store)
+			stubActiveSession(store)
+
+			server := newTestServer(t, store)
+			recorder := httptest.NewRecorder()
+
+			request, err := http.NewRequest(tc.method, tc.url, nil)
+			require.NoError(t, err)
+
+			addAuthorization(t, request, server.tokenMaker, authorizationTypeBearer, "staff", tc.role, time.Minute)
+			server.router.ServeHTTP(recorder, request)
+			tc.checkResponse(recorder)
+		})
+	}
+}
+
+func TestDisabledCurrencyAccount(t *testing.T) {
+	defer util.Currencies.Replace(util.DefaultCurrencies)
+	util.Currencies.Put(util.Currency{Code: util.EUR, Exponent: 2, Symbol: "€", Enabled: false})
+
+	account := randomAccount()
+	account.Currency = util.EUR
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	store := mockdb.NewMockStore(ctrl)
+	stubActiveSession(store)
+	store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(account.ID)).Times(1).Return(account, nil)
+	store.EXPECT().TransferTx(gomock.Any(), gomock.Any()).Times(0)
+	server := newTestServer(t, store)
+
+	//已有的账户仍然可以查询
+	recorder := httptest.NewRecorder()
+	request, err := http.NewRequest(http.MethodGet, fmt.Sprintf("/accounts/%d", account.ID), nil)
+	require.NoError(t, err)
+	addAuthorization(t, request, server.tokenMaker, authorizationTypeBearer, account.Owner, util.DepositorRole, time.Minute)
+	server.router.ServeHTTP(recorder, request)
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	//但不能再用禁用的货币转账
+	body, err := json.Marshal(gin.H{
+		"fromAccoutID": account.ID,
+		"toAccountID":  account.ID + 1,
+		"amout":        10,
+		"currency":     util.EUR,
+	})
+	require.NoError(t, err)
+	recorder = httptest.NewRecorder()
+	request, err = http.NewRequest(http.MethodPost, "/transfer", bytes.NewReader(body))
+	require.NoError(t, err)
+	addAuthorization(t, request, server.tokenMaker, authorizationTypeBearer, account.Owner, util.DepositorRole, time.Minute)
+	server.router.ServeHTTP(recorder, request)
+	require.Equal(t, http.StatusBadRequest, recorder.Code)
+}
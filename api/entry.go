@@ -0,0 +1,211 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/leilei3167/bank/apiutil"
+	db "github.com/leilei3167/bank/db/sqlc"
+	"github.com/leilei3167/bank/db/util"
+	"github.com/leilei3167/bank/token"
+)
+
+//对账单最多覆盖的时间范围,避免一次返回过多的流水
+const maxStatementPeriod = 366 * 24 * time.Hour
+
+//查询当前用户的账户,不存在返回404,不属于当前用户返回403,返回值表示是否可以继续处理
+func (server *Server) getOwnedAccount(ctx *gin.Context, accountID int64) (db.Account, bool) {
+	account, err := server.store.GetAccount(ctx, accountID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			ctx.JSON(http.StatusNotFound, errorRespones(err))
+			return account, false
+		}
+		ctx.JSON(http.StatusInternalServerError, errorRespones(err))
+		return account, false
+	}
+
+	authPayload := ctx.MustGet(authorizationPayloadKey).(*token.Payload)
+	if account.Owner != authPayload.Username {
+		err := errors.New("account doesn't belong to the authenticated user")
+		ctx.JSON(http.StatusForbidden, errorRespones(err))
+		return account, false
+	}
+	return account, true
+}
+
+//时间使用RFC3339格式,区间为[from,to),都不传时返回全部流水
+type listEntriesRequest struct {
+	From time.Time `form:"from" time_format:"2006-01-02T15:04:05Z07:00"`
+	To   time.Time `form:"to" time_format:"2006-01-02T15:04:05Z07:00"`
+	pageRequest
+}
+
+//流水的每一行都附带记账之后的余额
+type entryWithBalanceResponse struct {
+	entryResponse
+	BalanceAfter        int64  `json:"balance_after"`
+	BalanceAfterDecimal string `json:"balance_after_decimal"`
+}
+
+func newEntryWithBalanceResponse(entry db.EntryWithBalance, currency string) entryWithBalanceResponse {
+	return entryWithBalanceResponse{
+		entryResponse:       newEntryResponse(entry.Entry, currency),
+		BalanceAfter:        entry.BalanceAfter,
+		BalanceAfterDecimal: util.Currencies.FormatAmount(entry.BalanceAfter, currency),
+	}
+}
+
+func (server *Server) listEntries(ctx *gin.Context) {
+	var uri getAccountRequest
+	if err := ctx.ShouldBindUri(&uri); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorRespones(err))
+		return
+	}
+	var req listEntriesRequest
+	if err := ctx.ShouldBindQuery(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorRespones(err))
+		return
+	}
+	//没有指定结束时间时查询到当前为止
+	if req.To.IsZero() {
+		req.To = time.Now()
+	}
+	if !req.From.Before(req.To) {
+		err := errors.New("from must be before to")
+		ctx.JSON(http.StatusBadRequest, errorRespones(err))
+		return
+	}
+
+	account, ok := server.getOwnedAccount(ctx, uri.ID)
+	if !ok {
+		return
+	}
+
+	arg := db.ListEntriesWithBalanceParams{
+		AccountID: account.ID,
+		From:      req.From,
+		To:        req.To,
+	}
+	var page apiutil.CursorPage
+	if req.isOffset() {
+		arg.Limit = req.PageSize
+		arg.Offset = req.offset()
+	} else {
+		var err error
+		page, err = server.cursorPage(req.pageRequest)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, errorRespones(err))
+			return
+		}
+		arg.AfterID = page.AfterID
+		arg.Limit = page.QueryLimit()
+	}
+
+	entries, err := server.store.ListEntriesWithBalance(ctx, arg)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorRespones(err))
+		return
+	}
+
+	var nextCursor string
+	if !req.isOffset() && page.HasMore(len(entries)) {
+		entries = entries[:page.Limit]
+		nextCursor = apiutil.EncodePageCursor(entries[len(entries)-1].ID)
+	}
+
+	resp := make([]entryWithBalanceResponse, 0, len(entries))
+	for _, entry := range entries {
+		resp = append(resp, newEntryWithBalanceResponse(entry, account.Currency))
+	}
+	if req.isOffset() {
+		ctx.JSON(http.StatusOK, resp)
+		return
+	}
+	ctx.JSON(http.StatusOK, cursorPageResponse{Items: resp, NextCursor: nextCursor})
+}
+
+//对账单的时间区间为[from,to),两者都必须指定
+type statementRequest struct {
+	From time.Time `form:"from" binding:"required" time_format:"2006-01-02T15:04:05Z07:00"`
+	To   time.Time `form:"to" binding:"required" time_format:"2006-01-02T15:04:05Z07:00"`
+}
+
+type statementResponse struct {
+	Account               accountResponse            `json:"account"`
+	From                  time.Time                  `json:"from"`
+	To                    time.Time                  `json:"to"`
+	OpeningBalance        int64                      `json:"opening_balance"`
+	OpeningBalanceDecimal string                     `json:"opening_balance_decimal"`
+	ClosingBalance        int64                      `json:"closing_balance"`
+	ClosingBalanceDecimal string                     `json:"closing_balance_decimal"`
+	TotalIn               int64                      `json:"total_in"`
+	TotalInDecimal        string                     `json:"total_in_decimal"`
+	TotalOut              int64                      `json:"total_out"`
+	TotalOutDecimal       string                     `json:"total_out_decimal"`
+	Entries               []entryWithBalanceResponse `json:"entries"`
+}
+
+func newStatementResponse(statement db.AccountStatement) statementResponse {
+	currency := statement.Account.Currency
+	resp := statementResponse{
+		Account:               newAccountResponse(statement.Account),
+		From:                  statement.From,
+		To:                    statement.To,
+		OpeningBalance:        statement.OpeningBalance,
+		OpeningBalanceDecimal: util.Currencies.FormatAmount(statement.OpeningBalance, currency),
+		ClosingBalance:        statement.ClosingBalance,
+		ClosingBalanceDecimal: util.Currencies.FormatAmount(statement.ClosingBalance, currency),
+		TotalIn:               statement.TotalIn,
+		TotalInDecimal:        util.Currencies.FormatAmount(statement.TotalIn, currency),
+		TotalOut:              statement.TotalOut,
+		TotalOutDecimal:       util.Currencies.FormatAmount(statement.TotalOut, currency),
+		Entries:               make([]entryWithBalanceResponse, 0, len(statement.Entries)),
+	}
+	for _, entry := range statement.Entries {
+		resp.Entries = append(resp.Entries, newEntryWithBalanceResponse(entry, currency))
+	}
+	return resp
+}
+
+func (server *Server) getStatement(ctx *gin.Context) {
+	var uri getAccountRequest
+	if err := ctx.ShouldBindUri(&uri); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorRespones(err))
+		return
+	}
+	var req statementRequest
+	if err := ctx.ShouldBindQuery(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorRespones(err))
+		return
+	}
+	if !req.From.Before(req.To) {
+		err := errors.New("from must be before to")
+		ctx.JSON(http.StatusBadRequest, errorRespones(err))
+		return
+	}
+	if req.To.Sub(req.From) > maxStatementPeriod {
+		err := errors.New("statement period must not exceed one year")
+		ctx.JSON(http.StatusBadRequest, errorRespones(err))
+		return
+	}
+
+	account, ok := server.getOwnedAccount(ctx, uri.ID)
+	if !ok {
+		return
+	}
+
+	statement, err := server.store.AccountStatementTx(ctx, db.AccountStatementParams{
+		AccountID: account.ID,
+		From:      req.From,
+		To:        req.To,
+	})
+	if err != nil {
+		ctx.JSON(apiutil.Status(err), errorRespones(err))
+		return
+	}
+	ctx.JSON(http.StatusOK, newStatementResponse(statement))
+}
@@ -0,0 +1,314 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/leilei3167/bank/apiutil"
+	mockdb "github.com/leilei3167/bank/db/mock"
+	db "github.com/leilei3167/bank/db/sqlc"
+	"github.com/leilei3167/bank/db/util"
+	"github.com/stretchr/testify/require"
+)
+
+func TestListEntriesAPI(t *testing.T) {
+	account := randomAccount()
+	from := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2022, 2, 1, 0, 0, 0, 0, time.UTC)
+	entries := []db.EntryWithBalance{
+		{Entry: db.Entry{ID: 1, AccountID: account.ID, Amount: 100}, BalanceAfter: 100},
+		{Entry: db.Entry{ID: 2, AccountID: account.ID, Amount: -30}, BalanceAfter: 70},
+	}
+
+	testCases := []struct {
+		name          string
+		query         url.Values
+		username      string
+		buildStubs    func(store *mockdb.MockStore)
+		checkResponse func(recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name: "OK",
+			query: url.Values{
+				"from":      {from.Format(time.RFC3339)},
+				"to":        {to.Format(time.RFC3339)},
+				"page_id":   {"2"},
+				"page_size": {"5"},
+			},
+			username: account.Owner,
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(account.ID)).Times(1).Return(account, nil)
+				arg := db.ListEntriesWithBalanceParams{
+					AccountID: account.ID,
+					From:      from,
+					To:        to,
+					Limit:     5,
+					Offset:    5,
+				}
+				store.EXPECT().ListEntriesWithBalance(gomock.Any(), gomock.Eq(arg)).Times(1).Return(entries, nil)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+
+				var got []entryWithBalanceResponse
+				err := json.Unmarshal(recorder.Body.Bytes(), &got)
+				require.NoError(t, err)
+				require.Len(t, got, 2)
+				require.Equal(t, int64(70), got[1].BalanceAfter)
+				require.Equal(t, "0.70", got[1].BalanceAfterDecimal)
+				require.Equal(t, "-0.30", got[1].AmountDecimal)
+			},
+		},
+		{
+			name: "DefaultRange",
+			query: url.Values{
+				"page_id":   {"1"},
+				"page_size": {"5"},
+			},
+			username: account.Owner,
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(account.ID)).Times(1).Return(account, nil)
+				store.EXPECT().
+					ListEntriesWithBalance(gomock.Any(), gomock.Any()).
+					Times(1).
+					DoAndReturn(func(_ interface{}, arg db.ListEntriesWithBalanceParams) ([]db.EntryWithBalance, error) {
+						require.True(t, arg.From.IsZero())
+						require.WithinDuration(t, time.Now(), arg.To, time.Second)
+						return []db.EntryWithBalance{}, nil
+					})
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+			},
+		},
+		{
+			name: "Cursor",
+			query: url.Values{
+				"after": {apiutil.EncodePageCursor(10)},
+				"limit": {"1"},
+			},
+			username: account.Owner,
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(account.ID)).Times(1).Return(account, nil)
+				store.EXPECT().
+					ListEntriesWithBalance(gomock.Any(), gomock.Any()).
+					Times(1).
+					DoAndReturn(func(_ interface{}, arg db.ListEntriesWithBalanceParams) ([]db.EntryWithBalance, error) {
+						require.Equal(t, int64(10), arg.AfterID)
+						require.Equal(t, int32(2), arg.Limit)
+						require.Zero(t, arg.Offset)
+						return entries, nil
+					})
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+
+				var got struct {
+					Items      []entryWithBalanceResponse `json:"items"`
+					NextCursor string                     `json:"next_cursor"`
+				}
+				err := json.Unmarshal(recorder.Body.Bytes(), &got)
+				require.NoError(t, err)
+				require.Len(t, got.Items, 1)
+				require.Equal(t, apiutil.EncodePageCursor(entries[0].ID), got.NextCursor)
+			},
+		},
+		{
+			name: "UnauthorizedUser",
+			query: url.Values{
+				"page_id":   {"1"},
+				"page_size": {"5"},
+			},
+			username: "unauthorized",
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(account.ID)).Times(1).Return(account, nil)
+				store.EXPECT().ListEntriesWithBalance(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusForbidden, recorder.Code)
+			},
+		},
+		{
+			name: "InvalidRange",
+			query: url.Values{
+				"from":      {to.Format(time.RFC3339)},
+				"to":        {from.Format(time.RFC3339)},
+				"page_id":   {"1"},
+				"page_size": {"5"},
+			},
+			username: account.Owner,
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Any()).Times(0)
+				store.EXPECT().ListEntriesWithBalance(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			store := mockdb.NewMockStore(ctrl)
+			tc.buildStubs(store)
+			stubActiveSession(store)
+
+			server := newTestServer(t, store)
+			recorder := httptest.NewRecorder()
+
+			url := fmt.Sprintf("/accounts/%d/entries?%s", account.ID, tc.query.Encode())
+			request, err := http.NewRequest(http.MethodGet, url, nil)
+			require.NoError(t, err)
+
+			addAuthorization(t, request, server.tokenMaker, authorizationTypeBearer, tc.username, util.DepositorRole, time.Minute)
+			server.router.ServeHTTP(recorder, request)
+			tc.checkResponse(recorder)
+		})
+	}
+}
+
+func TestGetStatementAPI(t *testing.T) {
+	account := randomAccount()
+	from := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2022, 2, 1, 0, 0, 0, 0, time.UTC)
+	statement := db.AccountStatement{
+		Account:        account,
+		From:           from,
+		To:             to,
+		OpeningBalance: 50,
+		ClosingBalance: 120,
+		TotalIn:        100,
+		TotalOut:       30,
+		Entries: []db.EntryWithBalance{
+			{Entry: db.Entry{ID: 1, AccountID: account.ID, Amount: 100}, BalanceAfter: 150},
+			{Entry: db.Entry{ID: 2, AccountID: account.ID, Amount: -30}, BalanceAfter: 120},
+		},
+	}
+
+	testCases := []struct {
+		name          string
+		query         url.Values
+		username      string
+		buildStubs    func(store *mockdb.MockStore)
+		checkResponse func(recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name: "OK",
+			query: url.Values{
+				"from": {from.Format(time.RFC3339)},
+				"to":   {to.Format(time.RFC3339)},
+			},
+			username: account.Owner,
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(account.ID)).Times(1).Return(account, nil)
+				arg := db.AccountStatementParams{AccountID: account.ID, From: from, To: to}
+				store.EXPECT().AccountStatementTx(gomock.Any(), gomock.Eq(arg)).Times(1).Return(statement, nil)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+
+				var got statementResponse
+				err := json.Unmarshal(recorder.Body.Bytes(), &got)
+				require.NoError(t, err)
+				require.Equal(t, int64(50), got.OpeningBalance)
+				require.Equal(t, "0.50", got.OpeningBalanceDecimal)
+				require.Equal(t, "1.20", got.ClosingBalanceDecimal)
+				require.Equal(t, "1.00", got.TotalInDecimal)
+				require.Equal(t, "0.30", got.TotalOutDecimal)
+				require.Len(t, got.Entries, 2)
+			},
+		},
+		{
+			name: "MissingRange",
+			query: url.Values{
+				"from": {from.Format(time.RFC3339)},
+			},
+			username: account.Owner,
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().AccountStatementTx(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+		{
+			name: "PeriodTooLong",
+			query: url.Values{
+				"from": {from.Format(time.RFC3339)},
+				"to":   {from.AddDate(2, 0, 0).Format(time.RFC3339)},
+			},
+			username: account.Owner,
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().AccountStatementTx(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+		{
+			name: "TooManyEntries",
+			query: url.Values{
+				"from": {from.Format(time.RFC3339)},
+				"to":   {to.Format(time.RFC3339)},
+			},
+			username: account.Owner,
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(account.ID)).Times(1).Return(account, nil)
+				store.EXPECT().AccountStatementTx(gomock.Any(), gomock.Any()).Times(1).Return(db.AccountStatement{}, db.ErrStatementTooLarge)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+		{
+			name: "UnauthorizedUser",
+			query: url.Values{
+				"from": {from.Format(time.RFC3339)},
+				"to":   {to.Format(time.RFC3339)},
+			},
+			username: "unauthorized",
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(account.ID)).Times(1).Return(account, nil)
+				store.EXPECT().AccountStatementTx(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusForbidden, recorder.Code)
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			store := mockdb.NewMockStore(ctrl)
+			tc.buildStubs(store)
+			stubActiveSession(store)
+
+			server := newTestServer(t, store)
+			recorder := httptest.NewRecorder()
+
+			url := fmt.Sprintf("/accounts/%d/statement?%s", account.ID, tc.query.Encode())
+			request, err := http.NewRequest(http.MethodGet, url, nil)
+			require.NoError(t, err)
+
+			addAuthorization(t, request, server.tokenMaker, authorizationTypeBearer, tc.username, util.DepositorRole, time.Minute)
+			server.router.ServeHTTP(recorder, request)
+			tc.checkResponse(recorder)
+		})
+	}
+}
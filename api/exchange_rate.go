@@ -0,0 +1,76 @@
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	db "github.com/leilei3167/bank/db/sqlc"
+	"github.com/leilei3167/bank/db/util"
+)
+
+//录入一条汇率,rate表示1单位base货币可以兑换多少quote货币
+//effective_from为空时立即生效,也可以提前录入之后才生效的汇率
+type createExchangeRateRequest struct {
+	BaseCurrency  string     `json:"base_currency" binding:"required,currency"`
+	QuoteCurrency string     `json:"quote_currency" binding:"required,currency,nefield=BaseCurrency"`
+	Rate          string     `json:"rate" binding:"required"` //十进制字符串,避免浮点数的精度问题
+	EffectiveFrom *time.Time `json:"effective_from"`
+}
+
+func (server *Server) adminCreateExchangeRate(ctx *gin.Context) {
+	var req createExchangeRateRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorRespones(err))
+		return
+	}
+	if _, err := util.ParseExchangeRate(req.Rate); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorRespones(err))
+		return
+	}
+
+	effectiveFrom := time.Now()
+	if req.EffectiveFrom != nil {
+		effectiveFrom = *req.EffectiveFrom
+	}
+
+	rate, err := server.store.CreateExchangeRate(ctx, db.CreateExchangeRateParams{
+		BaseCurrency:  req.BaseCurrency,
+		QuoteCurrency: req.QuoteCurrency,
+		Rate:          req.Rate,
+		EffectiveFrom: effectiveFrom,
+	})
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorRespones(err))
+		return
+	}
+	ctx.JSON(http.StatusOK, rate)
+}
+
+//按生效时间倒序列出某个货币对的汇率历史
+type listExchangeRatesRequest struct {
+	BaseCurrency  string `form:"base_currency" binding:"required,currency"`
+	QuoteCurrency string `form:"quote_currency" binding:"required,currency"`
+	PageID        int32  `form:"page_id" binding:"required,min=1"`
+	PageSize      int32  `form:"page_size" binding:"required,min=5,max=10"`
+}
+
+func (server *Server) adminListExchangeRates(ctx *gin.Context) {
+	var req listExchangeRatesRequest
+	if err := ctx.ShouldBindQuery(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorRespones(err))
+		return
+	}
+
+	rates, err := server.store.ListExchangeRates(ctx, db.ListExchangeRatesParams{
+		BaseCurrency:  req.BaseCurrency,
+		QuoteCurrency: req.QuoteCurrency,
+		Limit:         req.PageSize,
+		Offset:        (req.PageID - 1) * req.PageSize,
+	})
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorRespones(err))
+		return
+	}
+	ctx.JSON(http.StatusOK, rates)
+}
@@ -0,0 +1,241 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang/mock/gomock"
+	mockdb "github.com/leilei3167/bank/db/mock"
+	db "github.com/leilei3167/bank/db/sqlc"
+	"github.com/leilei3167/bank/db/util"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCreateExchangeRateAPI(t *testing.T) {
+	effectiveFrom := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+	rate := db.ExchangeRate{
+		ID:            util.RandomInt(1, 1000),
+		BaseCurrency:  util.USD,
+		QuoteCurrency: util.RMB,
+		Rate:          "7.1234",
+		EffectiveFrom: effectiveFrom,
+	}
+
+	testCases := []struct {
+		name          string
+		body          gin.H
+		role          string
+		buildStubs    func(store *mockdb.MockStore)
+		checkResponse func(recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name: "OK",
+			body: gin.H{
+				"base_currency":  util.USD,
+				"quote_currency": util.RMB,
+				"rate":           "7.1234",
+				"effective_from": effectiveFrom,
+			},
+			role: util.BankerRole,
+			buildStubs: func(store *mockdb.MockStore) {
+				arg := db.CreateExchangeRateParams{
+					BaseCurrency:  util.USD,
+					QuoteCurrency: util.RMB,
+					Rate:          "7.1234",
+					EffectiveFrom: effectiveFrom,
+				}
+				store.EXPECT().CreateExchangeRate(gomock.Any(), gomock.Eq(arg)).Times(1).Return(rate, nil)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+
+				var got db.ExchangeRate
+				err := json.Unmarshal(recorder.Body.Bytes(), &got)
+				require.NoError(t, err)
+				require.Equal(t, rate.ID, got.ID)
+				require.Equal(t, rate.Rate, got.Rate)
+			},
+		},
+		{
+			name: "DefaultEffectiveFrom",
+			body: gin.H{
+				"base_currency":  util.USD,
+				"quote_currency": util.RMB,
+				"rate":           "7.1234",
+			},
+			role: util.BankerRole,
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().
+					CreateExchangeRate(gomock.Any(), gomock.Any()).
+					Times(1).
+					DoAndReturn(func(_ interface{}, arg db.CreateExchangeRateParams) (db.ExchangeRate, error) {
+						require.WithinDuration(t, time.Now(), arg.EffectiveFrom, time.Second)
+						return rate, nil
+					})
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+			},
+		},
+		{
+			name: "InvalidRate",
+			body: gin.H{
+				"base_currency":  util.USD,
+				"quote_currency": util.RMB,
+				"rate":           "-7.1",
+			},
+			role: util.BankerRole,
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().CreateExchangeRate(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+		{
+			name: "RateTooLarge",
+			body: gin.H{
+				"base_currency":  util.USD,
+				"quote_currency": util.RMB,
+				"rate":           "12345678901",
+			},
+			role: util.BankerRole,
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().CreateExchangeRate(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+		{
+			name: "SameCurrency",
+			body: gin.H{
+				"base_currency":  util.USD,
+				"quote_currency": util.USD,
+				"rate":           "1",
+			},
+			role: util.BankerRole,
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().CreateExchangeRate(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+		{
+			name: "Forbidden",
+			body: gin.H{
+				"base_currency":  util.USD,
+				"quote_currency": util.RMB,
+				"rate":           "7.1234",
+			},
+			role: util.DepositorRole,
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().CreateExchangeRate(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusForbidden, recorder.Code)
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			store := mockdb.NewMockStore(ctrl)
+			tc.buildStubs(store)
+			stubActiveSession(store)
+
+			server := newTestServer(t, store)
+			recorder := httptest.NewRecorder()
+
+			data, err := json.Marshal(tc.body)
+			require.NoError(t, err)
+
+			request, err := http.NewRequest(http.MethodPost, "/admin/exchange_rates", bytes.NewReader(data))
+			require.NoError(t, err)
+
+			addAuthorization(t, request, server.tokenMaker, authorizationTypeBearer, "staff", tc.role, time.Minute)
+			server.router.ServeHTTP(recorder, request)
+			tc.checkResponse(recorder)
+		})
+	}
+}
+
+func TestListExchangeRatesAPI(t *testing.T) {
+	rates := []db.ExchangeRate{
+		{ID: 2, BaseCurrency: util.USD, QuoteCurrency: util.EUR, Rate: "0.92"},
+		{ID: 1, BaseCurrency: util.USD, QuoteCurrency: util.EUR, Rate: "0.91"},
+	}
+
+	testCases := []struct {
+		name          string
+		query         string
+		buildStubs    func(store *mockdb.MockStore)
+		checkResponse func(recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name:  "OK",
+			query: "base_currency=USD&quote_currency=EUR&page_id=1&page_size=5",
+			buildStubs: func(store *mockdb.MockStore) {
+				arg := db.ListExchangeRatesParams{
+					BaseCurrency:  util.USD,
+					QuoteCurrency: util.EUR,
+					Limit:         5,
+					Offset:        0,
+				}
+				store.EXPECT().ListExchangeRates(gomock.Any(), gomock.Eq(arg)).Times(1).Return(rates, nil)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+
+				var got []db.ExchangeRate
+				err := json.Unmarshal(recorder.Body.Bytes(), &got)
+				require.NoError(t, err)
+				require.Equal(t, rates, got)
+			},
+		},
+		{
+			name:  "UnsupportedCurrency",
+			query: "base_currency=XXX&quote_currency=EUR&page_id=1&page_size=5",
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().ListExchangeRates(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			store := mockdb.NewMockStore(ctrl)
+			tc.buildStubs(store)
+			stubActiveSession(store)
+
+			server := newTestServer(t, store)
+			recorder := httptest.NewRecorder()
+
+			request, err := http.NewRequest(http.MethodGet, "/admin/exchange_rates?"+tc.query, nil)
+			require.NoError(t, err)
+
+			addAuthorization(t, request, server.tokenMaker, authorizationTypeBearer, "staff", util.BankerRole, time.Minute)
+			server.router.ServeHTTP(recorder, request)
+			tc.checkResponse(recorder)
+		})
+	}
+}
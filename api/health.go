@@ -0,0 +1,122 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	db "github.com/leilei3167/bank/db/sqlc"
+	"github.com/leilei3167/bank/db/util"
+	"github.com/leilei3167/bank/worker"
+)
+
+//配置中没有设置时,就绪检查访问数据库的超时
+const defaultHealthCheckTimeout = 2 * time.Second
+
+const (
+	checkOK   = "ok"
+	checkFail = "fail"
+)
+
+var errShuttingDown = errors.New("server is shutting down")
+
+//单项检查的结果,Detail为检查的附加信息,如迁移版本和后台任务的状态
+type checkResult struct {
+	Status  string      `json:"status"`
+	Error   string      `json:"error,omitempty"`
+	Latency string      `json:"latency,omitempty"`
+	Detail  interface{} `json:"detail,omitempty"`
+}
+
+type readinessResponse struct {
+	Status string                 `json:"status"`
+	Checks map[string]checkResult `json:"checks"`
+}
+
+//设置需要报告的后台任务,不设置时不检查
+func (server *Server) SetWorkers(workers *worker.Group) {
+	server.workers = workers
+}
+
+//存活检查,进程能处理请求就返回200,不检查依赖,避免数据库故障时进程被反复重启
+func (server *Server) healthz(ctx *gin.Context) {
+	ctx.JSON(http.StatusOK, gin.H{"status": checkOK})
+}
+
+//就绪检查,任何一项失败都返回503,让负载均衡不再转发请求
+//开始优雅关闭后立即失败,正在处理的请求仍然会完成
+func (server *Server) readyz(ctx *gin.Context) {
+	checkCtx, cancel := context.WithTimeout(ctx.Request.Context(), util.DurationOrDefault(server.config.HealthCheckTimeout, defaultHealthCheckTimeout))
+	defer cancel()
+
+	checks := map[string]checkResult{
+		"shutdown":  server.checkShutdown(),
+		"database":  server.checkDatabase(checkCtx),
+		"migration": server.checkMigration(checkCtx),
+	}
+	if server.workers != nil {
+		checks["workers"] = server.checkWorkers()
+	}
+
+	rsp := readinessResponse{Status: checkOK, Checks: checks}
+	status := http.StatusOK
+	for _, check := range checks {
+		if check.Status != checkOK {
+			rsp.Status = checkFail
+			status = http.StatusServiceUnavailable
+		}
+	}
+	ctx.JSON(status, rsp)
+}
+
+func checkError(result checkResult, err error) checkResult {
+	if err != nil {
+		result.Status = checkFail
+		result.Error = err.Error()
+	}
+	return result
+}
+
+func (server *Server) checkShutdown() checkResult {
+	var err error
+	if atomic.LoadInt32(&server.shuttingDown) == 1 {
+		err = errShuttingDown
+	}
+	return checkError(checkResult{Status: checkOK}, err)
+}
+
+func (server *Server) checkDatabase(ctx context.Context) checkResult {
+	start := time.Now()
+	err := server.store.Ping(ctx)
+	return checkError(checkResult{Status: checkOK, Latency: time.Since(start).String()}, err)
+}
+
+//数据库的迁移版本必须和代码依赖的版本一致,否则查询可能会失败
+func (server *Server) checkMigration(ctx context.Context) checkResult {
+	version, err := server.store.GetMigrationVersion(ctx)
+	if err == nil {
+		err = version.Check()
+	}
+	return checkError(checkResult{Status: checkOK, Detail: gin.H{
+		"version":  version.Version,
+		"dirty":    version.Dirty,
+		"expected": db.ExpectedMigrationVersion,
+	}}, err)
+}
+
+//后台任务只有在关闭时才会返回,提前返回说明任务出了问题
+func (server *Server) checkWorkers() checkResult {
+	statuses := server.workers.Status()
+	var err error
+	for _, status := range statuses {
+		if !status.Running {
+			err = fmt.Errorf("worker %s has stopped", status.Name)
+			break
+		}
+	}
+	return checkError(checkResult{Status: checkOK, Detail: statuses}, err)
+}
@@ -0,0 +1,159 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	mockdb "github.com/leilei3167/bank/db/mock"
+	db "github.com/leilei3167/bank/db/sqlc"
+	"github.com/leilei3167/bank/worker"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHealthzAPI(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	//存活检查不访问数据库
+	server := newTestServer(t, mockdb.NewMockStore(ctrl))
+	recorder := httptest.NewRecorder()
+	request, err := http.NewRequest(http.MethodGet, "/healthz", nil)
+	require.NoError(t, err)
+	server.router.ServeHTTP(recorder, request)
+	require.Equal(t, http.StatusOK, recorder.Code)
+}
+
+func TestReadyzAPI(t *testing.T) {
+	current := db.MigrationVersion{Version: db.ExpectedMigrationVersion}
+
+	testCases := []struct {
+		name          string
+		buildStubs    func(store *mockdb.MockStore)
+		setup         func(server *Server)
+		checkResponse func(recorder *httptest.ResponseRecorder, rsp readinessResponse)
+	}{
+		{
+			name: "OK",
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().Ping(gomock.Any()).Times(1).Return(nil)
+				store.EXPECT().GetMigrationVersion(gomock.Any()).Times(1).Return(current, nil)
+			},
+			setup: func(server *Server) {},
+			checkResponse: func(recorder *httptest.ResponseRecorder, rsp readinessResponse) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+				require.Equal(t, checkOK, rsp.Status)
+				require.Len(t, rsp.Checks, 3)
+				for _, check := range rsp.Checks {
+					require.Equal(t, checkOK, check.Status)
+				}
+			},
+		},
+		{
+			name: "DatabaseDown",
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().Ping(gomock.Any()).Times(1).Return(sql.ErrConnDone)
+				store.EXPECT().GetMigrationVersion(gomock.Any()).Times(1).Return(db.MigrationVersion{}, sql.ErrConnDone)
+			},
+			setup: func(server *Server) {},
+			checkResponse: func(recorder *httptest.ResponseRecorder, rsp readinessResponse) {
+				require.Equal(t, http.StatusServiceUnavailable, recorder.Code)
+				require.Equal(t, checkFail, rsp.Status)
+				require.Equal(t, checkFail, rsp.Checks["database"].Status)
+				require.Equal(t, sql.ErrConnDone.Error(), rsp.Checks["database"].Error)
+				require.Equal(t, checkOK, rsp.Checks["shutdown"].Status)
+			},
+		},
+		{
+			name: "MigrationMismatch",
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().Ping(gomock.Any()).Times(1).Return(nil)
+				store.EXPECT().GetMigrationVersion(gomock.Any()).Times(1).
+					Return(db.MigrationVersion{Version: db.ExpectedMigrationVersion - 1}, nil)
+			},
+			setup: func(server *Server) {},
+			checkResponse: func(recorder *httptest.ResponseRecorder, rsp readinessResponse) {
+				require.Equal(t, http.StatusServiceUnavailable, recorder.Code)
+				require.Equal(t, checkOK, rsp.Checks["database"].Status)
+				require.Equal(t, checkFail, rsp.Checks["migration"].Status)
+				require.Contains(t, rsp.Checks["migration"].Error, db.ErrMigrationMismatch.Error())
+			},
+		},
+		{
+			name: "MigrationDirty",
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().Ping(gomock.Any()).Times(1).Return(nil)
+				store.EXPECT().GetMigrationVersion(gomock.Any()).Times(1).
+					Return(db.MigrationVersion{Version: db.ExpectedMigrationVersion, Dirty: true}, nil)
+			},
+			setup: func(server *Server) {},
+			checkResponse: func(recorder *httptest.ResponseRecorder, rsp readinessResponse) {
+				require.Equal(t, http.StatusServiceUnavailable, recorder.Code)
+				require.Contains(t, rsp.Checks["migration"].Error, db.ErrMigrationDirty.Error())
+			},
+		},
+		{
+			name: "WorkerStopped",
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().Ping(gomock.Any()).Times(1).Return(nil)
+				store.EXPECT().GetMigrationVersion(gomock.Any()).Times(1).Return(current, nil)
+			},
+			setup: func(server *Server) {
+				workers := worker.NewGroup()
+				exited := make(chan struct{})
+				workers.Go("scheduler", func(ctx context.Context) { close(exited) })
+				<-exited
+				workers.Stop(context.Background())
+				server.SetWorkers(workers)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder, rsp readinessResponse) {
+				require.Equal(t, http.StatusServiceUnavailable, recorder.Code)
+				require.Equal(t, checkFail, rsp.Checks["workers"].Status)
+				require.Contains(t, rsp.Checks["workers"].Error, "scheduler")
+			},
+		},
+		{
+			name: "ShuttingDown",
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().Ping(gomock.Any()).Times(1).Return(nil)
+				store.EXPECT().GetMigrationVersion(gomock.Any()).Times(1).Return(current, nil)
+			},
+			setup: func(server *Server) {
+				require.NoError(t, server.Shutdown(context.Background()))
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder, rsp readinessResponse) {
+				require.Equal(t, http.StatusServiceUnavailable, recorder.Code)
+				require.Equal(t, checkFail, rsp.Checks["shutdown"].Status)
+				require.Equal(t, checkOK, rsp.Checks["database"].Status)
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			store := mockdb.NewMockStore(ctrl)
+			tc.buildStubs(store)
+
+			server := newTestServer(t, store)
+			tc.setup(server)
+
+			recorder := httptest.NewRecorder()
+			request, err := http.NewRequest(http.MethodGet, "/readyz", nil)
+			require.NoError(t, err)
+			server.router.ServeHTTP(recorder, request)
+
+			var rsp readinessResponse
+			require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &rsp))
+			tc.checkResponse(recorder, rsp)
+		})
+	}
+}
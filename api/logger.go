@@ -0,0 +1,97 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/leilei3167/bank/logger"
+	"github.com/rs/zerolog"
+)
+
+const (
+	requestIDHeader    = "X-Request-ID"
+	maxRequestIDLength = 64
+	maxLoggedErrorBody = 1024 //错误响应最多记录的字节数
+)
+
+//为每个请求生成请求ID,并在请求结束后记录一行访问日志
+//请求ID写入gin的Keys和请求的context,store的日志通过它和请求对应起来,同时通过响应头返回给客户端
+//客户端传入的X-Request-ID会被沿用,方便跨服务追踪
+func requestLogger() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		start := time.Now()
+
+		requestID := ctx.GetHeader(requestIDHeader)
+		if requestID == "" || len(requestID) > maxRequestIDLength {
+			requestID = uuid.NewString()
+		}
+		ctx.Set(logger.RequestIDKey, requestID)
+		ctx.Request = ctx.Request.WithContext(logger.WithRequestID(ctx.Request.Context(), requestID))
+		ctx.Header(requestIDHeader, requestID)
+
+		//错误响应的内容也记录下来,这样每个返回给客户端的错误都能在日志中找到
+		writer := &errorBodyWriter{ResponseWriter: ctx.Writer}
+		ctx.Writer = writer
+
+		ctx.Next()
+
+		status := ctx.Writer.Status()
+		var event *zerolog.Event
+		switch {
+		case status >= 500:
+			event = logger.Ctx(ctx).Error()
+		case status >= 400:
+			event = logger.Ctx(ctx).Warn()
+		default:
+			event = logger.Ctx(ctx).Info()
+		}
+		event = event.
+			Str("method", ctx.Request.Method).
+			Str("path", ctx.Request.URL.Path).
+			Str("route", ctx.FullPath()).
+			Int("status", status).
+			Dur("latency", time.Since(start)).
+			Str("client_ip", ctx.ClientIP())
+		if msg := writer.errorMessage(); msg != "" {
+			event = event.Str("error", msg)
+		}
+		event.Msg("处理请求")
+	}
+}
+
+//只在状态码>=400时缓存响应体,正常响应不受影响
+type errorBodyWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *errorBodyWriter) Write(data []byte) (int, error) {
+	if w.Status() >= 400 && w.body.Len() < maxLoggedErrorBody {
+		w.body.Write(data)
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *errorBodyWriter) WriteString(s string) (int, error) {
+	if w.Status() >= 400 && w.body.Len() < maxLoggedErrorBody {
+		w.body.WriteString(s)
+	}
+	return w.ResponseWriter.WriteString(s)
+}
+
+//错误响应的格式见errorRespones,解析不了时记录原始内容
+func (w *errorBodyWriter) errorMessage() string {
+	if w.body.Len() == 0 {
+		return ""
+	}
+	var resp struct {
+		Error string `json:"error"`
+	}
+	if err := json.Unmarshal(w.body.Bytes(), &resp); err == nil && resp.Error != "" {
+		return resp.Error
+	}
+	return w.body.String()
+}
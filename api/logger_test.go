@@ -0,0 +1,91 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/leilei3167/bank/apiutil"
+	"github.com/leilei3167/bank/logger"
+	"github.com/rs/zerolog/log"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequestLogger(t *testing.T) {
+	var buf bytes.Buffer
+	global := log.Logger
+	defer func() { log.Logger = global }()
+	log.Logger, _ = logger.New(&buf, logger.FormatJSON, "debug")
+
+	//处理器把*gin.Context当作context.Context传给下层时也能取到请求ID
+	var seen string
+	router := gin.New()
+	router.Use(requestLogger())
+	router.GET("/accounts/:id", func(ctx *gin.Context) {
+		seen = logger.RequestID(ctx)
+		ctx.JSON(http.StatusNotFound, errorRespones(apiutil.ErrInvalidCursor))
+	})
+
+	testCases := []struct {
+		name      string
+		requestID string
+		check     func(recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name: "Generated",
+			check: func(recorder *httptest.ResponseRecorder) {
+				require.NotEmpty(t, recorder.Header().Get(requestIDHeader))
+			},
+		},
+		{
+			name:      "FromHeader",
+			requestID: "upstream-id",
+			check: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, "upstream-id", recorder.Header().Get(requestIDHeader))
+			},
+		},
+		{
+			name:      "HeaderTooLong",
+			requestID: strings.Repeat("a", maxRequestIDLength+1),
+			check: func(recorder *httptest.ResponseRecorder) {
+				require.Len(t, recorder.Header().Get(requestIDHeader), 36)
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			buf.Reset()
+			recorder := httptest.NewRecorder()
+			request, err := http.NewRequest(http.MethodGet, "/accounts/1", nil)
+			require.NoError(t, err)
+			if tc.requestID != "" {
+				request.Header.Set(requestIDHeader, tc.requestID)
+			}
+
+			router.ServeHTTP(recorder, request)
+			require.Equal(t, http.StatusNotFound, recorder.Code)
+			tc.check(recorder)
+
+			requestID := recorder.Header().Get(requestIDHeader)
+			require.Equal(t, requestID, seen)
+
+			var line map[string]interface{}
+			require.NoError(t, json.Unmarshal(buf.Bytes(), &line))
+			require.Equal(t, requestID, line[logger.RequestIDKey])
+			require.Equal(t, http.MethodGet, line["method"])
+			require.Equal(t, "/accounts/1", line["path"])
+			require.Equal(t, "/accounts/:id", line["route"])
+			require.EqualValues(t, http.StatusNotFound, line["status"])
+			require.Equal(t, "warn", line["level"])
+			require.Equal(t, apiutil.ErrInvalidCursor.Error(), line["error"])
+			require.Contains(t, line, "latency")
+		})
+	}
+}
@@ -2,10 +2,27 @@ package api
 
 import (
 	"github.com/gin-gonic/gin"
+	db "github.com/leilei3167/bank/db/sqlc"
+	"github.com/leilei3167/bank/db/util"
+	"github.com/stretchr/testify/require"
 	"os"
 	"testing"
+	"time"
 )
 
+//测试用的Server,使用随机的密钥
+func newTestServer(t *testing.T, store db.Store) *Server {
+	config := util.Config{
+		TokenSymmetricKey:   util.RandomString(32),
+		AccessTokenDuration: time.Minute,
+	}
+
+	server, err := NewServer(config, store)
+	require.NoError(t, err)
+
+	return server
+}
+
 func TestMain(m *testing.M) {
 
 	gin.SetMode(gin.TestMode)
@@ -0,0 +1,17 @@
+package api
+
+import (
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/leilei3167/bank/metrics"
+)
+
+//按路由模板和状态码统计请求的耗时,使用模板而不是实际的路径,避免账户id等参数让标签无限增长
+func requestMetrics() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		start := time.Now()
+		ctx.Next()
+		metrics.ObserveHTTPRequest(ctx.Request.Method, ctx.FullPath(), ctx.Writer.Status(), time.Since(start))
+	}
+}
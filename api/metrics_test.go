@@ -0,0 +1,41 @@
+package api
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/leilei3167/bank/metrics"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequestMetrics(t *testing.T) {
+	server := newTestServer(t, nil)
+
+	//没有携带token的请求在鉴权中间件就返回,同样会被统计
+	for _, url := range []string{"/accounts/1", "/no-such-route"} {
+		recorder := httptest.NewRecorder()
+		request, err := http.NewRequest(http.MethodGet, url, nil)
+		require.NoError(t, err)
+		server.router.ServeHTTP(recorder, request)
+	}
+
+	//指标只在内部端口上提供,面向客户的端口上不存在
+	recorder := httptest.NewRecorder()
+	request, err := http.NewRequest(http.MethodGet, "/metrics", nil)
+	require.NoError(t, err)
+	server.router.ServeHTTP(recorder, request)
+	require.Equal(t, http.StatusNotFound, recorder.Code)
+
+	recorder = httptest.NewRecorder()
+	metrics.NewServer("").Handler.ServeHTTP(recorder, request)
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	body, err := io.ReadAll(recorder.Body)
+	require.NoError(t, err)
+	//标签使用路由模板而不是实际的路径
+	require.Contains(t, string(body), `bank_http_request_duration_seconds_count{method="GET",route="/accounts/:id",status="401"}`)
+	require.Contains(t, string(body), `bank_http_request_duration_seconds_count{method="GET",route="unmatched",status="404"}`)
+	require.NotContains(t, string(body), `route="/accounts/1"`)
+}
@@ -0,0 +1,90 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	db "github.com/leilei3167/bank/db/sqlc"
+	"github.com/leilei3167/bank/token"
+)
+
+const (
+	authorizationHeaderKey  = "authorization"
+	authorizationTypeBearer = "bearer"
+	authorizationPayloadKey = "authorization_payload" //验证通过后负载在gin context中的key
+)
+
+//鉴权中间件,验证请求头中的token及其所属会话,通过后将负载放入context供后续处理器使用
+func authMiddleware(tokenMaker token.Maker, store db.Store) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		authorizationHeader := ctx.GetHeader(authorizationHeaderKey)
+		if len(authorizationHeader) == 0 {
+			err := errors.New("authorization header is not provided")
+			ctx.AbortWithStatusJSON(http.StatusUnauthorized, errorRespones(err))
+			return
+		}
+
+		//格式应该为: Bearer <token>
+		fields := strings.Fields(authorizationHeader)
+		if len(fields) < 2 {
+			err := errors.New("invalid authorization header format")
+			ctx.AbortWithStatusJSON(http.StatusUnauthorized, errorRespones(err))
+			return
+		}
+
+		authorizationType := strings.ToLower(fields[0])
+		if authorizationType != authorizationTypeBearer {
+			err := fmt.Errorf("unsupported authorization type %s", authorizationType)
+			ctx.AbortWithStatusJSON(http.StatusUnauthorized, errorRespones(err))
+			return
+		}
+
+		accessToken := fields[1]
+		payload, err := tokenMaker.VerifyToken(accessToken, token.TokenTypeAccess)
+		if err != nil {
+			//过期或无效的token,refresh token也不能用来访问接口
+			ctx.AbortWithStatusJSON(http.StatusUnauthorized, errorRespones(err))
+			return
+		}
+
+		//会话被吊销后,即使access token还未过期也不能再使用
+		session, err := store.GetSession(ctx, payload.SessionID)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				ctx.AbortWithStatusJSON(http.StatusUnauthorized, errorRespones(err))
+				return
+			}
+			ctx.AbortWithStatusJSON(http.StatusInternalServerError, errorRespones(err))
+			return
+		}
+		if session.IsBlocked {
+			err := errors.New("blocked session")
+			ctx.AbortWithStatusJSON(http.StatusUnauthorized, errorRespones(err))
+			return
+		}
+
+		ctx.Set(authorizationPayloadKey, payload)
+		ctx.Next()
+	}
+}
+
+//角色中间件,必须放在鉴权中间件之后,只允许指定角色的用户访问
+func roleMiddleware(allowedRoles ...string) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		authPayload := ctx.MustGet(authorizationPayloadKey).(*token.Payload)
+
+		for _, role := range allowedRoles {
+			if authPayload.Role == role {
+				ctx.Next()
+				return
+			}
+		}
+
+		err := fmt.Errorf("role %s is not allowed to access this resource", authPayload.Role)
+		ctx.AbortWithStatusJSON(http.StatusForbidden, errorRespones(err))
+	}
+}
@@ -0,0 +1,32 @@
+package api
+
+import "github.com/leilei3167/bank/apiutil"
+
+//列表接口支持两种分页方式:
+//传page_id/page_size时使用原来的偏移分页,否则使用after/limit游标分页
+//游标分页按id做键集查询,翻页期间插入新数据不会导致结果错位,翻到很深的页也不会变慢
+type pageRequest struct {
+	PageID   *int32 `form:"page_id" binding:"omitempty,min=1"`
+	PageSize int32  `form:"page_size" binding:"required_with=PageID,omitempty,min=5,max=10"`
+	After    string `form:"after"`
+	Limit    int32  `form:"limit" binding:"omitempty,min=1"`
+}
+
+func (req pageRequest) isOffset() bool {
+	return req.PageID != nil
+}
+
+func (req pageRequest) offset() int32 {
+	return (*req.PageID - 1) * req.PageSize
+}
+
+//解析游标和每页条数,未指定limit时使用配置中的默认值
+func (server *Server) cursorPage(req pageRequest) (apiutil.CursorPage, error) {
+	return apiutil.NewCursorPage(req.After, req.Limit, server.config.DefaultPageLimit, server.config.MaxPageLimit)
+}
+
+//游标分页的响应,next_cursor为空表示已经是最后一页
+type cursorPageResponse struct {
+	Items      interface{} `json:"items"`
+	NextCursor string      `json:"next_cursor,omitempty"`
+}
@@ -0,0 +1,158 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/leilei3167/bank/apiutil"
+	mockdb "github.com/leilei3167/bank/db/mock"
+	db "github.com/leilei3167/bank/db/sqlc"
+	"github.com/leilei3167/bank/db/util"
+	"github.com/stretchr/testify/require"
+)
+
+type cursorAccountsResponse struct {
+	Items      []accountResponse `json:"items"`
+	NextCursor string            `json:"next_cursor"`
+}
+
+func TestListAccountsCursorAPI(t *testing.T) {
+	owner := util.RandOwner()
+	accounts := make([]db.Account, 3)
+	for i := range accounts {
+		accounts[i] = randomAccount()
+		accounts[i].ID = int64(i + 1)
+		accounts[i].Owner = owner
+	}
+
+	testCases := []struct {
+		name          string
+		query         url.Values
+		buildStubs    func(store *mockdb.MockStore)
+		checkResponse func(recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name:  "FirstPage",
+			query: url.Values{"limit": {"2"}},
+			buildStubs: func(store *mockdb.MockStore) {
+				//多查询一条用来判断是否还有下一页
+				arg := db.ListAccountsByOwnerAfterParams{Owner: owner, AfterID: 0, LimitCount: 3}
+				store.EXPECT().ListAccountsByOwnerAfter(gomock.Any(), gomock.Eq(arg)).Times(1).Return(accounts, nil)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+
+				var got cursorAccountsResponse
+				err := json.Unmarshal(recorder.Body.Bytes(), &got)
+				require.NoError(t, err)
+				require.Len(t, got.Items, 2)
+				require.Equal(t, apiutil.EncodePageCursor(accounts[1].ID), got.NextCursor)
+			},
+		},
+		{
+			name:  "LastPage",
+			query: url.Values{"after": {apiutil.EncodePageCursor(accounts[1].ID)}, "limit": {"2"}},
+			buildStubs: func(store *mockdb.MockStore) {
+				arg := db.ListAccountsByOwnerAfterParams{Owner: owner, AfterID: accounts[1].ID, LimitCount: 3}
+				store.EXPECT().ListAccountsByOwnerAfter(gomock.Any(), gomock.Eq(arg)).Times(1).Return(accounts[2:], nil)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+
+				var got cursorAccountsResponse
+				err := json.Unmarshal(recorder.Body.Bytes(), &got)
+				require.NoError(t, err)
+				require.Len(t, got.Items, 1)
+				require.Empty(t, got.NextCursor)
+			},
+		},
+		{
+			name:  "DefaultLimit",
+			query: url.Values{},
+			buildStubs: func(store *mockdb.MockStore) {
+				arg := db.ListAccountsByOwnerAfterParams{Owner: owner, AfterID: 0, LimitCount: apiutil.DefaultPageLimit + 1}
+				store.EXPECT().ListAccountsByOwnerAfter(gomock.Any(), gomock.Eq(arg)).Times(1).Return(accounts, nil)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+			},
+		},
+		{
+			name:  "LimitTooLarge",
+			query: url.Values{"limit": {"1000"}},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().ListAccountsByOwnerAfter(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+		{
+			name:  "InvalidCursor",
+			query: url.Values{"after": {"invalid"}},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().ListAccountsByOwnerAfter(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+		{
+			name:  "PageIDWithoutPageSize",
+			query: url.Values{"page_id": {"1"}},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().ListAccountsByOwner(gomock.Any(), gomock.Any()).Times(0)
+				store.EXPECT().ListAccountsByOwnerAfter(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			store := mockdb.NewMockStore(ctrl)
+			tc.buildStubs(store)
+			stubActiveSession(store)
+
+			server := newTestServer(t, store)
+			recorder := httptest.NewRecorder()
+
+			request, err := http.NewRequest(http.MethodGet, "/accounts?"+tc.query.Encode(), nil)
+			require.NoError(t, err)
+
+			addAuthorization(t, request, server.tokenMaker, authorizationTypeBearer, owner, util.DepositorRole, time.Minute)
+			server.router.ServeHTTP(recorder, request)
+			tc.checkResponse(recorder)
+		})
+	}
+}
+
+func TestCursorPageConfig(t *testing.T) {
+	server := newTestServer(t, nil)
+	server.config.DefaultPageLimit = 5
+	server.config.MaxPageLimit = 8
+
+	page, err := server.cursorPage(pageRequest{})
+	require.NoError(t, err)
+	require.Equal(t, int32(5), page.Limit)
+	require.Equal(t, int32(6), page.QueryLimit())
+
+	page, err = server.cursorPage(pageRequest{Limit: 8})
+	require.NoError(t, err)
+	require.Equal(t, int32(8), page.Limit)
+
+	_, err = server.cursorPage(pageRequest{Limit: 9})
+	require.Error(t, err)
+}
@@ -0,0 +1,258 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/leilei3167/bank/apiutil"
+	db "github.com/leilei3167/bank/db/sqlc"
+	"github.com/leilei3167/bank/token"
+)
+
+//定时转账,金额以转出账户的货币计,start_at为第一次执行的时间,必须晚于当前时间
+type createScheduledTransferRequest struct {
+	FromAccountID int64     `json:"from_account_id" binding:"required,min=1"`
+	ToAccountID   int64     `json:"to_account_id" binding:"required,min=1,nefield=FromAccountID"`
+	Amount        int64     `json:"amount" binding:"required,min=1"`
+	Currency      string    `json:"currency" binding:"required,currency"`
+	Recurrence    string    `json:"recurrence" binding:"required,oneof=once daily weekly monthly"`
+	StartAt       time.Time `json:"start_at" binding:"required"`
+}
+
+//创建时按照手动转账的规则检查双方账户,真正执行时余额不足等问题记录在执行结果中
+func (server *Server) createScheduledTransfer(ctx *gin.Context) {
+	var req createScheduledTransferRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorRespones(err))
+		return
+	}
+	if !req.StartAt.After(time.Now()) {
+		err := errors.New("start_at must be in the future")
+		ctx.JSON(http.StatusBadRequest, errorRespones(err))
+		return
+	}
+
+	fromAccount, valid := server.validAccount(ctx, req.FromAccountID)
+	if !valid {
+		return
+	}
+	authPayload := ctx.MustGet(authorizationPayloadKey).(*token.Payload)
+	if fromAccount.Owner != authPayload.Username {
+		err := errors.New("from account doesn't belong to the authenticated user")
+		ctx.JSON(http.StatusForbidden, errorRespones(err))
+		return
+	}
+	if fromAccount.Currency != req.Currency {
+		err := fmt.Errorf("account [%v] currency mismatch:[%v]->[%v]",
+			fromAccount.ID, fromAccount.Currency, req.Currency)
+		ctx.JSON(http.StatusBadRequest, errorRespones(err))
+		return
+	}
+	if _, valid := server.validAccount(ctx, req.ToAccountID); !valid {
+		return
+	}
+
+	scheduled, err := server.store.CreateScheduledTransfer(ctx, db.CreateScheduledTransferParams{
+		Owner:         authPayload.Username,
+		FromAccountID: req.FromAccountID,
+		ToAccountID:   req.ToAccountID,
+		Amount:        req.Amount,
+		Recurrence:    req.Recurrence,
+		StartsAt:      req.StartAt.UTC(),
+	})
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorRespones(err))
+		return
+	}
+	ctx.JSON(http.StatusOK, scheduled)
+}
+
+type getScheduledTransferRequest struct {
+	ID int64 `uri:"id" binding:"required,min=1"`
+}
+
+//查询定时转账并检查是否属于当前用户,返回值表示是否可以继续处理
+func (server *Server) getOwnedScheduledTransfer(ctx *gin.Context) (db.ScheduledTransfer, bool) {
+	var req getScheduledTransferRequest
+	if err := ctx.ShouldBindUri(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorRespones(err))
+		return db.ScheduledTransfer{}, false
+	}
+
+	scheduled, err := server.store.GetScheduledTransfer(ctx, req.ID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			ctx.JSON(http.StatusNotFound, errorRespones(err))
+			return scheduled, false
+		}
+		ctx.JSON(http.StatusInternalServerError, errorRespones(err))
+		return scheduled, false
+	}
+
+	authPayload := ctx.MustGet(authorizationPayloadKey).(*token.Payload)
+	if scheduled.Owner != authPayload.Username {
+		err := errors.New("scheduled transfer doesn't belong to the authenticated user")
+		ctx.JSON(http.StatusForbidden, errorRespones(err))
+		return scheduled, false
+	}
+	return scheduled, true
+}
+
+func (server *Server) getScheduledTransfer(ctx *gin.Context) {
+	scheduled, ok := server.getOwnedScheduledTransfer(ctx)
+	if !ok {
+		return
+	}
+	ctx.JSON(http.StatusOK, scheduled)
+}
+
+//列出当前用户的定时转账,只支持游标分页
+type listScheduledTransfersRequest struct {
+	After string `form:"after"`
+	Limit int32  `form:"limit" binding:"omitempty,min=1"`
+}
+
+func (server *Server) listScheduledTransfers(ctx *gin.Context) {
+	var req listScheduledTransfersRequest
+	if err := ctx.ShouldBindQuery(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorRespones(err))
+		return
+	}
+	page, err := server.cursorPage(pageRequest{After: req.After, Limit: req.Limit})
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, errorRespones(err))
+		return
+	}
+
+	authPayload := ctx.MustGet(authorizationPayloadKey).(*token.Payload)
+	scheduled, err := server.store.ListScheduledTransfersByOwner(ctx, db.ListScheduledTransfersByOwnerParams{
+		Owner:      authPayload.Username,
+		AfterID:    page.AfterID,
+		LimitCount: page.QueryLimit(),
+	})
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorRespones(err))
+		return
+	}
+
+	var nextCursor string
+	if page.HasMore(len(scheduled)) {
+		scheduled = scheduled[:page.Limit]
+		nextCursor = apiutil.EncodePageCursor(scheduled[len(scheduled)-1].ID)
+	}
+	ctx.JSON(http.StatusOK, cursorPageResponse{Items: scheduled, NextCursor: nextCursor})
+}
+
+//只修改传入的字段,修改next_run_at之后按月执行的转账以新的日期为准
+type updateScheduledTransferRequest struct {
+	Amount     *int64     `json:"amount" binding:"omitempty,min=1"`
+	Recurrence *string    `json:"recurrence" binding:"omitempty,oneof=once daily weekly monthly"`
+	NextRunAt  *time.Time `json:"next_run_at"`
+}
+
+//已经完成或取消的定时转账不能再修改
+func (server *Server) updateScheduledTransfer(ctx *gin.Context) {
+	var req updateScheduledTransferRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorRespones(err))
+		return
+	}
+	if req.Amount == nil && req.Recurrence == nil && req.NextRunAt == nil {
+		err := errors.New("nothing to update")
+		ctx.JSON(http.StatusBadRequest, errorRespones(err))
+		return
+	}
+	if req.NextRunAt != nil && !req.NextRunAt.After(time.Now()) {
+		err := errors.New("next_run_at must be in the future")
+		ctx.JSON(http.StatusBadRequest, errorRespones(err))
+		return
+	}
+
+	scheduled, ok := server.getOwnedScheduledTransfer(ctx)
+	if !ok {
+		return
+	}
+
+	arg := db.UpdateScheduledTransferParams{ID: scheduled.ID}
+	if req.Amount != nil {
+		arg.Amount = sql.NullInt64{Int64: *req.Amount, Valid: true}
+	}
+	if req.Recurrence != nil {
+		arg.Recurrence = sql.NullString{String: *req.Recurrence, Valid: true}
+	}
+	if req.NextRunAt != nil {
+		arg.NextRunAt = sql.NullTime{Time: req.NextRunAt.UTC(), Valid: true}
+	}
+	scheduled, err := server.store.UpdateScheduledTransfer(ctx, arg)
+	if err != nil {
+		//没有更新任何行说明已经不是active状态
+		if err == sql.ErrNoRows {
+			ctx.JSON(http.StatusConflict, errorRespones(errScheduledTransferInactive))
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, errorRespones(err))
+		return
+	}
+	ctx.JSON(http.StatusOK, scheduled)
+}
+
+var errScheduledTransferInactive = errors.New("scheduled transfer is no longer active")
+
+//取消之后不会再执行,执行记录仍然保留
+func (server *Server) cancelScheduledTransfer(ctx *gin.Context) {
+	scheduled, ok := server.getOwnedScheduledTransfer(ctx)
+	if !ok {
+		return
+	}
+
+	scheduled, err := server.store.CancelScheduledTransfer(ctx, scheduled.ID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			ctx.JSON(http.StatusConflict, errorRespones(errScheduledTransferInactive))
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, errorRespones(err))
+		return
+	}
+	ctx.JSON(http.StatusOK, scheduled)
+}
+
+//每次执行的结果,失败时error为原因
+func (server *Server) listScheduledTransferRuns(ctx *gin.Context) {
+	var req listScheduledTransfersRequest
+	if err := ctx.ShouldBindQuery(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorRespones(err))
+		return
+	}
+	page, err := server.cursorPage(pageRequest{After: req.After, Limit: req.Limit})
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, errorRespones(err))
+		return
+	}
+
+	scheduled, ok := server.getOwnedScheduledTransfer(ctx)
+	if !ok {
+		return
+	}
+
+	runs, err := server.store.ListScheduledTransferRuns(ctx, db.ListScheduledTransferRunsParams{
+		ScheduledTransferID: scheduled.ID,
+		AfterID:             page.AfterID,
+		LimitCount:          page.QueryLimit(),
+	})
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorRespones(err))
+		return
+	}
+
+	var nextCursor string
+	if page.HasMore(len(runs)) {
+		runs = runs[:page.Limit]
+		nextCursor = apiutil.EncodePageCursor(runs[len(runs)-1].ID)
+	}
+	ctx.JSON(http.StatusOK, cursorPageResponse{Items: runs, NextCursor: nextCursor})
+}
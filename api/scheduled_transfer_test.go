@@ -0,0 +1,332 @@
+package api
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang/mock/gomock"
+	"github.com/leilei3167/bank/apiutil"
+	mockdb "github.com/leilei3167/bank/db/mock"
+	db "github.com/leilei3167/bank/db/sqlc"
+	"github.com/leilei3167/bank/db/util"
+	"github.com/stretchr/testify/require"
+)
+
+func TestScheduledTransferAPI(t *testing.T) {
+	fromAccount := randomAccount()
+	toAccount := randomAccount()
+	toAccount.ID = fromAccount.ID + 1
+	startAt := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+	scheduled := db.ScheduledTransfer{
+		ID:            util.RandomInt(1, 1000),
+		Owner:         fromAccount.Owner,
+		FromAccountID: fromAccount.ID,
+		ToAccountID:   toAccount.ID,
+		Amount:        100,
+		Recurrence:    db.RecurrenceMonthly,
+		Status:        db.ScheduledTransferActive,
+		StartsAt:      startAt,
+		NextRunAt:     startAt,
+	}
+	createBody := gin.H{
+		"from_account_id": fromAccount.ID,
+		"to_account_id":   toAccount.ID,
+		"amount":          scheduled.Amount,
+		"currency":        fromAccount.Currency,
+		"recurrence":      scheduled.Recurrence,
+		"start_at":        startAt,
+	}
+	withBody := func(changes gin.H) gin.H {
+		body := gin.H{}
+		for k, v := range createBody {
+			body[k] = v
+		}
+		for k, v := range changes {
+			body[k] = v
+		}
+		return body
+	}
+
+	testCases := []struct {
+		name          string
+		method        string
+		path          string
+		body          gin.H
+		username      string
+		buildStubs    func(store *mockdb.MockStore)
+		checkResponse func(recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name:     "CreateOK",
+			method:   http.MethodPost,
+			path:     "/scheduled-transfers",
+			body:     createBody,
+			username: fromAccount.Owner,
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(fromAccount.ID)).Times(1).Return(fromAccount, nil)
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(toAccount.ID)).Times(1).Return(toAccount, nil)
+				arg := db.CreateScheduledTransferParams{
+					Owner:         fromAccount.Owner,
+					FromAccountID: fromAccount.ID,
+					ToAccountID:   toAccount.ID,
+					Amount:        scheduled.Amount,
+					Recurrence:    scheduled.Recurrence,
+					StartsAt:      startAt,
+				}
+				store.EXPECT().CreateScheduledTransfer(gomock.Any(), gomock.Eq(arg)).Times(1).Return(scheduled, nil)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+
+				var got db.ScheduledTransfer
+				err := json.Unmarshal(recorder.Body.Bytes(), &got)
+				require.NoError(t, err)
+				require.Equal(t, scheduled.ID, got.ID)
+				require.WithinDuration(t, startAt, got.NextRunAt, time.Second)
+			},
+		},
+		{
+			name:     "CreateInvalidRecurrence",
+			method:   http.MethodPost,
+			path:     "/scheduled-transfers",
+			body:     withBody(gin.H{"recurrence": "yearly"}),
+			username: fromAccount.Owner,
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().CreateScheduledTransfer(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+		{
+			name:     "CreateStartInPast",
+			method:   http.MethodPost,
+			path:     "/scheduled-transfers",
+			body:     withBody(gin.H{"start_at": time.Now().Add(-time.Hour)}),
+			username: fromAccount.Owner,
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Any()).Times(0)
+				store.EXPECT().CreateScheduledTransfer(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+		{
+			name:     "CreateUnauthorizedUser",
+			method:   http.MethodPost,
+			path:     "/scheduled-transfers",
+			body:     createBody,
+			username: toAccount.Owner,
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(fromAccount.ID)).Times(1).Return(fromAccount, nil)
+				store.EXPECT().CreateScheduledTransfer(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusForbidden, recorder.Code)
+			},
+		},
+		{
+			name:     "CreateCurrencyMismatch",
+			method:   http.MethodPost,
+			path:     "/scheduled-transfers",
+			body:     withBody(gin.H{"currency": otherCurrency(fromAccount.Currency)}),
+			username: fromAccount.Owner,
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(fromAccount.ID)).Times(1).Return(fromAccount, nil)
+				store.EXPECT().CreateScheduledTransfer(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+		{
+			name:     "GetOK",
+			method:   http.MethodGet,
+			path:     fmt.Sprintf("/scheduled-transfers/%d", scheduled.ID),
+			username: fromAccount.Owner,
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetScheduledTransfer(gomock.Any(), gomock.Eq(scheduled.ID)).Times(1).Return(scheduled, nil)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+			},
+		},
+		{
+			name:     "GetUnauthorizedUser",
+			method:   http.MethodGet,
+			path:     fmt.Sprintf("/scheduled-transfers/%d", scheduled.ID),
+			username: "unauthorized",
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetScheduledTransfer(gomock.Any(), gomock.Eq(scheduled.ID)).Times(1).Return(scheduled, nil)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusForbidden, recorder.Code)
+			},
+		},
+		{
+			name:     "GetNotFound",
+			method:   http.MethodGet,
+			path:     fmt.Sprintf("/scheduled-transfers/%d", scheduled.ID),
+			username: fromAccount.Owner,
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetScheduledTransfer(gomock.Any(), gomock.Any()).Times(1).Return(db.ScheduledTransfer{}, sql.ErrNoRows)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusNotFound, recorder.Code)
+			},
+		},
+		{
+			name:     "List",
+			method:   http.MethodGet,
+			path:     "/scheduled-transfers?limit=1",
+			username: fromAccount.Owner,
+			buildStubs: func(store *mockdb.MockStore) {
+				arg := db.ListScheduledTransfersByOwnerParams{Owner: fromAccount.Owner, AfterID: 0, LimitCount: 2}
+				store.EXPECT().ListScheduledTransfersByOwner(gomock.Any(), gomock.Eq(arg)).Times(1).
+					Return([]db.ScheduledTransfer{scheduled, scheduled}, nil)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+
+				var got struct {
+					Items      []db.ScheduledTransfer `json:"items"`
+					NextCursor string                 `json:"next_cursor"`
+				}
+				err := json.Unmarshal(recorder.Body.Bytes(), &got)
+				require.NoError(t, err)
+				require.Len(t, got.Items, 1)
+				require.Equal(t, apiutil.EncodePageCursor(scheduled.ID), got.NextCursor)
+			},
+		},
+		{
+			name:     "UpdateOK",
+			method:   http.MethodPatch,
+			path:     fmt.Sprintf("/scheduled-transfers/%d", scheduled.ID),
+			body:     gin.H{"amount": 200},
+			username: fromAccount.Owner,
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetScheduledTransfer(gomock.Any(), gomock.Eq(scheduled.ID)).Times(1).Return(scheduled, nil)
+				arg := db.UpdateScheduledTransferParams{
+					ID:     scheduled.ID,
+					Amount: sql.NullInt64{Int64: 200, Valid: true},
+				}
+				updated := scheduled
+				updated.Amount = 200
+				store.EXPECT().UpdateScheduledTransfer(gomock.Any(), gomock.Eq(arg)).Times(1).Return(updated, nil)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+			},
+		},
+		{
+			name:     "UpdateNothing",
+			method:   http.MethodPatch,
+			path:     fmt.Sprintf("/scheduled-transfers/%d", scheduled.ID),
+			body:     gin.H{},
+			username: fromAccount.Owner,
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().UpdateScheduledTransfer(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+		{
+			name:     "UpdateInactive",
+			method:   http.MethodPatch,
+			path:     fmt.Sprintf("/scheduled-transfers/%d", scheduled.ID),
+			body:     gin.H{"recurrence": db.RecurrenceWeekly},
+			username: fromAccount.Owner,
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetScheduledTransfer(gomock.Any(), gomock.Eq(scheduled.ID)).Times(1).Return(scheduled, nil)
+				store.EXPECT().UpdateScheduledTransfer(gomock.Any(), gomock.Any()).Times(1).Return(db.ScheduledTransfer{}, sql.ErrNoRows)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusConflict, recorder.Code)
+			},
+		},
+		{
+			name:     "CancelOK",
+			method:   http.MethodDelete,
+			path:     fmt.Sprintf("/scheduled-transfers/%d", scheduled.ID),
+			username: fromAccount.Owner,
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetScheduledTransfer(gomock.Any(), gomock.Eq(scheduled.ID)).Times(1).Return(scheduled, nil)
+				cancelled := scheduled
+				cancelled.Status = db.ScheduledTransferCancelled
+				store.EXPECT().CancelScheduledTransfer(gomock.Any(), gomock.Eq(scheduled.ID)).Times(1).Return(cancelled, nil)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+			},
+		},
+		{
+			name:     "CancelUnauthorizedUser",
+			method:   http.MethodDelete,
+			path:     fmt.Sprintf("/scheduled-transfers/%d", scheduled.ID),
+			username: "unauthorized",
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetScheduledTransfer(gomock.Any(), gomock.Eq(scheduled.ID)).Times(1).Return(scheduled, nil)
+				store.EXPECT().CancelScheduledTransfer(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusForbidden, recorder.Code)
+			},
+		},
+		{
+			name:     "ListRuns",
+			method:   http.MethodGet,
+			path:     fmt.Sprintf("/scheduled-transfers/%d/runs", scheduled.ID),
+			username: fromAccount.Owner,
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetScheduledTransfer(gomock.Any(), gomock.Eq(scheduled.ID)).Times(1).Return(scheduled, nil)
+				arg := db.ListScheduledTransferRunsParams{
+					ScheduledTransferID: scheduled.ID,
+					AfterID:             0,
+					LimitCount:          apiutil.DefaultPageLimit + 1,
+				}
+				runs := []db.ScheduledTransferRun{{ID: 1, ScheduledTransferID: scheduled.ID, Status: db.ScheduledRunFailed, Error: "insufficient balance"}}
+				store.EXPECT().ListScheduledTransferRuns(gomock.Any(), gomock.Eq(arg)).Times(1).Return(runs, nil)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			store := mockdb.NewMockStore(ctrl)
+			tc.buildStubs(store)
+			stubActiveSession(store)
+
+			server := newTestServer(t, store)
+			recorder := httptest.NewRecorder()
+
+			var body bytes.Buffer
+			if tc.body != nil {
+				err := json.NewEncoder(&body).Encode(tc.body)
+				require.NoError(t, err)
+			}
+			request, err := http.NewRequest(tc.method, tc.path, &body)
+			require.NoError(t, err)
+
+			addAuthorization(t, request, server.tokenMaker, authorizationTypeBearer, tc.username, util.DepositorRole, time.Minute)
+			server.router.ServeHTTP(recorder, request)
+			tc.checkResponse(recorder)
+		})
+	}
+}
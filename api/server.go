@@ -1,44 +1,165 @@
 package api
 
 import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"sync/atomic"
+	"time"
+
 	"github.com/gin-gonic/gin"
 	"github.com/gin-gonic/gin/binding"
 	"github.com/go-playground/validator/v10"
+	"github.com/leilei3167/bank/apiutil"
 	db "github.com/leilei3167/bank/db/sqlc"
+	"github.com/leilei3167/bank/db/util"
+	"github.com/leilei3167/bank/token"
+	"github.com/leilei3167/bank/worker"
 )
 
 //因为涉及到数据库的交互,所以嵌入store,router为路由
 type Server struct {
-	store  db.Store
-	router *gin.Engine
+	config     util.Config
+	store      db.Store
+	tokenMaker token.Maker
+	router     *gin.Engine
+	httpServer *http.Server
+	workers    *worker.Group //就绪检查报告的后台任务
+	//开始优雅关闭后为1,就绪检查随即失败
+	shuttingDown int32
 }
 
+//配置中没有设置超时时使用的默认值
+const (
+	defaultReadTimeout  = 10 * time.Second
+	defaultWriteTimeout = 30 * time.Second
+	defaultIdleTimeout  = 60 * time.Second
+)
+
 //链接到数据库之后传入store,返回新的Server实例
-func NewServer(store db.Store) *Server {
-	server := &Server{store: store}
-	router := gin.Default()
+func NewServer(config util.Config, store db.Store) (*Server, error) {
+	tokenMaker, err := token.NewPasetoMaker(config.TokenSymmetricKey)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create token maker: %w", err)
+	}
+
+	server := &Server{
+		config:     config,
+		store:      store,
+		tokenMaker: tokenMaker,
+	}
 	if v, ok := binding.Validator.Engine().(*validator.Validate); ok {
-		v.RegisterValidation("currency", validCurrency)
+		apiutil.RegisterValidations(v)
 	}
 
-	//暂时添加创建的api
-	//传入多个处理器的话中间的是中间件
+	server.setupRouter()
+	server.httpServer = &http.Server{
+		Handler:      server.router,
+		ReadTimeout:  util.DurationOrDefault(config.HTTPReadTimeout, defaultReadTimeout),
+		WriteTimeout: util.DurationOrDefault(config.HTTPWriteTimeout, defaultWriteTimeout),
+		IdleTimeout:  util.DurationOrDefault(config.HTTPIdleTimeout, defaultIdleTimeout),
+	}
+	return server, nil
+
+}
+
+//注册路由,公开的路由和需要鉴权的路由分开成组
+func (server *Server) setupRouter() {
+	//不使用gin.Default自带的Logger,访问日志由requestLogger以结构化的格式输出
+	router := gin.New()
+	router.Use(requestLogger(), requestTracing(), requestMetrics(), gin.Recovery())
+
+	router.GET("/healthz", server.healthz)
+	router.GET("/readyz", server.readyz)
+
 	//处理器函数都围绕server结构体构建,因为其中包括了数据库的交互
-	router.POST("/accounts", server.createAccount)
-	router.GET("/accounts/:id", server.getAccount) //:id告诉gin id字段是参数
-	router.GET("/accounts", server.ListAccount)
-	router.POST("/transfer", server.createTransfer)
 	router.POST("/users", server.createUser)
+	router.POST("/users/login", server.loginUser)
+	router.POST("/tokens/renew_access", server.renewAccessToken)
 
-	server.router = router
-	return server
+	//传入多个处理器的话中间的是中间件,该组下的路由都需要先通过鉴权
+	authRoutes := router.Group("/").Use(authMiddleware(server.tokenMaker, server.store))
+	authRoutes.POST("/accounts", server.createAccount)
+	authRoutes.GET("/accounts/:id", server.getAccount) //:id告诉gin id字段是参数
+	authRoutes.GET("/accounts", server.ListAccount)
+	authRoutes.POST("/accounts/:id/withdrawals", server.createWithdrawal)
+	authRoutes.GET("/accounts/:id/entries", server.listEntries)
+	authRoutes.GET("/accounts/:id/statement", server.getStatement)
+	authRoutes.GET("/accounts/:id/transfers", server.listAccountTransfers)
+	authRoutes.POST("/transfer", server.createTransfer)
+	authRoutes.GET("/transfers/:id", server.getTransfer)
+	authRoutes.POST("/users/logout", server.logoutUser)
+	authRoutes.GET("/users/sessions", server.listSessions)
+	authRoutes.DELETE("/users/sessions", server.revokeSessions)
+	authRoutes.POST("/scheduled-transfers", server.createScheduledTransfer)
+	authRoutes.GET("/scheduled-transfers", server.listScheduledTransfers)
+	authRoutes.GET("/scheduled-transfers/:id", server.getScheduledTransfer)
+	authRoutes.PATCH("/scheduled-transfers/:id", server.updateScheduledTransfer)
+	authRoutes.DELETE("/scheduled-transfers/:id", server.cancelScheduledTransfer)
+	authRoutes.GET("/scheduled-transfers/:id/runs", server.listScheduledTransferRuns)
+
+	//后台管理的路由,只有银行职员可以访问,普通用户仍然只能看到自己的数据
+	adminRoutes := router.Group("/admin").Use(
+		authMiddleware(server.tokenMaker, server.store),
+		roleMiddleware(util.BankerRole),
+	)
+	adminRoutes.GET("/accounts", server.adminListAccounts)
+	adminRoutes.POST("/accounts/:id/freeze", server.adminFreezeAccount)
+	adminRoutes.POST("/accounts/:id/unfreeze", server.adminUnfreezeAccount)
+	adminRoutes.GET("/users", server.adminListUsers)
+	adminRoutes.GET("/transfers/:id", server.adminGetTransfer)
+	adminRoutes.POST("/exchange_rates", server.adminCreateExchangeRate)
+	adminRoutes.GET("/exchange_rates", server.adminListExchangeRates)
+	adminRoutes.GET("/currencies", server.adminListCurrencies)
+	adminRoutes.POST("/currencies/:code/enable", server.adminEnableCurrency)
+	adminRoutes.POST("/currencies/:code/disable", server.adminDisableCurrency)
+	adminRoutes.GET("/reconciliation", server.adminGetReconciliation)
 
+	//冲正转账同样只有银行职员可以操作,但路由挂在/transfers下
+	//存款从清算账户入账,没有真实的资金来源,只能由柜台的银行职员办理,客户只能取款
+	bankerRoutes := router.Group("/").Use(
+		authMiddleware(server.tokenMaker, server.store),
+		roleMiddleware(util.BankerRole),
+	)
+	bankerRoutes.POST("/transfers/:id/reverse", server.reverseTransfer)
+	bankerRoutes.POST("/accounts/:id/deposits", server.createDeposit)
+
+	server.router = router
 }
 
-//在指定地址开启服务,外部可访问此方法
+//在指定地址开启服务,阻塞直到服务出错或者被Shutdown关闭,被关闭时返回nil
 func (server *Server) Start(addr string) error {
-	return server.router.Run(addr) //后面添加优雅关闭逻辑
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return server.Serve(listener)
+}
 
+//在已经监听的listener上开启服务,测试时可以监听随机端口
+func (server *Server) Serve(listener net.Listener) error {
+	err := server.httpServer.Serve(listener)
+	if err == http.ErrServerClosed {
+		return nil
+	}
+	return err
+}
+
+//优雅关闭:先让就绪检查失败,等待ShutdownGracePeriod让负载均衡摘除实例,期间照常处理新的请求,
+//然后停止接受新的连接,等待正在处理的请求完成
+//ctx到期时还没有处理完的请求会被放弃,返回ctx的错误
+func (server *Server) Shutdown(ctx context.Context) error {
+	atomic.StoreInt32(&server.shuttingDown, 1)
+	if grace := server.config.ShutdownGracePeriod; grace > 0 {
+		timer := time.NewTimer(grace)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+		}
+	}
+	return server.httpServer.Shutdown(ctx)
 }
 
 //将各个地方的错误处理封装成函数,返回键值对,简化代码
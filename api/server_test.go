@@ -0,0 +1,178 @@
+package api
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang/mock/gomock"
+	mockdb "github.com/leilei3167/bank/db/mock"
+	db "github.com/leilei3167/bank/db/sqlc"
+	"github.com/leilei3167/bank/db/util"
+	"github.com/stretchr/testify/require"
+)
+
+//启动在随机端口上的测试服务,额外注册一个阻塞到release被关闭的路由
+func startTestServer(t *testing.T) (server *Server, baseURL string, started chan struct{}, release chan struct{}, serveErr chan error) {
+	server = newTestServer(t, nil)
+	started = make(chan struct{})
+	release = make(chan struct{})
+	server.router.GET("/slow", func(ctx *gin.Context) {
+		close(started)
+		<-release
+		ctx.Status(http.StatusOK)
+	})
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	serveErr = make(chan error, 1)
+	go func() {
+		serveErr <- server.Serve(listener)
+	}()
+	return server, "http://" + listener.Addr().String(), started, release, serveErr
+}
+
+func TestServerShutdown(t *testing.T) {
+	server, baseURL, started, release, serveErr := startTestServer(t)
+
+	//发起一个还在处理中的请求
+	respCode := make(chan int, 1)
+	go func() {
+		resp, err := http.Get(baseURL + "/slow")
+		if err != nil {
+			respCode <- 0
+			return
+		}
+		resp.Body.Close()
+		respCode <- resp.StatusCode
+	}()
+	<-started
+
+	shutdownErr := make(chan error, 1)
+	go func() {
+		shutdownErr <- server.Shutdown(context.Background())
+	}()
+
+	//关闭开始之后不再接受新的连接,Serve立即返回nil
+	select {
+	case err := <-serveErr:
+		require.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Serve did not return after Shutdown")
+	}
+	_, err := http.Get(baseURL + "/slow")
+	require.Error(t, err)
+
+	//正在处理的请求完成之后Shutdown才返回
+	select {
+	case <-shutdownErr:
+		t.Fatal("Shutdown returned before the in-flight request finished")
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(release)
+	require.Equal(t, http.StatusOK, <-respCode)
+	require.NoError(t, <-shutdownErr)
+}
+
+func TestServerShutdownDeadline(t *testing.T) {
+	server, baseURL, started, release, _ := startTestServer(t)
+	defer close(release)
+
+	go func() {
+		resp, err := http.Get(baseURL + "/slow")
+		if err == nil {
+			resp.Body.Close()
+		}
+	}()
+	<-started
+
+	//请求没有在期限内完成时返回ctx的错误
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	err := server.Shutdown(ctx)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestServerShutdownGracePeriod(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	store := mockdb.NewMockStore(ctrl)
+	store.EXPECT().Ping(gomock.Any()).AnyTimes().Return(nil)
+	store.EXPECT().GetMigrationVersion(gomock.Any()).AnyTimes().
+		Return(db.MigrationVersion{Version: db.ExpectedMigrationVersion}, nil)
+
+	server, err := NewServer(util.Config{
+		TokenSymmetricKey:   util.RandomString(32),
+		ShutdownGracePeriod: 200 * time.Millisecond,
+	}, store)
+	require.NoError(t, err)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- server.Serve(listener)
+	}()
+	baseURL := "http://" + listener.Addr().String()
+
+	readyz := func() int {
+		resp, err := http.Get(baseURL + "/readyz")
+		require.NoError(t, err)
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	require.Equal(t, http.StatusOK, readyz())
+
+	start := time.Now()
+	shutdownErr := make(chan error, 1)
+	go func() {
+		shutdownErr <- server.Shutdown(context.Background())
+	}()
+
+	//等待期间仍然接受新的连接,负载均衡的探测可以看到503
+	require.Eventually(t, func() bool {
+		return readyz() == http.StatusServiceUnavailable
+	}, time.Second, 10*time.Millisecond)
+	select {
+	case <-serveErr:
+		t.Fatal("Serve returned before the grace period elapsed")
+	default:
+	}
+
+	require.NoError(t, <-shutdownErr)
+	require.GreaterOrEqual(t, time.Since(start), 200*time.Millisecond)
+	require.NoError(t, <-serveErr)
+}
+
+func TestServerShutdownGracePeriodDeadline(t *testing.T) {
+	server, err := NewServer(util.Config{
+		TokenSymmetricKey:   util.RandomString(32),
+		ShutdownGracePeriod: time.Hour,
+	}, nil)
+	require.NoError(t, err)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- server.Serve(listener)
+	}()
+
+	//关闭期限短于等待时间时不再等待,直接关闭服务
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	server.Shutdown(ctx)
+	require.Less(t, time.Since(start), time.Second)
+	require.NoError(t, <-serveErr)
+}
+
+func TestServerTimeouts(t *testing.T) {
+	server := newTestServer(t, nil)
+	require.Equal(t, defaultReadTimeout, server.httpServer.ReadTimeout)
+	require.Equal(t, defaultWriteTimeout, server.httpServer.WriteTimeout)
+	require.Equal(t, defaultIdleTimeout, server.httpServer.IdleTimeout)
+}
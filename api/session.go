@@ -0,0 +1,80 @@
+package api
+
+import (
+	"database/sql"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	db "github.com/leilei3167/bank/db/sqlc"
+	"github.com/leilei3167/bank/token"
+)
+
+//会话信息,不能返回refresh token
+type sessionResponse struct {
+	ID        uuid.UUID `json:"id"`
+	UserAgent string    `json:"user_agent"`
+	ClientIp  string    `json:"client_ip"`
+	ExpiresAt time.Time `json:"expires_at"`
+	CreatedAt time.Time `json:"created_at"`
+	Current   bool      `json:"current"` //是否为发起本次请求的会话
+}
+
+func newSessionResponse(session db.Session, currentID uuid.UUID) sessionResponse {
+	return sessionResponse{
+		ID:        session.ID,
+		UserAgent: session.UserAgent,
+		ClientIp:  session.ClientIp,
+		ExpiresAt: session.ExpiresAt,
+		CreatedAt: session.CreatedAt,
+		Current:   session.ID == currentID,
+	}
+}
+
+//退出登录,吊销当前会话
+func (server *Server) logoutUser(ctx *gin.Context) {
+	authPayload := ctx.MustGet(authorizationPayloadKey).(*token.Payload)
+
+	_, err := server.store.BlockSession(ctx, authPayload.SessionID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			ctx.JSON(http.StatusNotFound, errorRespones(err))
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, errorRespones(err))
+		return
+	}
+
+	ctx.Status(http.StatusNoContent)
+}
+
+//列出当前用户所有有效的会话
+func (server *Server) listSessions(ctx *gin.Context) {
+	authPayload := ctx.MustGet(authorizationPayloadKey).(*token.Payload)
+
+	sessions, err := server.store.ListActiveSessions(ctx, authPayload.Username)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorRespones(err))
+		return
+	}
+
+	resp := make([]sessionResponse, 0, len(sessions))
+	for _, session := range sessions {
+		resp = append(resp, newSessionResponse(session, authPayload.SessionID))
+	}
+	ctx.JSON(http.StatusOK, resp)
+}
+
+//吊销当前用户的所有会话(在所有设备上退出登录)
+func (server *Server) revokeSessions(ctx *gin.Context) {
+	authPayload := ctx.MustGet(authorizationPayloadKey).(*token.Payload)
+
+	err := server.store.BlockUserSessions(ctx, authPayload.Username)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorRespones(err))
+		return
+	}
+
+	ctx.Status(http.StatusNoContent)
+}
@@ -0,0 +1,182 @@
+package api
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang/mock/gomock"
+	"github.com/google/uuid"
+	mockdb "github.com/leilei3167/bank/db/mock"
+	db "github.com/leilei3167/bank/db/sqlc"
+	"github.com/leilei3167/bank/db/util"
+	"github.com/leilei3167/bank/token"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRenewAccessTokenAPI(t *testing.T) {
+	user, _ := randomUser(t)
+
+	testCases := []struct {
+		name string
+		//根据server的tokenMaker生成refresh token和对应的会话
+		buildSession  func(t *testing.T, tokenMaker token.Maker) (refreshToken string, session db.Session)
+		buildStubs    func(store *mockdb.MockStore, session db.Session)
+		checkResponse func(recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name:         "OK",
+			buildSession: validSession(user.Username),
+			buildStubs: func(store *mockdb.MockStore, session db.Session) {
+				store.EXPECT().GetSession(gomock.Any(), gomock.Eq(session.ID)).Times(1).Return(session, nil)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+
+				var resp renewAccessTokenResponse
+				err := json.Unmarshal(recorder.Body.Bytes(), &resp)
+				require.NoError(t, err)
+				require.NotEmpty(t, resp.AccessToken)
+			},
+		},
+		{
+			name: "BlockedSession",
+			buildSession: func(t *testing.T, tokenMaker token.Maker) (string, db.Session) {
+				refreshToken, session := validSession(user.Username)(t, tokenMaker)
+				session.IsBlocked = true
+				return refreshToken, session
+			},
+			buildStubs: func(store *mockdb.MockStore, session db.Session) {
+				store.EXPECT().GetSession(gomock.Any(), gomock.Eq(session.ID)).Times(1).Return(session, nil)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusUnauthorized, recorder.Code)
+			},
+		},
+		{
+			name: "MismatchedToken",
+			buildSession: func(t *testing.T, tokenMaker token.Maker) (string, db.Session) {
+				refreshToken, session := validSession(user.Username)(t, tokenMaker)
+				session.RefreshToken = "another token"
+				return refreshToken, session
+			},
+			buildStubs: func(store *mockdb.MockStore, session db.Session) {
+				store.EXPECT().GetSession(gomock.Any(), gomock.Eq(session.ID)).Times(1).Return(session, nil)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusUnauthorized, recorder.Code)
+			},
+		},
+		{
+			name: "IncorrectSessionUser",
+			buildSession: func(t *testing.T, tokenMaker token.Maker) (string, db.Session) {
+				refreshToken, session := validSession(user.Username)(t, tokenMaker)
+				session.Username = "another"
+				return refreshToken, session
+			},
+			buildStubs: func(store *mockdb.MockStore, session db.Session) {
+				store.EXPECT().GetSession(gomock.Any(), gomock.Eq(session.ID)).Times(1).Return(session, nil)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusUnauthorized, recorder.Code)
+			},
+		},
+		{
+			name: "ExpiredSession",
+			buildSession: func(t *testing.T, tokenMaker token.Maker) (string, db.Session) {
+				refreshToken, session := validSession(user.Username)(t, tokenMaker)
+				session.ExpiresAt = time.Now().Add(-time.Minute)
+				return refreshToken, session
+			},
+			buildStubs: func(store *mockdb.MockStore, session db.Session) {
+				store.EXPECT().GetSession(gomock.Any(), gomock.Eq(session.ID)).Times(1).Return(session, nil)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusUnauthorized, recorder.Code)
+			},
+		},
+		{
+			name:         "SessionNotFound",
+			buildSession: validSession(user.Username),
+			buildStubs: func(store *mockdb.MockStore, session db.Session) {
+				store.EXPECT().GetSession(gomock.Any(), gomock.Any()).Times(1).Return(db.Session{}, sql.ErrNoRows)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusNotFound, recorder.Code)
+			},
+		},
+		{
+			name: "AccessToken",
+			buildSession: func(t *testing.T, tokenMaker token.Maker) (string, db.Session) {
+				accessToken, _, err := tokenMaker.CreateToken(user.Username, util.DepositorRole, uuid.New(), token.TokenTypeAccess, time.Hour)
+				require.NoError(t, err)
+				return accessToken, db.Session{}
+			},
+			buildStubs: func(store *mockdb.MockStore, session db.Session) {
+				store.EXPECT().GetSession(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusUnauthorized, recorder.Code)
+			},
+		},
+		{
+			name: "InvalidToken",
+			buildSession: func(t *testing.T, tokenMaker token.Maker) (string, db.Session) {
+				return "invalid", db.Session{}
+			},
+			buildStubs: func(store *mockdb.MockStore, session db.Session) {
+				store.EXPECT().GetSession(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusUnauthorized, recorder.Code)
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			store := mockdb.NewMockStore(ctrl)
+			server := newTestServer(t, store)
+
+			refreshToken, session := tc.buildSession(t, server.tokenMaker)
+			tc.buildStubs(store, session)
+
+			recorder := httptest.NewRecorder()
+			data, err := json.Marshal(gin.H{"refresh_token": refreshToken})
+			require.NoError(t, err)
+
+			url := "/tokens/renew_access"
+			request, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(data))
+			require.NoError(t, err)
+
+			server.router.ServeHTTP(recorder, request)
+			tc.checkResponse(recorder)
+		})
+	}
+}
+
+//生成一个有效的refresh token以及与之匹配的会话
+func validSession(username string) func(t *testing.T, tokenMaker token.Maker) (string, db.Session) {
+	return func(t *testing.T, tokenMaker token.Maker) (string, db.Session) {
+		refreshToken, payload, err := tokenMaker.CreateToken(username, util.DepositorRole, uuid.New(), token.TokenTypeRefresh, time.Hour)
+		require.NoError(t, err)
+
+		session := db.Session{
+			ID:           payload.SessionID,
+			Username:     username,
+			RefreshToken: refreshToken,
+			ExpiresAt:    payload.ExpiredAt,
+		}
+		return refreshToken, session
+	}
+}
@@ -0,0 +1,56 @@
+package api
+
+import (
+	"fmt"
+
+	"github.com/gin-gonic/gin"
+	"github.com/leilei3167/bank/logger"
+	"github.com/leilei3167/bank/tracing"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.7.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+//为每个请求创建span,客户端通过traceparent头传入的上游span作为父span
+//span同时保存在请求的context和gin的Keys中,处理器调用store时创建的span都是它的子span
+func requestTracing() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		parent := otel.GetTextMapPropagator().Extract(ctx.Request.Context(), propagation.HeaderCarrier(ctx.Request.Header))
+
+		//span的名称使用路由模板,避免账户id等参数让名称无限增长
+		route := ctx.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		spanCtx, span := tracing.Start(parent, fmt.Sprintf("%s %s", ctx.Request.Method, route),
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				semconv.HTTPMethodKey.String(ctx.Request.Method),
+				semconv.HTTPRouteKey.String(route),
+				semconv.HTTPTargetKey.String(ctx.Request.URL.Path),
+			),
+		)
+		defer span.End()
+		if requestID := logger.RequestID(ctx); requestID != "" {
+			span.SetAttributes(tracing.RequestIDKey.String(requestID))
+		}
+		ctx.Request = ctx.Request.WithContext(spanCtx)
+		ctx.Set(tracing.SpanKey, span)
+
+		ctx.Next()
+
+		status := ctx.Writer.Status()
+		span.SetAttributes(semconv.HTTPStatusCodeKey.Int(status))
+		outcome := tracing.OutcomeSuccess
+		if status >= 400 {
+			outcome = tracing.OutcomeError
+		}
+		span.SetAttributes(tracing.OutcomeKey.String(outcome))
+		//只有服务端的错误才把span标记为Error,客户的请求错误属于正常的结果
+		if status >= 500 {
+			span.SetStatus(codes.Error, fmt.Sprintf("HTTP %d", status))
+		}
+	}
+}
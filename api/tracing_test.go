@@ -0,0 +1,72 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	mockdb "github.com/leilei3167/bank/db/mock"
+	"github.com/leilei3167/bank/db/util"
+	"github.com/leilei3167/bank/tracing"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestRequestTracing(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	globalProvider, globalPropagator := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	defer func() {
+		otel.SetTracerProvider(globalProvider)
+		otel.SetTextMapPropagator(globalPropagator)
+	}()
+
+	account := randomAccount()
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	store := mockdb.NewMockStore(ctrl)
+	stubActiveSession(store)
+	store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(account.ID)).Times(1).Return(account, nil)
+
+	server := newTestServer(t, tracing.TraceStore(store))
+	recorder := httptest.NewRecorder()
+	request, err := http.NewRequest(http.MethodGet, fmt.Sprintf("/accounts/%d", account.ID), nil)
+	require.NoError(t, err)
+	addAuthorization(t, request, server.tokenMaker, authorizationTypeBearer, account.Owner, util.DepositorRole, time.Minute)
+	//上游服务传入的trace
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	request.Header.Set("traceparent", "00-"+traceID+"-00f067aa0ba902b7-01")
+	server.router.ServeHTTP(recorder, request)
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	spans := exporter.GetSpans()
+	require.Len(t, spans, 2)
+	var requestSpan, storeSpan tracetest.SpanStub
+	for _, span := range spans {
+		switch span.Name {
+		case "GET /accounts/:id":
+			requestSpan = span
+		case "Store.GetAccount":
+			storeSpan = span
+		}
+	}
+
+	require.Equal(t, trace.SpanKindServer, requestSpan.SpanKind)
+	require.Equal(t, traceID, requestSpan.SpanContext.TraceID().String())
+	require.True(t, requestSpan.Parent.IsRemote())
+	require.Contains(t, requestSpan.Attributes, attribute.Int("http.status_code", http.StatusOK))
+	require.Contains(t, requestSpan.Attributes, tracing.OutcomeKey.String(tracing.OutcomeSuccess))
+
+	//处理器把*gin.Context传给store,store的span仍然是请求span的子span
+	require.Equal(t, requestSpan.SpanContext.SpanID(), storeSpan.Parent.SpanID())
+	require.Contains(t, storeSpan.Attributes, tracing.AccountIDKey.Int64(account.ID))
+}
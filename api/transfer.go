@@ -2,10 +2,23 @@ package api
 
 import (
 	"database/sql"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/gin-gonic/gin"
+	"github.com/leilei3167/bank/apiutil"
 	db "github.com/leilei3167/bank/db/sqlc"
+	"github.com/leilei3167/bank/db/util"
+	"github.com/leilei3167/bank/token"
+	"io"
 	"net/http"
+	"time"
+)
+
+const (
+	idempotencyKeyHeader     = "Idempotency-Key"     //客户端重试时携带相同的key,避免重复转账
+	idempotentReplayedHeader = "Idempotent-Replayed" //返回的是之前请求的结果时设置为true
+	maxIdempotencyKeyLength  = apiutil.MaxIdempotencyKeyLength
 )
 
 //定义发起转账所需要的参数
@@ -16,12 +29,73 @@ type transferRequest struct {
 	Currency     string `json:"currency,omitempty" binding:"required,currency"`
 }
 
+//转账记录,amount为转出方币种的金额,credited_amount为转入方币种的金额
+type transferResponse struct {
+	db.Transfer
+	AmountDecimal         string `json:"amount_decimal"`
+	CreditedAmountDecimal string `json:"credited_amount_decimal"`
+}
+
+func newTransferResponse(transfer db.Transfer, fromCurrency, toCurrency string) transferResponse {
+	return transferResponse{
+		Transfer:              transfer,
+		AmountDecimal:         util.Currencies.FormatAmount(transfer.Amount, fromCurrency),
+		CreditedAmountDecimal: util.Currencies.FormatAmount(transfer.CreditedAmount, toCurrency),
+	}
+}
+
+type entryResponse struct {
+	db.Entry
+	AmountDecimal string `json:"amount_decimal"`
+}
+
+func newEntryResponse(entry db.Entry, currency string) entryResponse {
+	return entryResponse{
+		Entry:         entry,
+		AmountDecimal: util.Currencies.FormatAmount(entry.Amount, currency),
+	}
+}
+
+//与db.TransferTxResult的结构相同,金额都附带十进制字符串
+type transferTxResponse struct {
+	Transfer    transferResponse `json:"transfer"`
+	FromAccount accountResponse  `json:"from_account"`
+	ToAccount   accountResponse  `json:"to_account"`
+	FromEntry   entryResponse    `json:"from_entry"`
+	ToEntry     entryResponse    `json:"to_entry"`
+}
+
+func newTransferTxResponse(result db.TransferTxResult) transferTxResponse {
+	fromCurrency := result.FromAccount.Currency
+	toCurrency := result.ToAccount.Currency
+	return transferTxResponse{
+		Transfer:    newTransferResponse(result.Transfer, fromCurrency, toCurrency),
+		FromAccount: newAccountResponse(result.FromAccount),
+		ToAccount:   newAccountResponse(result.ToAccount),
+		FromEntry:   newEntryResponse(result.FromEntry, fromCurrency),
+		ToEntry:     newEntryResponse(result.ToEntry, toCurrency),
+	}
+}
+
 func (server *Server) createTransfer(ctx *gin.Context) {
 	var req transferRequest
 	if err := ctx.ShouldBindJSON(&req); err != nil {
 		ctx.JSON(http.StatusBadRequest, errorRespones(err))
 		return
 	}
+	authPayload := ctx.MustGet(authorizationPayloadKey).(*token.Payload)
+
+	idempotencyKey := ctx.GetHeader(idempotencyKeyHeader)
+	if len(idempotencyKey) > maxIdempotencyKeyLength {
+		err := fmt.Errorf("%s must be at most %d characters", idempotencyKeyHeader, maxIdempotencyKeyLength)
+		ctx.JSON(http.StatusBadRequest, errorRespones(err))
+		return
+	}
+	requestHash := hashTransferRequest(req)
+	if idempotencyKey != "" && server.replayTransfer(ctx, authPayload.Username, idempotencyKey, requestHash) {
+		return
+	}
+
 	//构建数据库中创建转账的必须字段
 	arg := db.TransferTxParams{
 		FromAccountID: req.FromAccoutID,
@@ -29,38 +103,337 @@ func (server *Server) createTransfer(ctx *gin.Context) {
 		Amount:        req.Amout,
 	}
 	//需要考虑用户转账的货币种类和自己的账户是否相符
-	if !server.validAccount(ctx, req.FromAccoutID, req.Currency) {
+	fromAccount, valid := server.validAccount(ctx, req.FromAccoutID)
+	if !valid {
+		return
+	}
+	//只有转出账户的拥有者才能发起转账
+	if fromAccount.Owner != authPayload.Username {
+		err := errors.New("from account doesn't belong to the authenticated user")
+		ctx.JSON(http.StatusForbidden, errorRespones(err))
+		return
+	}
+	//转账金额以转出账户的货币计算
+	if fromAccount.Currency != req.Currency {
+		err := fmt.Errorf("account [%v] currency mismatch:[%v]->[%v]",
+			fromAccount.ID, fromAccount.Currency, req.Currency)
+		ctx.JSON(http.StatusBadRequest, errorRespones(err))
 		return
 	}
-	if !server.validAccount(ctx, req.ToAccountID, req.Currency) {
+
+	//转入账户可以是其他币种,由TransferTx按照汇率换算
+	_, valid = server.validAccount(ctx, req.ToAccountID)
+	if !valid {
 		return
 	}
 
-	result, err := server.store.TransferTx(ctx, arg) //gin中的context是实现了context.Context的
+	if idempotencyKey == "" {
+		result, err := server.store.TransferTx(ctx, arg) //gin中的context是实现了context.Context的
+		if err != nil {
+			ctx.JSON(apiutil.TransferErrorStatus(err), errorRespones(err))
+			return
+		}
+
+		ctx.JSON(http.StatusOK, newTransferTxResponse(result))
+		return
+	}
+
+	//带幂等键的转账,并发的重复请求会在数据库中等待第一个请求完成
+	result, err := server.store.IdempotentTransferTx(ctx, db.IdempotentTransferTxParams{
+		TransferTxParams: arg,
+		Username:         authPayload.Username,
+		Key:              idempotencyKey,
+		RequestHash:      requestHash,
+	})
 	if err != nil {
-		ctx.JSON(http.StatusBadRequest, errorRespones(err))
+		if errors.Is(err, db.ErrIdempotencyKeyReused) {
+			ctx.JSON(http.StatusConflict, errorRespones(err))
+			return
+		}
+		ctx.JSON(apiutil.TransferErrorStatus(err), errorRespones(err))
 		return
 	}
+	if result.Replayed {
+		ctx.Header(idempotentReplayedHeader, "true")
+	}
+
+	ctx.JSON(http.StatusOK, newTransferTxResponse(result.TransferTxResult))
+}
+
+//如果该幂等键对应的请求已经完成,直接返回之前的结果,返回值表示是否已经写入了响应
+func (server *Server) replayTransfer(ctx *gin.Context, username, idempotencyKey, requestHash string) bool {
+	key, err := server.store.GetIdempotencyKey(ctx, db.GetIdempotencyKeyParams{
+		Username: username,
+		Key:      idempotencyKey,
+	})
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return false
+		}
+		ctx.JSON(http.StatusInternalServerError, errorRespones(err))
+		return true
+	}
+
+	if key.RequestHash != requestHash {
+		ctx.JSON(http.StatusConflict, errorRespones(db.ErrIdempotencyKeyReused))
+		return true
+	}
+
+	var result db.TransferTxResult
+	if err := json.Unmarshal(key.Response, &result); err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorRespones(err))
+		return true
+	}
+	ctx.Header(idempotentReplayedHeader, "true")
+	ctx.JSON(http.StatusOK, newTransferTxResponse(result))
+	return true
+}
 
-	ctx.JSON(http.StatusOK, result)
+//请求体的哈希,和gRPC接口使用同样的算法
+func hashTransferRequest(req transferRequest) string {
+	return apiutil.HashTransferRequest(req.FromAccoutID, req.ToAccountID, req.Amout, req.Currency)
 }
 
-func (server *Server) validAccount(ctx *gin.Context, accountID int64, currency string) bool {
+//检查账户是否存在、是否为系统账户以及是否被冻结,这里只是提前拒绝,事务加锁之后还会再检查一次冻结
+func (server *Server) validAccount(ctx *gin.Context, accountID int64) (db.Account, bool) {
 	account, err := server.store.GetAccount(ctx, accountID)
 	if err != nil {
 		//两种错误
 		if err == sql.ErrNoRows {
 			ctx.JSON(http.StatusNotFound, errorRespones(err))
-			return false
+			return account, false
 		}
 		ctx.JSON(http.StatusInternalServerError, errorRespones(err))
-		return false
+		return account, false
 	}
-	if account.Currency != currency {
-		err := fmt.Errorf("account [%v] currency mismatch:[%v]->[%v]",
-			accountID, account.Currency, currency)
+	//系统账户只用于内部记账,客户不能转入转出或存取款
+	if db.IsSystemAccountOwner(account.Owner) {
+		err := fmt.Errorf("account [%v]: %w", accountID, db.ErrSystemAccount)
+		ctx.JSON(apiutil.TransferErrorStatus(err), errorRespones(err))
+		return account, false
+	}
+	//冻结的账户不能参与转账
+	if account.IsFrozen {
+		err := fmt.Errorf("account [%v] is frozen", accountID)
+		ctx.JSON(http.StatusForbidden, errorRespones(err))
+		return account, false
+	}
+	return account, true
+}
+
+type getTransferRequest struct {
+	ID int64 `uri:"id" binding:"required,min=1"`
+}
+
+//查询转账以及双方账户,格式化金额需要双方账户的币种,返回值表示是否可以继续处理
+func (server *Server) loadTransfer(ctx *gin.Context, transferID int64) (db.Transfer, db.Account, db.Account, bool) {
+	var fromAccount, toAccount db.Account
+	transfer, err := server.store.GetTransfer(ctx, transferID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			ctx.JSON(http.StatusNotFound, errorRespones(err))
+			return transfer, fromAccount, toAccount, false
+		}
+		ctx.JSON(http.StatusInternalServerError, errorRespones(err))
+		return transfer, fromAccount, toAccount, false
+	}
+
+	fromAccount, err = server.store.GetAccount(ctx, transfer.FromAccountID)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorRespones(err))
+		return transfer, fromAccount, toAccount, false
+	}
+	toAccount, err = server.store.GetAccount(ctx, transfer.ToAccountID)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorRespones(err))
+		return transfer, fromAccount, toAccount, false
+	}
+	return transfer, fromAccount, toAccount, true
+}
+
+//用户只能查看转出或转入账户属于自己的转账
+func (server *Server) getTransfer(ctx *gin.Context) {
+	var req getTransferRequest
+	if err := ctx.ShouldBindUri(&req); err != nil {
 		ctx.JSON(http.StatusBadRequest, errorRespones(err))
-		return false
+		return
 	}
-	return true
+
+	transfer, fromAccount, toAccount, ok := server.loadTransfer(ctx, req.ID)
+	if !ok {
+		return
+	}
+
+	authPayload := ctx.MustGet(authorizationPayloadKey).(*token.Payload)
+	if fromAccount.Owner != authPayload.Username && toAccount.Owner != authPayload.Username {
+		err := errors.New("transfer doesn't belong to the authenticated user")
+		ctx.JSON(http.StatusForbidden, errorRespones(err))
+		return
+	}
+	ctx.JSON(http.StatusOK, newTransferResponse(transfer, fromAccount.Currency, toAccount.Currency))
+}
+
+//所有过滤条件都是可选的,金额按本账户的币种比较(转出看amount,转入看credited_amount)
+//时间使用RFC3339格式,区间为[from,to)
+type listTransfersRequest struct {
+	Direction      string    `form:"direction" binding:"omitempty,oneof=incoming outgoing"`
+	CounterpartyID int64     `form:"counterparty_id" binding:"omitempty,min=1"`
+	MinAmount      int64     `form:"min_amount" binding:"omitempty,min=1"`
+	MaxAmount      int64     `form:"max_amount" binding:"omitempty,min=1"`
+	From           time.Time `form:"from" time_format:"2006-01-02T15:04:05Z07:00"`
+	To             time.Time `form:"to" time_format:"2006-01-02T15:04:05Z07:00"`
+	pageRequest
+}
+
+func (server *Server) listAccountTransfers(ctx *gin.Context) {
+	var uri getAccountRequest
+	if err := ctx.ShouldBindUri(&uri); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorRespones(err))
+		return
+	}
+	var req listTransfersRequest
+	if err := ctx.ShouldBindQuery(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorRespones(err))
+		return
+	}
+	if req.MinAmount > 0 && req.MaxAmount > 0 && req.MinAmount > req.MaxAmount {
+		err := errors.New("min_amount must not be greater than max_amount")
+		ctx.JSON(http.StatusBadRequest, errorRespones(err))
+		return
+	}
+	if !req.From.IsZero() && !req.To.IsZero() && !req.From.Before(req.To) {
+		err := errors.New("from must be before to")
+		ctx.JSON(http.StatusBadRequest, errorRespones(err))
+		return
+	}
+
+	account, ok := server.getOwnedAccount(ctx, uri.ID)
+	if !ok {
+		return
+	}
+
+	arg := db.ListTransfersParams{
+		AccountID:      account.ID,
+		Direction:      sql.NullString{String: req.Direction, Valid: req.Direction != ""},
+		CounterpartyID: sql.NullInt64{Int64: req.CounterpartyID, Valid: req.CounterpartyID > 0},
+		MinAmount:      sql.NullInt64{Int64: req.MinAmount, Valid: req.MinAmount > 0},
+		MaxAmount:      sql.NullInt64{Int64: req.MaxAmount, Valid: req.MaxAmount > 0},
+		FromTime:       sql.NullTime{Time: req.From, Valid: !req.From.IsZero()},
+		ToTime:         sql.NullTime{Time: req.To, Valid: !req.To.IsZero()},
+	}
+	var page apiutil.CursorPage
+	if req.isOffset() {
+		arg.LimitCount = req.PageSize
+		arg.OffsetCount = req.offset()
+	} else {
+		var err error
+		page, err = server.cursorPage(req.pageRequest)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, errorRespones(err))
+			return
+		}
+		arg.AfterID = page.AfterID
+		arg.LimitCount = page.QueryLimit()
+	}
+
+	transfers, err := server.store.ListTransfers(ctx, arg)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorRespones(err))
+		return
+	}
+
+	var nextCursor string
+	if !req.isOffset() && page.HasMore(len(transfers)) {
+		transfers = transfers[:page.Limit]
+		nextCursor = apiutil.EncodePageCursor(transfers[len(transfers)-1].ID)
+	}
+
+	//对方账户的币种需要单独查询,同一页中相同的对方账户只查一次
+	currencies := map[int64]string{account.ID: account.Currency}
+	currencyOf := func(accountID int64) (string, error) {
+		if currency, ok := currencies[accountID]; ok {
+			return currency, nil
+		}
+		counterparty, err := server.store.GetAccount(ctx, accountID)
+		if err != nil {
+			return "", err
+		}
+		currencies[accountID] = counterparty.Currency
+		return counterparty.Currency, nil
+	}
+
+	resp := make([]transferResponse, 0, len(transfers))
+	for _, transfer := range transfers {
+		fromCurrency, err := currencyOf(transfer.FromAccountID)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, errorRespones(err))
+			return
+		}
+		toCurrency, err := currencyOf(transfer.ToAccountID)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, errorRespones(err))
+			return
+		}
+		resp = append(resp, newTransferResponse(transfer, fromCurrency, toCurrency))
+	}
+	if req.isOffset() {
+		ctx.JSON(http.StatusOK, resp)
+		return
+	}
+	ctx.JSON(http.StatusOK, cursorPageResponse{Items: resp, NextCursor: nextCursor})
+}
+
+//冲正的金额以原转账转出方的货币计,不传时退还剩余的全部金额
+type reverseTransferRequest struct {
+	Amount int64 `json:"amount" binding:"omitempty,min=1"`
+}
+
+type reverseTransferResponse struct {
+	transferTxResponse
+	Original        transferResponse `json:"original"`
+	Refunded        int64            `json:"refunded"`
+	RefundedDecimal string           `json:"refunded_decimal"`
+}
+
+//客服撤销错误的转账,创建一笔反向的转账把钱退回给转出方,只有银行职员可以操作
+func (server *Server) reverseTransfer(ctx *gin.Context) {
+	var uri getTransferRequest
+	if err := ctx.ShouldBindUri(&uri); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorRespones(err))
+		return
+	}
+	//请求体是可选的,空的请求体表示全额退款
+	var req reverseTransferRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil && err != io.EOF {
+		ctx.JSON(http.StatusBadRequest, errorRespones(err))
+		return
+	}
+
+	result, err := server.store.ReverseTransferTx(ctx, db.ReverseTransferTxParams{
+		TransferID: uri.ID,
+		Amount:     req.Amount,
+	})
+	if err != nil {
+		switch {
+		case err == sql.ErrNoRows:
+			ctx.JSON(http.StatusNotFound, errorRespones(err))
+		case errors.Is(err, db.ErrTransferAlreadyReversed):
+			ctx.JSON(http.StatusConflict, errorRespones(err))
+		case errors.Is(err, db.ErrRefundExceedsAmount), errors.Is(err, db.ErrReverseReversal):
+			ctx.JSON(http.StatusBadRequest, errorRespones(err))
+		default:
+			ctx.JSON(apiutil.TransferErrorStatus(err), errorRespones(err))
+		}
+		return
+	}
+
+	//反向转账的转入方就是原转账的转出方
+	originalFrom := result.ToAccount.Currency
+	originalTo := result.FromAccount.Currency
+	ctx.JSON(http.StatusOK, reverseTransferResponse{
+		transferTxResponse: newTransferTxResponse(result.TransferTxResult),
+		Original:           newTransferResponse(result.Original, originalFrom, originalTo),
+		Refunded:           result.Refunded,
+		RefundedDecimal:    util.Currencies.FormatAmount(result.Refunded, originalFrom),
+	})
 }
@@ -1,9 +1,13 @@
 package api
 
 import (
+	"database/sql"
+
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 	db "github.com/leilei3167/bank/db/sqlc"
 	"github.com/leilei3167/bank/db/util"
+	"github.com/leilei3167/bank/token"
 	"github.com/lib/pq"
 	"net/http"
 	"time"
@@ -22,6 +26,7 @@ type ResUser struct {
 	//HashedPassword    string    `json:"hashed_password"`
 	FullName          string    `json:"full_name"`
 	Email             string    `json:"email"`
+	Role              string    `json:"role"`
 	PasswordChangedAt time.Time `json:"password_changed_at"`
 	CreatedAt         time.Time `json:"created_at"`
 }
@@ -50,21 +55,113 @@ func (server *Server) createUser(ctx *gin.Context) {
 			//log.Println(pqErr.Code.Name())
 			switch pqErr.Code.Name() {
 			case "unique_violation":
-				ctx.JSON(http.StatusForbidden, errorRespones(err))
+				//用户名或邮箱已经被使用
+				ctx.JSON(http.StatusConflict, errorRespones(err))
+				return
 			}
 
 		}
 		ctx.JSON(http.StatusInternalServerError, errorRespones(err))
 		return
 	}
-	//不应该将hash之后的密码也返回
-	resp := ResUser{
+	ctx.JSON(http.StatusOK, newUserResponse(user))
+
+}
+
+//不应该将hash之后的密码也返回,因此统一转换为ResUser
+func newUserResponse(user db.User) ResUser {
+	return ResUser{
 		Username:          user.Username,
 		FullName:          user.FullName,
 		Email:             user.Email,
+		Role:              user.Role,
 		PasswordChangedAt: user.PasswordChangedAt,
 		CreatedAt:         user.CreatedAt,
 	}
-	ctx.JSON(http.StatusOK, resp)
+}
+
+//登录所需的参数
+type loginUserRequest struct {
+	Username string `json:"username" binding:"required,alphanum"`
+	Password string `json:"password" binding:"required,min=6"`
+}
+
+//登录成功返回access token,refresh token和用户信息
+type loginUserResponse struct {
+	SessionID             uuid.UUID `json:"session_id"`
+	AccessToken           string    `json:"access_token"`
+	AccessTokenExpiresAt  time.Time `json:"access_token_expires_at"`
+	RefreshToken          string    `json:"refresh_token"`
+	RefreshTokenExpiresAt time.Time `json:"refresh_token_expires_at"`
+	User                  ResUser   `json:"user"`
+}
+
+func (server *Server) loginUser(ctx *gin.Context) {
+	var req loginUserRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorRespones(err))
+		return
+	}
+
+	user, err := server.store.GetUser(ctx, req.Username)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			ctx.JSON(http.StatusNotFound, errorRespones(err))
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, errorRespones(err))
+		return
+	}
+
+	//对比裸密码和数据库中哈希后的密码
+	err = util.CheckPassword(req.Password, user.HashedPassword)
+	if err != nil {
+		ctx.JSON(http.StatusUnauthorized, errorRespones(err))
+		return
+	}
+
+	//每次登录都是一个新的会话,该会话签发的token都携带会话id
+	sessionID, err := uuid.NewRandom()
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorRespones(err))
+		return
+	}
 
+	accessToken, accessPayload, err := server.tokenMaker.CreateToken(user.Username, user.Role, sessionID, token.TokenTypeAccess, server.config.AccessTokenDuration)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorRespones(err))
+		return
+	}
+
+	//refresh token有效期更长,用于在access token过期后换取新的access token
+	refreshToken, refreshPayload, err := server.tokenMaker.CreateToken(user.Username, user.Role, sessionID, token.TokenTypeRefresh, server.config.RefreshTokenDuration)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorRespones(err))
+		return
+	}
+
+	//将refresh token记录为一个会话
+	session, err := server.store.CreateSession(ctx, db.CreateSessionParams{
+		ID:           sessionID,
+		Username:     user.Username,
+		RefreshToken: refreshToken,
+		UserAgent:    ctx.Request.UserAgent(),
+		ClientIp:     ctx.ClientIP(),
+		IsBlocked:    false,
+		ExpiresAt:    refreshPayload.ExpiredAt,
+	})
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, errorRespones(err))
+		return
+	}
+
+	resp := loginUserResponse{
+		SessionID:             session.ID,
+		AccessToken:           accessToken,
+		AccessTokenExpiresAt:  accessPayload.ExpiredAt,
+		RefreshToken:          refreshToken,
+		RefreshTokenExpiresAt: refreshPayload.ExpiredAt,
+		User:                  newUserResponse(user),
+	}
+	ctx.JSON(http.StatusOK, resp)
 }
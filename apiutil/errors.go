@@ -0,0 +1,103 @@
+package apiutil
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+
+	"github.com/go-playground/validator/v10"
+	db "github.com/leilei3167/bank/db/sqlc"
+	"github.com/leilei3167/bank/db/util"
+	"github.com/leilei3167/bank/token"
+	"github.com/lib/pq"
+	"golang.org/x/crypto/bcrypt"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+//HTTP和gRPC接口共用的错误和状态码映射,两边对同一个错误返回一致的状态
+//先按HTTP状态码分类,gRPC的状态码再由HTTP状态码换算,少数gRPC客户端需要区分的错误单独映射
+
+var (
+	ErrNotOwner         = errors.New("resource doesn't belong to the authenticated user")
+	ErrCurrencyMismatch = errors.New("currency doesn't match the account")
+)
+
+//余额不足,缺少汇率等是客户端的问题,其他错误(包括回滚)都是服务端的问题
+//账户在处理器检查之后、事务加锁之前被冻结时由事务返回冻结的错误
+//存取款和冲正也使用同样的规则
+func TransferErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, db.ErrAccountFrozen):
+		return http.StatusForbidden
+	case errors.Is(err, db.ErrInsufficientBalance),
+		errors.Is(err, db.ErrSystemAccount),
+		errors.Is(err, db.ErrExchangeRateNotFound),
+		errors.Is(err, util.ErrConvertedAmountZero):
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
+
+//所有已知错误对应的HTTP状态码,未知的错误为500
+func Status(err error) int {
+	var validationErrs validator.ValidationErrors
+	switch {
+	case err == sql.ErrNoRows:
+		return http.StatusNotFound
+	case errors.As(err, &validationErrs),
+		errors.Is(err, ErrCurrencyMismatch),
+		errors.Is(err, db.ErrRefundExceedsAmount),
+		errors.Is(err, db.ErrReverseReversal),
+		errors.Is(err, db.ErrStatementTooLarge):
+		return http.StatusBadRequest
+	case errors.Is(err, ErrNotOwner):
+		//凭证没有问题,只是没有权限,客户端不应该因此重新登录
+		return http.StatusForbidden
+	case errors.Is(err, token.ErrInvalidToken),
+		errors.Is(err, token.ErrExpiredToken),
+		errors.Is(err, bcrypt.ErrMismatchedHashAndPassword):
+		return http.StatusUnauthorized
+	case errors.Is(err, db.ErrIdempotencyKeyReused),
+		errors.Is(err, db.ErrTransferAlreadyReversed):
+		return http.StatusConflict
+	}
+
+	//不存在的用户等外键约束冲突为403,重复的用户名等唯一约束冲突为409
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		switch pqErr.Code.Name() {
+		case "foreign_key_violation":
+			return http.StatusForbidden
+		case "unique_violation":
+			return http.StatusConflict
+		}
+	}
+	return TransferErrorStatus(err)
+}
+
+//HTTP状态码对应的gRPC状态码
+func GRPCCode(httpStatus int) codes.Code {
+	switch httpStatus {
+	case http.StatusOK:
+		return codes.OK
+	case http.StatusBadRequest:
+		return codes.InvalidArgument
+	case http.StatusUnauthorized:
+		return codes.Unauthenticated
+	case http.StatusForbidden:
+		return codes.PermissionDenied
+	case http.StatusNotFound:
+		return codes.NotFound
+	case http.StatusConflict:
+		return codes.AlreadyExists
+	case http.StatusServiceUnavailable:
+		return codes.Unavailable
+	}
+	return codes.Internal
+}
+
+//把错误转换为gRPC的status,状态码和HTTP接口返回的一致
+func GRPCError(err error) error {
+	return status.Error(GRPCCode(Status(err)), err.Error())
+}
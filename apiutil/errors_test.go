@@ -0,0 +1,72 @@
+package apiutil
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	db "github.com/leilei3167/bank/db/sqlc"
+	"github.com/leilei3167/bank/token"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestStatus(t *testing.T) {
+	testCases := []struct {
+		name   string
+		err    error
+		status int
+		code   codes.Code
+	}{
+		{"NotFound", sql.ErrNoRows, http.StatusNotFound, codes.NotFound},
+		{"CurrencyMismatch", ErrCurrencyMismatch, http.StatusBadRequest, codes.InvalidArgument},
+		{"InsufficientBalance", fmt.Errorf("account [1]: %w", db.ErrInsufficientBalance), http.StatusBadRequest, codes.InvalidArgument},
+		{"NotOwner", fmt.Errorf("account [1]: %w", ErrNotOwner), http.StatusForbidden, codes.PermissionDenied},
+		{"ExpiredToken", token.ErrExpiredToken, http.StatusUnauthorized, codes.Unauthenticated},
+		{"Frozen", db.ErrAccountFrozen, http.StatusForbidden, codes.PermissionDenied},
+		{"SystemAccount", fmt.Errorf("account [1]: %w", db.ErrSystemAccount), http.StatusBadRequest, codes.InvalidArgument},
+		{"UniqueViolation", &pq.Error{Code: "23505"}, http.StatusConflict, codes.AlreadyExists},
+		{"ForeignKeyViolation", &pq.Error{Code: "23503"}, http.StatusForbidden, codes.PermissionDenied},
+		{"KeyReused", db.ErrIdempotencyKeyReused, http.StatusConflict, codes.AlreadyExists},
+		{"Unknown", errors.New("boom"), http.StatusInternalServerError, codes.Internal},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			require.Equal(t, tc.status, Status(tc.err))
+
+			st, ok := status.FromError(GRPCError(tc.err))
+			require.True(t, ok)
+			require.Equal(t, tc.code, st.Code())
+			require.Equal(t, tc.err.Error(), st.Message())
+		})
+	}
+}
+
+func TestGRPCCode(t *testing.T) {
+	require.Equal(t, codes.InvalidArgument, GRPCCode(http.StatusBadRequest))
+	require.Equal(t, codes.Unauthenticated, GRPCCode(http.StatusUnauthorized))
+	require.Equal(t, codes.PermissionDenied, GRPCCode(http.StatusForbidden))
+	require.Equal(t, codes.NotFound, GRPCCode(http.StatusNotFound))
+	require.Equal(t, codes.AlreadyExists, GRPCCode(http.StatusConflict))
+	require.Equal(t, codes.Internal, GRPCCode(http.StatusInternalServerError))
+}
+
+func TestValidateStruct(t *testing.T) {
+	type request struct {
+		Amount   int64  `binding:"required,gt=0"`
+		Currency string `binding:"required,currency"`
+	}
+
+	require.NoError(t, ValidateStruct(request{Amount: 1, Currency: "USD"}))
+
+	err := ValidateStruct(request{Amount: 1, Currency: "XYZ"})
+	require.Error(t, err)
+	require.Equal(t, http.StatusBadRequest, Status(err))
+}
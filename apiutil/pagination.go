@@ -0,0 +1,83 @@
+package apiutil
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+//游标分页的规则在HTTP和gRPC接口中相同,同一个游标可以在两种接口之间使用
+
+//配置中没有设置每页条数时使用的默认值
+const (
+	DefaultPageLimit int32 = 20
+	MaxPageLimit     int32 = 100
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+//游标分页的参数,AfterID为上一页最后一条记录的ID,第一页为0
+type CursorPage struct {
+	AfterID int64
+	Limit   int32
+}
+
+//解析游标和每页条数,limit为0时使用defaultLimit,defaultLimit和maxLimit为0时使用默认值
+func NewCursorPage(after string, limit, defaultLimit, maxLimit int32) (CursorPage, error) {
+	page := CursorPage{Limit: defaultLimit}
+	if page.Limit <= 0 {
+		page.Limit = DefaultPageLimit
+	}
+	if maxLimit <= 0 {
+		maxLimit = MaxPageLimit
+	}
+
+	if limit > 0 {
+		page.Limit = limit
+	}
+	if page.Limit > maxLimit {
+		return page, fmt.Errorf("limit must be at most %d", maxLimit)
+	}
+
+	if after != "" {
+		afterID, err := DecodePageCursor(after)
+		if err != nil {
+			return page, err
+		}
+		page.AfterID = afterID
+	}
+	return page, nil
+}
+
+//多查询一条用来判断是否还有下一页
+func (page CursorPage) QueryLimit() int32 {
+	return page.Limit + 1
+}
+
+//查询结果多于limit条时说明还有下一页,调用方截取前limit条,并用最后一条的ID生成下一页的游标
+func (page CursorPage) HasMore(count int) bool {
+	return count > int(page.Limit)
+}
+
+//游标的内容对客户端不透明,客户端只需要原样传回next_cursor
+type pageCursor struct {
+	ID int64 `json:"id"`
+}
+
+func EncodePageCursor(id int64) string {
+	data, _ := json.Marshal(pageCursor{ID: id})
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func DecodePageCursor(cursor string) (int64, error) {
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, ErrInvalidCursor
+	}
+	var c pageCursor
+	if err := json.Unmarshal(data, &c); err != nil || c.ID <= 0 {
+		return 0, ErrInvalidCursor
+	}
+	return c.ID, nil
+}
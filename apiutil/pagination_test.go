@@ -0,0 +1,43 @@
+package apiutil
+
+import (
+	"testing"
+
+	"github.com/leilei3167/bank/db/util"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPageCursor(t *testing.T) {
+	id := util.RandomInt(1, 1000)
+	cursor := EncodePageCursor(id)
+	require.NotEmpty(t, cursor)
+
+	got, err := DecodePageCursor(cursor)
+	require.NoError(t, err)
+	require.Equal(t, id, got)
+
+	for _, cursor := range []string{"not-base64!", "bm90LWpzb24", EncodePageCursor(0)} {
+		_, err := DecodePageCursor(cursor)
+		require.ErrorIs(t, err, ErrInvalidCursor)
+	}
+}
+
+func TestNewCursorPage(t *testing.T) {
+	//没有配置时使用默认值
+	page, err := NewCursorPage("", 0, 0, 0)
+	require.NoError(t, err)
+	require.Equal(t, CursorPage{Limit: DefaultPageLimit}, page)
+
+	page, err = NewCursorPage(EncodePageCursor(7), 3, 5, 8)
+	require.NoError(t, err)
+	require.Equal(t, CursorPage{AfterID: 7, Limit: 3}, page)
+	require.Equal(t, int32(4), page.QueryLimit())
+	require.True(t, page.HasMore(4))
+	require.False(t, page.HasMore(3))
+
+	_, err = NewCursorPage("", 9, 5, 8)
+	require.Error(t, err)
+
+	_, err = NewCursorPage("invalid", 0, 5, 8)
+	require.ErrorIs(t, err, ErrInvalidCursor)
+}
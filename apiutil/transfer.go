@@ -0,0 +1,31 @@
+package apiutil
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+)
+
+//幂等键的最大长度
+const MaxIdempotencyKeyLength = 255
+
+//与HTTP接口的转账请求体字段相同,保证同一个请求从两种接口发起得到相同的哈希
+type transferHashInput struct {
+	FromAccoutID int64  `json:"fromAccoutID,omitempty"`
+	ToAccountID  int64  `json:"toAccountID,omitempty"`
+	Amout        int64  `json:"amout,omitempty"`
+	Currency     string `json:"currency,omitempty"`
+}
+
+//转账请求的哈希,用于判断带有同一个幂等键的重试是否为同一个请求
+//结构体序列化时字段顺序固定,相同的请求得到相同的哈希
+func HashTransferRequest(fromAccountID, toAccountID, amount int64, currency string) string {
+	data, _ := json.Marshal(transferHashInput{
+		FromAccoutID: fromAccountID,
+		ToAccountID:  toAccountID,
+		Amout:        amount,
+		Currency:     currency,
+	})
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,37 @@
+package apiutil
+
+import (
+	"github.com/go-playground/validator/v10"
+	"github.com/leilei3167/bank/db/util"
+)
+
+//校验规则写在binding标签中,和gin的ShouldBind使用同样的标签
+const validatorTag = "binding"
+
+var validate = newValidator()
+
+func newValidator() *validator.Validate {
+	v := validator.New()
+	v.SetTagName(validatorTag)
+	RegisterValidations(v)
+	return v
+}
+
+//只接受已启用的货币,注册表的内容来自currencies表
+var ValidCurrency validator.Func = func(fl validator.FieldLevel) bool {
+	//Field返回的是反射值,将其转化为空接口后断言是否为string
+	if currency, ok := fl.Field().Interface().(string); ok {
+		return util.Currencies.IsEnabled(currency)
+	}
+	return false
+}
+
+//注册自定义的校验规则,gin的validator也通过它注册
+func RegisterValidations(v *validator.Validate) {
+	v.RegisterValidation("currency", ValidCurrency)
+}
+
+//按照binding标签校验结构体,gRPC的请求没有经过gin绑定,用它校验和HTTP接口相同的规则
+func ValidateStruct(s interface{}) error {
+	return validate.Struct(s)
+}
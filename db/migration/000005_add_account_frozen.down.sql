@@ -0,0 +1 @@
+ALTER TABLE IF EXISTS "accounts" DROP COLUMN IF EXISTS "is_frozen";
\ No newline at end of file
@@ -0,0 +1 @@
+ALTER TABLE "accounts" ADD COLUMN "is_frozen" boolean NOT NULL DEFAULT false;
\ No newline at end of file
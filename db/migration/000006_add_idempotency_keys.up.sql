@@ -0,0 +1,12 @@
+CREATE TABLE "idempotency_keys" (
+                                    "username" varchar NOT NULL,
+                                    "key" varchar NOT NULL,
+                                    "request_hash" varchar NOT NULL,
+                                    "response" jsonb NOT NULL DEFAULT '{}',
+                                    "created_at" timestamptz NOT NULL DEFAULT (now()),
+                                    PRIMARY KEY ("username", "key")
+);
+
+ALTER TABLE "idempotency_keys" ADD FOREIGN KEY ("username") REFERENCES "users" ("username");
+
+COMMENT ON COLUMN "idempotency_keys"."response" IS 'serialized result of the original request';
\ No newline at end of file
@@ -0,0 +1,24 @@
+CREATE TABLE "exchange_rates" (
+                                  "id" bigserial PRIMARY KEY,
+                                  "base_currency" varchar NOT NULL,
+                                  "quote_currency" varchar NOT NULL,
+                                  "rate" numeric(20,10) NOT NULL CHECK ("rate" > 0),
+                                  "effective_from" timestamptz NOT NULL,
+                                  "created_at" timestamptz NOT NULL DEFAULT (now())
+);
+
+CREATE INDEX ON "exchange_rates" ("base_currency", "quote_currency", "effective_from");
+
+COMMENT ON COLUMN "exchange_rates"."rate" IS 'units of quote currency per unit of base currency';
+
+ALTER TABLE "transfers" ADD COLUMN "credited_amount" bigint;
+
+UPDATE "transfers" SET "credited_amount" = "amount";
+
+ALTER TABLE "transfers" ALTER COLUMN "credited_amount" SET NOT NULL;
+
+ALTER TABLE "transfers" ADD COLUMN "exchange_rate" numeric(20,10) NOT NULL DEFAULT 1;
+
+COMMENT ON COLUMN "transfers"."credited_amount" IS 'amount credited to the destination account, in its currency';
+
+COMMENT ON COLUMN "transfers"."exchange_rate" IS 'rate applied to convert amount into credited_amount';
\ No newline at end of file
@@ -0,0 +1,22 @@
+CREATE TABLE "currencies" (
+                              "code" varchar(3) PRIMARY KEY,
+                              "exponent" integer NOT NULL CHECK ("exponent" >= 0),
+                              "symbol" varchar NOT NULL,
+                              "enabled" boolean NOT NULL DEFAULT true,
+                              "created_at" timestamptz NOT NULL DEFAULT (now())
+);
+
+COMMENT ON COLUMN "currencies"."exponent" IS 'number of minor units digits, e.g. 2 means 1 USD = 100 cents';
+
+INSERT INTO "currencies" ("code", "exponent", "symbol") VALUES
+    ('USD', 2, '$'),
+    ('EUR', 2, '€'),
+    ('RMB', 2, '¥');
+
+ALTER TABLE "accounts" ADD FOREIGN KEY ("currency") REFERENCES "currencies" ("code");
+
+ALTER TABLE "exchange_rates" ADD FOREIGN KEY ("base_currency") REFERENCES "currencies" ("code");
+
+ALTER TABLE "exchange_rates" ADD FOREIGN KEY ("quote_currency") REFERENCES "currencies" ("code");
+
+COMMENT ON COLUMN "accounts"."balance" IS 'in minor units of currency';
\ No newline at end of file
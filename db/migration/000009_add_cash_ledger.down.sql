@@ -0,0 +1,5 @@
+DELETE FROM "entries" WHERE "account_id" IN (SELECT "id" FROM "accounts" WHERE "owner" = 'bank_cash');
+
+DELETE FROM "accounts" WHERE "owner" = 'bank_cash';
+
+DELETE FROM "users" WHERE "username" = 'bank_cash';
\ No newline at end of file
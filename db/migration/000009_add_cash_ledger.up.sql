@@ -0,0 +1,3 @@
+-- 系统内部的用户,持有每种货币的现金清算账户,用户名带下划线,不会和注册的用户冲突
+INSERT INTO "users" ("username", "hashed_password", "full_name", "email", "role")
+VALUES ('bank_cash', '', 'Cash clearing', 'cash@bank.internal', 'system');
\ No newline at end of file
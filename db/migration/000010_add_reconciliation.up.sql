@@ -0,0 +1,18 @@
+ALTER TABLE "entries" ADD COLUMN "transfer_id" bigint;
+
+ALTER TABLE "entries" ADD FOREIGN KEY ("transfer_id") REFERENCES "transfers" ("id");
+
+CREATE INDEX ON "entries" ("transfer_id");
+
+COMMENT ON COLUMN "entries"."transfer_id" IS 'transfer that produced this entry, null for cash movements and entries written before this column existed';
+
+CREATE TABLE "reconciliation_runs" (
+                                       "id" bigserial PRIMARY KEY,
+                                       "has_drift" boolean NOT NULL,
+                                       "report" jsonb NOT NULL,
+                                       "started_at" timestamptz NOT NULL,
+                                       "finished_at" timestamptz NOT NULL,
+                                       "created_at" timestamptz NOT NULL DEFAULT (now())
+);
+
+COMMENT ON COLUMN "reconciliation_runs"."report" IS 'serialized reconciliation report';
\ No newline at end of file
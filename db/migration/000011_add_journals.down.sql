@@ -0,0 +1,15 @@
+DROP TRIGGER IF EXISTS "entries_journal_balanced" ON "entries";
+
+DROP FUNCTION IF EXISTS "check_journal_balanced"();
+
+DELETE FROM "entries" WHERE "account_id" IN (SELECT "id" FROM "accounts" WHERE "owner" IN ('bank_fx', 'bank_fees'));
+
+DELETE FROM "accounts" WHERE "owner" IN ('bank_fx', 'bank_fees');
+
+DELETE FROM "users" WHERE "username" IN ('bank_fx', 'bank_fees');
+
+ALTER TABLE "transfers" DROP COLUMN IF EXISTS "fee";
+
+ALTER TABLE "entries" DROP COLUMN IF EXISTS "journal_id";
+
+DROP TABLE IF EXISTS "journals";
\ No newline at end of file
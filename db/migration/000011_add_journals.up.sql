@@ -0,0 +1,53 @@
+CREATE TABLE "journals" (
+                            "id" bigserial PRIMARY KEY,
+                            "kind" varchar NOT NULL,
+                            "transfer_id" bigint,
+                            "created_at" timestamptz NOT NULL DEFAULT (now())
+);
+
+ALTER TABLE "journals" ADD FOREIGN KEY ("transfer_id") REFERENCES "transfers" ("id");
+
+CREATE INDEX ON "journals" ("transfer_id");
+
+COMMENT ON COLUMN "journals"."kind" IS 'transfer, deposit or withdrawal';
+
+ALTER TABLE "entries" ADD COLUMN "journal_id" bigint;
+
+ALTER TABLE "entries" ADD FOREIGN KEY ("journal_id") REFERENCES "journals" ("id");
+
+CREATE INDEX ON "entries" ("journal_id");
+
+COMMENT ON COLUMN "entries"."journal_id" IS 'journal this posting belongs to, null for entries written before journals existed';
+
+ALTER TABLE "transfers" ADD COLUMN "fee" bigint NOT NULL DEFAULT 0 CHECK ("fee" >= 0);
+
+COMMENT ON COLUMN "transfers"."fee" IS 'fee charged to the source account, in its currency';
+
+-- 同一个日记账下的分录按币种合计必须为0,在事务提交时检查,允许先写入部分分录
+CREATE FUNCTION "check_journal_balanced"() RETURNS trigger AS $$
+BEGIN
+    IF EXISTS (
+        SELECT 1
+        FROM "entries" e
+        JOIN "accounts" a ON a."id" = e."account_id"
+        WHERE e."journal_id" = NEW."journal_id"
+        GROUP BY a."currency"
+        HAVING SUM(e."amount") <> 0
+    ) THEN
+        RAISE EXCEPTION 'journal % is not balanced', NEW."journal_id" USING ERRCODE = 'check_violation';
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE CONSTRAINT TRIGGER "entries_journal_balanced"
+    AFTER INSERT OR UPDATE ON "entries"
+    DEFERRABLE INITIALLY DEFERRED
+    FOR EACH ROW
+    WHEN (NEW."journal_id" IS NOT NULL)
+    EXECUTE PROCEDURE "check_journal_balanced"();
+
+-- 跨币种转账经过外汇清算账户,手续费记入手续费收入账户,账户在第一次使用时创建
+INSERT INTO "users" ("username", "hashed_password", "full_name", "email", "role") VALUES
+    ('bank_fx', '', 'FX clearing', 'fx@bank.internal', 'system'),
+    ('bank_fees', '', 'Fee income', 'fees@bank.internal', 'system');
\ No newline at end of file
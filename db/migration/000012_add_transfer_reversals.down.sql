@@ -0,0 +1,3 @@
+COMMENT ON COLUMN "journals"."kind" IS 'transfer, deposit or withdrawal';
+
+ALTER TABLE "transfers" DROP COLUMN IF EXISTS "reversal_of";
\ No newline at end of file
@@ -0,0 +1,9 @@
+ALTER TABLE "transfers" ADD COLUMN "reversal_of" bigint;
+
+ALTER TABLE "transfers" ADD FOREIGN KEY ("reversal_of") REFERENCES "transfers" ("id");
+
+CREATE INDEX ON "transfers" ("reversal_of");
+
+COMMENT ON COLUMN "transfers"."reversal_of" IS 'original transfer this one refunds, in whole or in part';
+
+COMMENT ON COLUMN "journals"."kind" IS 'transfer, reversal, deposit or withdrawal';
\ No newline at end of file
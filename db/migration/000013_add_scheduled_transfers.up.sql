@@ -0,0 +1,45 @@
+CREATE TABLE "scheduled_transfers" (
+                                       "id" bigserial PRIMARY KEY,
+                                       "owner" varchar NOT NULL,
+                                       "from_account_id" bigint NOT NULL,
+                                       "to_account_id" bigint NOT NULL,
+                                       "amount" bigint NOT NULL CHECK ("amount" > 0),
+                                       "recurrence" varchar NOT NULL CHECK ("recurrence" IN ('once', 'daily', 'weekly', 'monthly')),
+                                       "status" varchar NOT NULL DEFAULT 'active' CHECK ("status" IN ('active', 'completed', 'cancelled')),
+                                       "starts_at" timestamptz NOT NULL,
+                                       "next_run_at" timestamptz NOT NULL,
+                                       "last_run_at" timestamptz,
+                                       "created_at" timestamptz NOT NULL DEFAULT (now())
+);
+
+ALTER TABLE "scheduled_transfers" ADD FOREIGN KEY ("owner") REFERENCES "users" ("username");
+
+ALTER TABLE "scheduled_transfers" ADD FOREIGN KEY ("from_account_id") REFERENCES "accounts" ("id");
+
+ALTER TABLE "scheduled_transfers" ADD FOREIGN KEY ("to_account_id") REFERENCES "accounts" ("id");
+
+CREATE INDEX ON "scheduled_transfers" ("owner");
+
+CREATE INDEX ON "scheduled_transfers" ("next_run_at") WHERE "status" = 'active';
+
+COMMENT ON COLUMN "scheduled_transfers"."amount" IS 'in the currency of the from account';
+
+COMMENT ON COLUMN "scheduled_transfers"."starts_at" IS 'first run or the last rescheduled run, monthly transfers keep its day of month';
+
+CREATE TABLE "scheduled_transfer_runs" (
+                                           "id" bigserial PRIMARY KEY,
+                                           "scheduled_transfer_id" bigint NOT NULL,
+                                           "transfer_id" bigint,
+                                           "status" varchar NOT NULL CHECK ("status" IN ('succeeded', 'failed')),
+                                           "error" varchar NOT NULL DEFAULT '',
+                                           "scheduled_for" timestamptz NOT NULL,
+                                           "created_at" timestamptz NOT NULL DEFAULT (now())
+);
+
+ALTER TABLE "scheduled_transfer_runs" ADD FOREIGN KEY ("scheduled_transfer_id") REFERENCES "scheduled_transfers" ("id");
+
+ALTER TABLE "scheduled_transfer_runs" ADD FOREIGN KEY ("transfer_id") REFERENCES "transfers" ("id");
+
+CREATE INDEX ON "scheduled_transfer_runs" ("scheduled_transfer_id");
+
+COMMENT ON COLUMN "scheduled_transfer_runs"."transfer_id" IS 'null when the run failed';
\ No newline at end of file
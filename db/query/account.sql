@@ -10,6 +10,11 @@ currency
 select * from accounts
 where "id" =$1 limit 1;
 
+-- name: GetAccountByOwnerAndCurrency :one
+SELECT * FROM accounts
+WHERE owner = $1 AND currency = $2
+LIMIT 1;
+
 -- name: GetAccountForUpdate :one
 select * from accounts
 where "id" =$1 limit 1
@@ -23,10 +28,35 @@ ORDER BY id
 LIMIT $1
 OFFSET $2;
 
+-- name: ListAccountsByOwner :many
+SELECT * FROM accounts
+WHERE owner = $1
+ORDER BY id
+LIMIT $2
+OFFSET $3;
+
+-- name: ListAccountsAfter :many
+SELECT * FROM accounts
+WHERE id > sqlc.arg(after_id)
+ORDER BY id
+LIMIT sqlc.arg(limit_count);
+
+-- name: ListAccountsByOwnerAfter :many
+SELECT * FROM accounts
+WHERE owner = sqlc.arg(owner) AND id > sqlc.arg(after_id)
+ORDER BY id
+LIMIT sqlc.arg(limit_count);
+
 -- name: UpadateAccount :one
 update accounts set balance=$2
 where "id"=$1 returning *;
 
+-- name: SetAccountFrozen :one
+UPDATE accounts
+SET is_frozen = $2
+WHERE id = $1
+RETURNING *;
+
 -- name: AddAccountBalance :one
 UPDATE accounts
 SET balance=balance + sqlc.arg(amount)
@@ -34,6 +64,15 @@ WHERE id = sqlc.arg(id)
 RETURNING *;
 
 
+-- name: EnsureAccount :exec
+INSERT INTO accounts (
+    owner,
+    balance,
+    currency
+) VALUES (
+    $1, 0, $2
+) ON CONFLICT (owner, currency) DO NOTHING;
+
 -- name: DeleteAccounts :exec
 delete from accounts
 where "id"=$1;
\ No newline at end of file
@@ -1,9 +1,11 @@
 -- name: CreateEntry :one
 INSERT INTO entries (
   account_id,
-  amount
+  amount,
+  transfer_id,
+  journal_id
 ) VALUES (
-  $1, $2
+  $1, $2, $3, $4
 ) RETURNING *;
 
 -- name: GetEntry :one
@@ -15,4 +17,40 @@ SELECT * FROM entries
 WHERE account_id = $1
 ORDER BY id
 LIMIT $2
-OFFSET $3;
\ No newline at end of file
+OFFSET $3;
+
+-- name: ListEntriesByJournal :many
+SELECT * FROM entries
+WHERE journal_id = $1
+ORDER BY id;
+
+-- name: ListEntriesByTime :many
+SELECT * FROM entries
+WHERE account_id = sqlc.arg(account_id)
+  AND created_at >= sqlc.arg(from_time)
+  AND created_at < sqlc.arg(to_time)
+  AND (sqlc.arg(after_id)::bigint = 0
+    OR (created_at, id) > (SELECT e.created_at, e.id FROM entries e WHERE e.id = sqlc.arg(after_id) AND e.account_id = sqlc.arg(account_id)))
+ORDER BY created_at, id
+LIMIT sqlc.arg(limit_count)
+OFFSET sqlc.arg(offset_count);
+
+-- name: SumEntryAmountsAfter :one
+SELECT COALESCE(SUM(amount), 0)::bigint AS total
+FROM entries
+WHERE account_id = sqlc.arg(account_id)
+  AND (created_at, id) > (sqlc.arg(created_at)::timestamptz, sqlc.arg(id)::bigint);
+
+-- name: SumEntryAmountsSince :one
+SELECT COALESCE(SUM(amount), 0)::bigint AS total
+FROM entries
+WHERE account_id = $1 AND created_at >= $2;
+
+-- name: SumEntryAmountsInRange :one
+SELECT
+    COALESCE(SUM(amount) FILTER (WHERE amount > 0), 0)::bigint AS total_in,
+    COALESCE(-SUM(amount) FILTER (WHERE amount < 0), 0)::bigint AS total_out
+FROM entries
+WHERE account_id = sqlc.arg(account_id)
+  AND created_at >= sqlc.arg(from_time)
+  AND created_at < sqlc.arg(to_time);
\ No newline at end of file
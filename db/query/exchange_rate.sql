@@ -0,0 +1,25 @@
+-- name: CreateExchangeRate :one
+INSERT INTO exchange_rates (
+    base_currency,
+    quote_currency,
+    rate,
+    effective_from
+) VALUES (
+             $1, $2, $3, $4
+         ) RETURNING *;
+
+-- name: GetExchangeRate :one
+SELECT * FROM exchange_rates
+WHERE base_currency = $1
+  AND quote_currency = $2
+  AND effective_from <= sqlc.arg(at)
+ORDER BY effective_from DESC, id DESC
+LIMIT 1;
+
+-- name: ListExchangeRates :many
+SELECT * FROM exchange_rates
+WHERE base_currency = $1
+  AND quote_currency = $2
+ORDER BY effective_from DESC, id DESC
+LIMIT $3
+OFFSET $4;
\ No newline at end of file
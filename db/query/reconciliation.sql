@@ -0,0 +1,45 @@
+-- name: ListAccountEntryTotals :many
+SELECT
+    a.id,
+    a.currency,
+    a.balance,
+    COALESCE(SUM(e.amount), 0)::bigint AS entries_total
+FROM accounts a
+LEFT JOIN entries e ON e.account_id = a.id
+WHERE a.id > sqlc.arg(after_id)
+GROUP BY a.id
+ORDER BY a.id
+LIMIT sqlc.arg(limit_count);
+
+-- name: ListTransferEntryTotals :many
+SELECT
+    t.id,
+    t.from_account_id,
+    t.to_account_id,
+    t.amount,
+    t.credited_amount,
+    t.fee,
+    COUNT(e.id) AS entry_count,
+    COALESCE(SUM(e.amount) FILTER (WHERE e.account_id = t.from_account_id), 0)::bigint AS from_entries_total,
+    COALESCE(SUM(e.amount) FILTER (WHERE e.account_id = t.to_account_id), 0)::bigint AS to_entries_total
+FROM transfers t
+LEFT JOIN entries e ON e.transfer_id = t.id
+WHERE t.id > sqlc.arg(after_id)
+GROUP BY t.id
+ORDER BY t.id
+LIMIT sqlc.arg(limit_count);
+
+-- name: CreateReconciliationRun :one
+INSERT INTO reconciliation_runs (
+    has_drift,
+    report,
+    started_at,
+    finished_at
+) VALUES (
+    $1, $2, $3, $4
+) RETURNING *;
+
+-- name: GetLatestReconciliationRun :one
+SELECT * FROM reconciliation_runs
+ORDER BY id DESC
+LIMIT 1;
\ No newline at end of file
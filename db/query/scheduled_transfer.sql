@@ -0,0 +1,79 @@
+-- name: CreateScheduledTransfer :one
+INSERT INTO scheduled_transfers (
+    owner,
+    from_account_id,
+    to_account_id,
+    amount,
+    recurrence,
+    starts_at,
+    next_run_at
+) VALUES (
+    $1, $2, $3, $4, $5, $6, $6
+) RETURNING *;
+
+-- name: GetScheduledTransfer :one
+SELECT * FROM scheduled_transfers
+WHERE id = $1 LIMIT 1;
+
+-- name: ListScheduledTransfersByOwner :many
+SELECT * FROM scheduled_transfers
+WHERE owner = sqlc.arg(owner)
+  AND id > sqlc.arg(after_id)
+ORDER BY id
+LIMIT sqlc.arg(limit_count);
+
+-- name: UpdateScheduledTransfer :one
+UPDATE scheduled_transfers
+SET amount = COALESCE(sqlc.narg(amount), amount),
+    recurrence = COALESCE(sqlc.narg(recurrence), recurrence),
+    next_run_at = COALESCE(sqlc.narg(next_run_at), next_run_at),
+    starts_at = COALESCE(sqlc.narg(next_run_at), starts_at)
+WHERE id = sqlc.arg(id) AND status = 'active'
+RETURNING *;
+
+-- name: CancelScheduledTransfer :one
+UPDATE scheduled_transfers
+SET status = 'cancelled'
+WHERE id = $1 AND status = 'active'
+RETURNING *;
+
+-- name: ClaimDueScheduledTransfer :one
+SELECT * FROM scheduled_transfers
+WHERE status = 'active' AND next_run_at <= $1
+ORDER BY next_run_at
+LIMIT 1
+FOR UPDATE SKIP LOCKED;
+
+-- name: AdvanceScheduledTransfer :one
+UPDATE scheduled_transfers
+SET next_run_at = $2,
+    status = $3,
+    last_run_at = $4
+WHERE id = $1
+RETURNING *;
+
+-- name: RetryScheduledTransfer :one
+UPDATE scheduled_transfers
+SET next_run_at = sqlc.arg(retry_at)
+WHERE id = sqlc.arg(id)
+  AND status = 'active'
+  AND next_run_at = sqlc.arg(next_run_at)
+RETURNING *;
+
+-- name: CreateScheduledTransferRun :one
+INSERT INTO scheduled_transfer_runs (
+    scheduled_transfer_id,
+    transfer_id,
+    status,
+    error,
+    scheduled_for
+) VALUES (
+    $1, $2, $3, $4, $5
+) RETURNING *;
+
+-- name: ListScheduledTransferRuns :many
+SELECT * FROM scheduled_transfer_runs
+WHERE scheduled_transfer_id = sqlc.arg(scheduled_transfer_id)
+  AND id > sqlc.arg(after_id)
+ORDER BY id
+LIMIT sqlc.arg(limit_count);
\ No newline at end of file
@@ -2,18 +2,44 @@
 insert into transfers(
     from_account_id,
     to_account_id,
-    amount
-)values($1,$2,$3)returning *;
+    amount,
+    credited_amount,
+    exchange_rate,
+    fee,
+    reversal_of
+)values($1,$2,$3,$4,$5,$6,$7)returning *;
 
 -- name: GetTransfer :one
 SELECT * FROM transfers
 WHERE "id" = $1 LIMIT 1;
 
+-- name: GetTransferForUpdate :one
+SELECT * FROM transfers
+WHERE "id" = $1 LIMIT 1
+FOR NO KEY UPDATE;
+
+-- name: SumTransferReversals :one
+SELECT
+    COALESCE(SUM(amount), 0)::bigint AS debited_amount,
+    COALESCE(SUM(credited_amount), 0)::bigint AS refunded_amount
+FROM transfers
+WHERE reversal_of = $1;
+
 -- name: ListTransfers :many
 SELECT * FROM transfers
-WHERE 
-    from_account_id = $1 OR
-    to_account_id = $2
+WHERE (from_account_id = sqlc.arg(account_id) OR to_account_id = sqlc.arg(account_id))
+  AND (sqlc.narg(direction)::varchar IS NULL
+    OR (sqlc.narg(direction) = 'outgoing' AND from_account_id = sqlc.arg(account_id))
+    OR (sqlc.narg(direction) = 'incoming' AND to_account_id = sqlc.arg(account_id)))
+  AND (sqlc.narg(counterparty_id)::bigint IS NULL
+    OR (CASE WHEN from_account_id = sqlc.arg(account_id) THEN to_account_id ELSE from_account_id END) = sqlc.narg(counterparty_id))
+  AND (sqlc.narg(min_amount)::bigint IS NULL
+    OR (CASE WHEN from_account_id = sqlc.arg(account_id) THEN amount ELSE credited_amount END) >= sqlc.narg(min_amount))
+  AND (sqlc.narg(max_amount)::bigint IS NULL
+    OR (CASE WHEN from_account_id = sqlc.arg(account_id) THEN amount ELSE credited_amount END) <= sqlc.narg(max_amount))
+  AND (sqlc.narg(from_time)::timestamptz IS NULL OR created_at >= sqlc.narg(from_time))
+  AND (sqlc.narg(to_time)::timestamptz IS NULL OR created_at < sqlc.narg(to_time))
+  AND id > sqlc.arg(after_id)
 ORDER BY id
-LIMIT $3
-OFFSET $4;
\ No newline at end of file
+LIMIT sqlc.arg(limit_count)
+OFFSET sqlc.arg(offset_count);
\ No newline at end of file
@@ -11,7 +11,7 @@ const addAccountBalance = `-- name: AddAccountBalance :one
 UPDATE accounts
 SET balance=balance + $1
 WHERE id = $2
-RETURNING id, owner, balance, currency, created_at
+RETURNING id, owner, balance, currency, created_at, is_frozen
 `
 
 type AddAccountBalanceParams struct {
@@ -28,6 +28,7 @@ func (q *Queries) AddAccountBalance(ctx context.Context, arg AddAccountBalancePa
 		&i.Balance,
 		&i.Currency,
 		&i.CreatedAt,
+		&i.IsFrozen,
 	)
 	return i, err
 }
@@ -38,7 +39,7 @@ owner,
 balance,
 currency
 
-)values($1,$2,$3) returning id, owner, balance, currency, created_at
+)values($1,$2,$3) returning id, owner, balance, currency, created_at, is_frozen
 `
 
 type CreateAccountParams struct {
@@ -56,6 +57,7 @@ func (q *Queries) CreateAccount(ctx context.Context, arg CreateAccountParams) (A
 		&i.Balance,
 		&i.Currency,
 		&i.CreatedAt,
+		&i.IsFrozen,
 	)
 	return i, err
 }
@@ -70,8 +72,28 @@ func (q *Queries) DeleteAccounts(ctx context.Context, id int64) error {
 	return err
 }
 
+const ensureAccount = `-- name: EnsureAccount :exec
+INSERT INTO accounts (
+    owner,
+    balance,
+    currency
+) VALUES (
+    $1, 0, $2
+) ON CONFLICT (owner, currency) DO NOTHING
+`
+
+type EnsureAccountParams struct {
+	Owner    string `json:"owner"`
+	Currency string `json:"currency"`
+}
+
+func (q *Queries) EnsureAccount(ctx context.Context, arg EnsureAccountParams) error {
+	_, err := q.db.ExecContext(ctx, ensureAccount, arg.Owner, arg.Currency)
+	return err
+}
+
 const getAccount = `-- name: GetAccount :one
-select id, owner, balance, currency, created_at from accounts
+select id, owner, balance, currency, created_at, is_frozen from accounts
 where "id" =$1 limit 1
 `
 
@@ -84,12 +106,38 @@ func (q *Queries) GetAccount(ctx context.Context, id int64) (Account, error) {
 		&i.Balance,
 		&i.Currency,
 		&i.CreatedAt,
+		&i.IsFrozen,
+	)
+	return i, err
+}
+
+const getAccountByOwnerAndCurrency = `-- name: GetAccountByOwnerAndCurrency :one
+SELECT id, owner, balance, currency, created_at, is_frozen FROM accounts
+WHERE owner = $1 AND currency = $2
+LIMIT 1
+`
+
+type GetAccountByOwnerAndCurrencyParams struct {
+	Owner    string `json:"owner"`
+	Currency string `json:"currency"`
+}
+
+func (q *Queries) GetAccountByOwnerAndCurrency(ctx context.Context, arg GetAccountByOwnerAndCurrencyParams) (Account, error) {
+	row := q.db.QueryRowContext(ctx, getAccountByOwnerAndCurrency, arg.Owner, arg.Currency)
+	var i Account
+	err := row.Scan(
+		&i.ID,
+		&i.Owner,
+		&i.Balance,
+		&i.Currency,
+		&i.CreatedAt,
+		&i.IsFrozen,
 	)
 	return i, err
 }
 
 const getAccountForUpdate = `-- name: GetAccountForUpdate :one
-select id, owner, balance, currency, created_at from accounts
+select id, owner, balance, currency, created_at, is_frozen from accounts
 where "id" =$1 limit 1
 FOR NO KEY UPDATE
 `
@@ -103,12 +151,13 @@ func (q *Queries) GetAccountForUpdate(ctx context.Context, id int64) (Account, e
 		&i.Balance,
 		&i.Currency,
 		&i.CreatedAt,
+		&i.IsFrozen,
 	)
 	return i, err
 }
 
 const listAccounts = `-- name: ListAccounts :many
-SELECT id, owner, balance, currency, created_at FROM accounts
+SELECT id, owner, balance, currency, created_at, is_frozen FROM accounts
 ORDER BY id
 LIMIT $1
 OFFSET $2
@@ -134,6 +183,93 @@ func (q *Queries) ListAccounts(ctx context.Context, arg ListAccountsParams) ([]A
 			&i.Balance,
 			&i.Currency,
 			&i.CreatedAt,
+			&i.IsFrozen,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listAccountsAfter = `-- name: ListAccountsAfter :many
+SELECT id, owner, balance, currency, created_at, is_frozen FROM accounts
+WHERE id > $1
+ORDER BY id
+LIMIT $2
+`
+
+type ListAccountsAfterParams struct {
+	AfterID    int64 `json:"after_id"`
+	LimitCount int32 `json:"limit_count"`
+}
+
+func (q *Queries) ListAccountsAfter(ctx context.Context, arg ListAccountsAfterParams) ([]Account, error) {
+	rows, err := q.db.QueryContext(ctx, listAccountsAfter, arg.AfterID, arg.LimitCount)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []Account{}
+	for rows.Next() {
+		var i Account
+		if err := rows.Scan(
+			&i.ID,
+			&i.Owner,
+			&i.Balance,
+			&i.Currency,
+			&i.CreatedAt,
+			&i.IsFrozen,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listAccountsByOwner = `-- name: ListAccountsByOwner :many
+SELECT id, owner, balance, currency, created_at, is_frozen FROM accounts
+WHERE owner = $1
+ORDER BY id
+LIMIT $2
+OFFSET $3
+`
+
+type ListAccountsByOwnerParams struct {
+	Owner  string `json:"owner"`
+	Limit  int32  `json:"limit"`
+	Offset int32  `json:"offset"`
+}
+
+func (q *Queries) ListAccountsByOwner(ctx context.Context, arg ListAccountsByOwnerParams) ([]Account, error) {
+	rows, err := q.db.QueryContext(ctx, listAccountsByOwner, arg.Owner, arg.Limit, arg.Offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []Account{}
+	for rows.Next() {
+		var i Account
+		if err := rows.Scan(
+			&i.ID,
+			&i.Owner,
+			&i.Balance,
+			&i.Currency,
+			&i.CreatedAt,
+			&i.IsFrozen,
 		); err != nil {
 			return nil, err
 		}
@@ -148,9 +284,78 @@ func (q *Queries) ListAccounts(ctx context.Context, arg ListAccountsParams) ([]A
 	return items, nil
 }
 
+const listAccountsByOwnerAfter = `-- name: ListAccountsByOwnerAfter :many
+SELECT id, owner, balance, currency, created_at, is_frozen FROM accounts
+WHERE owner = $1 AND id > $2
+ORDER BY id
+LIMIT $3
+`
+
+type ListAccountsByOwnerAfterParams struct {
+	Owner      string `json:"owner"`
+	AfterID    int64  `json:"after_id"`
+	LimitCount int32  `json:"limit_count"`
+}
+
+func (q *Queries) ListAccountsByOwnerAfter(ctx context.Context, arg ListAccountsByOwnerAfterParams) ([]Account, error) {
+	rows, err := q.db.QueryContext(ctx, listAccountsByOwnerAfter, arg.Owner, arg.AfterID, arg.LimitCount)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []Account{}
+	for rows.Next() {
+		var i Account
+		if err := rows.Scan(
+			&i.ID,
+			&i.Owner,
+			&i.Balance,
+			&i.Currency,
+			&i.CreatedAt,
+			&i.IsFrozen,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const setAccountFrozen = `-- name: SetAccountFrozen :one
+UPDATE accounts
+SET is_frozen = $2
+WHERE id = $1
+RETURNING id, owner, balance, currency, created_at, is_frozen
+`
+
+type SetAccountFrozenParams struct {
+	ID       int64 `json:"id"`
+	IsFrozen bool  `json:"is_frozen"`
+}
+
+func (q *Queries) SetAccountFrozen(ctx context.Context, arg SetAccountFrozenParams) (Account, error) {
+	row := q.db.QueryRowContext(ctx, setAccountFrozen, arg.ID, arg.IsFrozen)
+	var i Account
+	err := row.Scan(
+		&i.ID,
+		&i.Owner,
+		&i.Balance,
+		&i.Currency,
+		&i.CreatedAt,
+		&i.IsFrozen,
+	)
+	return i, err
+}
+
 const upadateAccount = `-- name: UpadateAccount :one
 update accounts set balance=$2
-where "id"=$1 returning id, owner, balance, currency, created_at
+where "id"=$1 returning id, owner, balance, currency, created_at, is_frozen
 `
 
 type UpadateAccountParams struct {
@@ -167,6 +372,7 @@ func (q *Queries) UpadateAccount(ctx context.Context, arg UpadateAccountParams)
 		&i.Balance,
 		&i.Currency,
 		&i.CreatedAt,
+		&i.IsFrozen,
 	)
 	return i, err
 }
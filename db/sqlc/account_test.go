@@ -115,3 +115,93 @@ func TestListAccounts(t *testing.T) {
 	}
 
 }
+
+//只返回指定owner的账户
+func TestListAccountsByOwner(t *testing.T) {
+	var lastAccount Account
+	for i := 0; i < 10; i++ {
+		lastAccount = createRandomAccount(t)
+	}
+
+	arg := ListAccountsByOwnerParams{
+		Owner:  lastAccount.Owner,
+		Limit:  5,
+		Offset: 0,
+	}
+	accounts, err := testQueries.ListAccountsByOwner(context.Background(), arg)
+	require.NoError(t, err)
+	require.NotEmpty(t, accounts)
+
+	for _, account := range accounts {
+		require.NotEmpty(t, account)
+		require.Equal(t, lastAccount.Owner, account.Owner)
+	}
+}
+
+//按id做键集分页,第二页从第一页最后一个账户之后开始
+func TestListAccountsAfter(t *testing.T) {
+	for i := 0; i < 4; i++ {
+		createRandomAccount(t)
+	}
+
+	firstPage, err := testQueries.ListAccountsAfter(context.Background(), ListAccountsAfterParams{
+		AfterID:    0,
+		LimitCount: 2,
+	})
+	require.NoError(t, err)
+	require.Len(t, firstPage, 2)
+	require.Less(t, firstPage[0].ID, firstPage[1].ID)
+
+	secondPage, err := testQueries.ListAccountsAfter(context.Background(), ListAccountsAfterParams{
+		AfterID:    firstPage[1].ID,
+		LimitCount: 2,
+	})
+	require.NoError(t, err)
+	require.Len(t, secondPage, 2)
+	require.Greater(t, secondPage[0].ID, firstPage[1].ID)
+}
+
+func TestListAccountsByOwnerAfter(t *testing.T) {
+	account1 := createRandomAccount(t)
+	//同一个用户的另一个币种的账户
+	currency := util.USD
+	if account1.Currency == util.USD {
+		currency = util.EUR
+	}
+	account2, err := testQueries.CreateAccount(context.Background(), CreateAccountParams{
+		Owner:    account1.Owner,
+		Balance:  0,
+		Currency: currency,
+	})
+	require.NoError(t, err)
+
+	accounts, err := testQueries.ListAccountsByOwnerAfter(context.Background(), ListAccountsByOwnerAfterParams{
+		Owner:      account1.Owner,
+		AfterID:    account1.ID,
+		LimitCount: 5,
+	})
+	require.NoError(t, err)
+	require.Len(t, accounts, 1)
+	require.Equal(t, account2.ID, accounts[0].ID)
+}
+
+//冻结和解冻账户
+func TestSetAccountFrozen(t *testing.T) {
+	account1 := createRandomAccount(t)
+	require.False(t, account1.IsFrozen)
+
+	account2, err := testQueries.SetAccountFrozen(context.Background(), SetAccountFrozenParams{
+		ID:       account1.ID,
+		IsFrozen: true,
+	})
+	require.NoError(t, err)
+	require.Equal(t, account1.ID, account2.ID)
+	require.True(t, account2.IsFrozen)
+
+	account3, err := testQueries.SetAccountFrozen(context.Background(), SetAccountFrozenParams{
+		ID:       account1.ID,
+		IsFrozen: false,
+	})
+	require.NoError(t, err)
+	require.False(t, account3.IsFrozen)
+}
@@ -0,0 +1,13 @@
+package db
+
+import "github.com/leilei3167/bank/db/util"
+
+//转换为注册表中的货币,注册表供currency验证器和金额格式化使用
+func (currency Currency) RegistryCurrency() util.Currency {
+	return util.Currency{
+		Code:     currency.Code,
+		Exponent: currency.Exponent,
+		Symbol:   currency.Symbol,
+		Enabled:  currency.Enabled,
+	}
+}
@@ -0,0 +1,64 @@
+package db
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/leilei3167/bank/db/util"
+	"github.com/stretchr/testify/require"
+)
+
+//创建一个随机代码的货币,避免和预置的货币以及其他测试冲突
+func createRandomCurrency(t *testing.T, exponent int32) Currency {
+	arg := CreateCurrencyParams{
+		Code:     strings.ToUpper(util.RandomString(3)),
+		Exponent: exponent,
+		Symbol:   util.RandomString(1),
+		Enabled:  true,
+	}
+	currency, err := testQueries.CreateCurrency(context.Background(), arg)
+	require.NoError(t, err)
+	require.Equal(t, arg.Code, currency.Code)
+	require.Equal(t, arg.Exponent, currency.Exponent)
+	require.Equal(t, arg.Symbol, currency.Symbol)
+	require.True(t, currency.Enabled)
+	require.NotZero(t, currency.CreatedAt)
+	return currency
+}
+
+func TestGetCurrency(t *testing.T) {
+	currency1 := createRandomCurrency(t, 2)
+	currency2, err := testQueries.GetCurrency(context.Background(), currency1.Code)
+	require.NoError(t, err)
+	require.Equal(t, currency1, currency2)
+
+	//迁移中预置的货币
+	for _, code := range []string{util.USD, util.EUR, util.RMB} {
+		currency, err := testQueries.GetCurrency(context.Background(), code)
+		require.NoError(t, err)
+		require.Equal(t, int32(2), currency.Exponent)
+	}
+}
+
+func TestSetCurrencyEnabled(t *testing.T) {
+	currency := createRandomCurrency(t, 0)
+
+	disabled, err := testQueries.SetCurrencyEnabled(context.Background(), SetCurrencyEnabledParams{
+		Code:    currency.Code,
+		Enabled: false,
+	})
+	require.NoError(t, err)
+	require.False(t, disabled.Enabled)
+
+	currencies, err := testQueries.ListCurrencies(context.Background())
+	require.NoError(t, err)
+	found := false
+	for _, c := range currencies {
+		if c.Code == currency.Code {
+			found = true
+			require.False(t, c.Enabled)
+		}
+	}
+	require.True(t, found)
+}
@@ -5,36 +5,49 @@ package db
 
 import (
 	"context"
+	"database/sql"
+	"time"
 )
 
 const createEntry = `-- name: CreateEntry :one
 INSERT INTO entries (
   account_id,
-  amount
+  amount,
+  transfer_id,
+  journal_id
 ) VALUES (
-  $1, $2
-) RETURNING id, account_id, amount, created_at
+  $1, $2, $3, $4
+) RETURNING id, account_id, amount, created_at, transfer_id, journal_id
 `
 
 type CreateEntryParams struct {
-	AccountID int64 `json:"account_id"`
-	Amount    int64 `json:"amount"`
+	AccountID  int64         `json:"account_id"`
+	Amount     int64         `json:"amount"`
+	TransferID sql.NullInt64 `json:"transfer_id"`
+	JournalID  sql.NullInt64 `json:"journal_id"`
 }
 
 func (q *Queries) CreateEntry(ctx context.Context, arg CreateEntryParams) (Entry, error) {
-	row := q.db.QueryRowContext(ctx, createEntry, arg.AccountID, arg.Amount)
+	row := q.db.QueryRowContext(ctx, createEntry,
+		arg.AccountID,
+		arg.Amount,
+		arg.TransferID,
+		arg.JournalID,
+	)
 	var i Entry
 	err := row.Scan(
 		&i.ID,
 		&i.AccountID,
 		&i.Amount,
 		&i.CreatedAt,
+		&i.TransferID,
+		&i.JournalID,
 	)
 	return i, err
 }
 
 const getEntry = `-- name: GetEntry :one
-SELECT id, account_id, amount, created_at FROM entries
+SELECT id, account_id, amount, created_at, transfer_id, journal_id FROM entries
 WHERE id = $1 LIMIT 1
 `
 
@@ -46,12 +59,14 @@ func (q *Queries) GetEntry(ctx context.Context, id int64) (Entry, error) {
 		&i.AccountID,
 		&i.Amount,
 		&i.CreatedAt,
+		&i.TransferID,
+		&i.JournalID,
 	)
 	return i, err
 }
 
 const listEntries = `-- name: ListEntries :many
-SELECT id, account_id, amount, created_at FROM entries
+SELECT id, account_id, amount, created_at, transfer_id, journal_id FROM entries
 WHERE account_id = $1
 ORDER BY id
 LIMIT $2
@@ -78,6 +93,102 @@ func (q *Queries) ListEntries(ctx context.Context, arg ListEntriesParams) ([]Ent
 			&i.AccountID,
 			&i.Amount,
 			&i.CreatedAt,
+			&i.TransferID,
+			&i.JournalID,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listEntriesByJournal = `-- name: ListEntriesByJournal :many
+SELECT id, account_id, amount, created_at, transfer_id, journal_id FROM entries
+WHERE journal_id = $1
+ORDER BY id
+`
+
+func (q *Queries) ListEntriesByJournal(ctx context.Context, journalID sql.NullInt64) ([]Entry, error) {
+	rows, err := q.db.QueryContext(ctx, listEntriesByJournal, journalID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []Entry{}
+	for rows.Next() {
+		var i Entry
+		if err := rows.Scan(
+			&i.ID,
+			&i.AccountID,
+			&i.Amount,
+			&i.CreatedAt,
+			&i.TransferID,
+			&i.JournalID,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listEntriesByTime = `-- name: ListEntriesByTime :many
+SELECT id, account_id, amount, created_at, transfer_id, journal_id FROM entries
+WHERE account_id = $1
+  AND created_at >= $2
+  AND created_at < $3
+  AND ($4::bigint = 0
+    OR (created_at, id) > (SELECT e.created_at, e.id FROM entries e WHERE e.id = $4 AND e.account_id = $1))
+ORDER BY created_at, id
+LIMIT $5
+OFFSET $6
+`
+
+type ListEntriesByTimeParams struct {
+	AccountID   int64     `json:"account_id"`
+	FromTime    time.Time `json:"from_time"`
+	ToTime      time.Time `json:"to_time"`
+	AfterID     int64     `json:"after_id"`
+	LimitCount  int32     `json:"limit_count"`
+	OffsetCount int32     `json:"offset_count"`
+}
+
+func (q *Queries) ListEntriesByTime(ctx context.Context, arg ListEntriesByTimeParams) ([]Entry, error) {
+	rows, err := q.db.QueryContext(ctx, listEntriesByTime,
+		arg.AccountID,
+		arg.FromTime,
+		arg.ToTime,
+		arg.AfterID,
+		arg.LimitCount,
+		arg.OffsetCount,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []Entry{}
+	for rows.Next() {
+		var i Entry
+		if err := rows.Scan(
+			&i.ID,
+			&i.AccountID,
+			&i.Amount,
+			&i.CreatedAt,
+			&i.TransferID,
+			&i.JournalID,
 		); err != nil {
 			return nil, err
 		}
@@ -91,3 +202,69 @@ func (q *Queries) ListEntries(ctx context.Context, arg ListEntriesParams) ([]Ent
 	}
 	return items, nil
 }
+
+const sumEntryAmountsAfter = `-- name: SumEntryAmountsAfter :one
+SELECT COALESCE(SUM(amount), 0)::bigint AS total
+FROM entries
+WHERE account_id = $1
+  AND (created_at, id) > ($2::timestamptz, $3::bigint)
+`
+
+type SumEntryAmountsAfterParams struct {
+	AccountID int64     `json:"account_id"`
+	CreatedAt time.Time `json:"created_at"`
+	ID        int64     `json:"id"`
+}
+
+func (q *Queries) SumEntryAmountsAfter(ctx context.Context, arg SumEntryAmountsAfterParams) (int64, error) {
+	row := q.db.QueryRowContext(ctx, sumEntryAmountsAfter, arg.AccountID, arg.CreatedAt, arg.ID)
+	var total int64
+	err := row.Scan(&total)
+	return total, err
+}
+
+const sumEntryAmountsInRange = `-- name: SumEntryAmountsInRange :one
+SELECT
+    COALESCE(SUM(amount) FILTER (WHERE amount > 0), 0)::bigint AS total_in,
+    COALESCE(-SUM(amount) FILTER (WHERE amount < 0), 0)::bigint AS total_out
+FROM entries
+WHERE account_id = $1
+  AND created_at >= $2
+  AND created_at < $3
+`
+
+type SumEntryAmountsInRangeParams struct {
+	AccountID int64     `json:"account_id"`
+	FromTime  time.Time `json:"from_time"`
+	ToTime    time.Time `json:"to_time"`
+}
+
+type SumEntryAmountsInRangeRow struct {
+	TotalIn  int64 `json:"total_in"`
+	TotalOut int64 `json:"total_out"`
+}
+
+func (q *Queries) SumEntryAmountsInRange(ctx context.Context, arg SumEntryAmountsInRangeParams) (SumEntryAmountsInRangeRow, error) {
+	row := q.db.QueryRowContext(ctx, sumEntryAmountsInRange, arg.AccountID, arg.FromTime, arg.ToTime)
+	var i SumEntryAmountsInRangeRow
+	err := row.Scan(&i.TotalIn, &i.TotalOut)
+	return i, err
+}
+
+const sumEntryAmountsSince = `-- name: SumEntryAmountsSince :one
+SELECT COALESCE(SUM(amount), 0)::bigint AS total
+FROM entries
+WHERE account_id = $1 AND created_at >= $2
+`
+
+type SumEntryAmountsSinceParams struct {
+	AccountID int64     `json:"account_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (q *Queries) SumEntryAmountsSince(ctx context.Context, arg SumEntryAmountsSinceParams) (int64, error) {
+	row := q.db.QueryRowContext(ctx, sumEntryAmountsSince, arg.AccountID, arg.CreatedAt)
+	var total int64
+	err := row.Scan(&total)
+	return total, err
+}
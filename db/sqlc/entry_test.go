@@ -3,6 +3,7 @@ package db
 import (
 	"context"
 	"testing"
+	"time"
 
 	"github.com/leilei3167/bank/db/util"
 	"github.com/stretchr/testify/require"
@@ -69,3 +70,41 @@ func TestListEntries(t *testing.T) {
 	}
 
 }
+
+func TestListEntriesByTimeOrder(t *testing.T) {
+	account := createRandomAccount(t)
+	entry1 := createRandomEntry(t, account)
+	entry2 := createRandomEntry(t, account)
+	entry3 := createRandomEntry(t, account)
+
+	//并发的事务提交顺序和ID顺序不一定一致,把第一笔分录的时间改到最后
+	_, err := testDB.Exec("UPDATE entries SET created_at = $2 WHERE id = $1", entry1.ID, entry3.CreatedAt.Add(time.Second))
+	require.NoError(t, err)
+
+	arg := ListEntriesByTimeParams{
+		AccountID:  account.ID,
+		FromTime:   entry2.CreatedAt.Add(-time.Minute),
+		ToTime:     entry3.CreatedAt.Add(time.Minute),
+		LimitCount: 2,
+	}
+	entries, err := testQueries.ListEntriesByTime(context.Background(), arg)
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	require.Equal(t, entry2.ID, entries[0].ID)
+	require.Equal(t, entry3.ID, entries[1].ID)
+
+	//游标之后是时间最晚的第一笔分录
+	arg.AfterID = entries[1].ID
+	entries, err = testQueries.ListEntriesByTime(context.Background(), arg)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	require.Equal(t, entry1.ID, entries[0].ID)
+
+	total, err := testQueries.SumEntryAmountsAfter(context.Background(), SumEntryAmountsAfterParams{
+		AccountID: account.ID,
+		CreatedAt: entry3.CreatedAt,
+		ID:        entry3.ID,
+	})
+	require.NoError(t, err)
+	require.Equal(t, entry1.Amount, total)
+}
@@ -0,0 +1,81 @@
+package db
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+//每个测试使用随机的货币,避免和其他测试录入的汇率相互影响
+func createRandomExchangeRate(t *testing.T, base, quote, rate string, effectiveFrom time.Time) ExchangeRate {
+	arg := CreateExchangeRateParams{
+		BaseCurrency:  base,
+		QuoteCurrency: quote,
+		Rate:          rate,
+		EffectiveFrom: effectiveFrom,
+	}
+	exchangeRate, err := testQueries.CreateExchangeRate(context.Background(), arg)
+	require.NoError(t, err)
+	require.NotZero(t, exchangeRate.ID)
+	require.Equal(t, base, exchangeRate.BaseCurrency)
+	require.Equal(t, quote, exchangeRate.QuoteCurrency)
+	require.WithinDuration(t, effectiveFrom, exchangeRate.EffectiveFrom, time.Second)
+	require.NotZero(t, exchangeRate.CreatedAt)
+	return exchangeRate
+}
+
+func TestGetExchangeRate(t *testing.T) {
+	base, quote := createRandomCurrency(t, 2).Code, createRandomCurrency(t, 2).Code
+	now := time.Now()
+
+	old := createRandomExchangeRate(t, base, quote, "7.1", now.Add(-2*time.Hour))
+	current := createRandomExchangeRate(t, base, quote, "7.2", now.Add(-time.Hour))
+	createRandomExchangeRate(t, base, quote, "7.3", now.Add(time.Hour))
+
+	//取生效时间不晚于at的最新一条
+	rate, err := testQueries.GetExchangeRate(context.Background(), GetExchangeRateParams{
+		BaseCurrency:  base,
+		QuoteCurrency: quote,
+		At:            now,
+	})
+	require.NoError(t, err)
+	require.Equal(t, current.ID, rate.ID)
+
+	rate, err = testQueries.GetExchangeRate(context.Background(), GetExchangeRateParams{
+		BaseCurrency:  base,
+		QuoteCurrency: quote,
+		At:            now.Add(-90 * time.Minute),
+	})
+	require.NoError(t, err)
+	require.Equal(t, old.ID, rate.ID)
+
+	//反方向没有录入汇率
+	_, err = testQueries.GetExchangeRate(context.Background(), GetExchangeRateParams{
+		BaseCurrency:  quote,
+		QuoteCurrency: base,
+		At:            now,
+	})
+	require.Error(t, err)
+}
+
+func TestListExchangeRates(t *testing.T) {
+	base, quote := createRandomCurrency(t, 2).Code, createRandomCurrency(t, 2).Code
+	now := time.Now()
+	for i := 0; i < 6; i++ {
+		createRandomExchangeRate(t, base, quote, "1.5", now.Add(time.Duration(i)*time.Minute))
+	}
+
+	rates, err := testQueries.ListExchangeRates(context.Background(), ListExchangeRatesParams{
+		BaseCurrency:  base,
+		QuoteCurrency: quote,
+		Limit:         5,
+		Offset:        0,
+	})
+	require.NoError(t, err)
+	require.Len(t, rates, 5)
+	for i := 1; i < len(rates); i++ {
+		require.True(t, rates[i-1].EffectiveFrom.After(rates[i].EffectiveFrom))
+	}
+}
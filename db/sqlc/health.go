@@ -0,0 +1,44 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+//当前代码依赖的数据库迁移版本,即db/migration中最大的编号,添加迁移时需要同步修改
+const ExpectedMigrationVersion = 14
+
+var (
+	ErrMigrationDirty    = errors.New("last migration failed and the schema is dirty")
+	ErrMigrationMismatch = errors.New("database migration version doesn't match")
+)
+
+//golang-migrate记录在schema_migrations表中的版本
+type MigrationVersion struct {
+	Version int64 `json:"version"`
+	Dirty   bool  `json:"dirty"`
+}
+
+//检查迁移版本是否和代码一致,执行失败留下的dirty状态同样视为不一致
+func (v MigrationVersion) Check() error {
+	if v.Dirty {
+		return fmt.Errorf("version %d: %w", v.Version, ErrMigrationDirty)
+	}
+	if v.Version != ExpectedMigrationVersion {
+		return fmt.Errorf("got %d, expected %d: %w", v.Version, ExpectedMigrationVersion, ErrMigrationMismatch)
+	}
+	return nil
+}
+
+//检查数据库是否可以连接
+func (store *SQLStore) Ping(ctx context.Context) error {
+	return store.db.PingContext(ctx)
+}
+
+//schema_migrations由迁移工具维护,不在sqlc的schema中,所以直接查询
+func (store *SQLStore) GetMigrationVersion(ctx context.Context) (MigrationVersion, error) {
+	var v MigrationVersion
+	err := store.db.QueryRowContext(ctx, "SELECT version, dirty FROM schema_migrations LIMIT 1").Scan(&v.Version, &v.Dirty)
+	return v, err
+}
@@ -0,0 +1,42 @@
+package db
+
+import (
+	"context"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+//ExpectedMigrationVersion需要和db/migration中最大的编号一致
+func TestExpectedMigrationVersion(t *testing.T) {
+	files, err := os.ReadDir("../migration")
+	require.NoError(t, err)
+
+	var latest int64
+	for _, file := range files {
+		version, err := strconv.ParseInt(strings.SplitN(file.Name(), "_", 2)[0], 10, 64)
+		require.NoError(t, err)
+		if version > latest {
+			latest = version
+		}
+	}
+	require.Equal(t, int64(ExpectedMigrationVersion), latest)
+}
+
+func TestGetMigrationVersion(t *testing.T) {
+	store := NewStore(testDB)
+	require.NoError(t, store.Ping(context.Background()))
+
+	version, err := store.GetMigrationVersion(context.Background())
+	require.NoError(t, err)
+	require.NoError(t, version.Check())
+}
+
+func TestMigrationVersionCheck(t *testing.T) {
+	require.NoError(t, MigrationVersion{Version: ExpectedMigrationVersion}.Check())
+	require.ErrorIs(t, MigrationVersion{Version: ExpectedMigrationVersion - 1}.Check(), ErrMigrationMismatch)
+	require.ErrorIs(t, MigrationVersion{Version: ExpectedMigrationVersion, Dirty: true}.Check(), ErrMigrationDirty)
+}
@@ -0,0 +1,139 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+//日记账的类型
+const (
+	JournalKindTransfer   = "transfer"
+	JournalKindReversal   = "reversal"
+	JournalKindDeposit    = "deposit"
+	JournalKindWithdrawal = "withdrawal"
+)
+
+//系统账户的持有者,和现金清算账户一样每种货币一个账户,在第一次使用时创建
+const (
+	FXAccountOwner  = "bank_fx"   //外汇清算账户,跨币种转账时两种货币各自在该账户上平衡
+	FeeAccountOwner = "bank_fees" //手续费收入账户
+)
+
+//系统账户只由银行内部记账使用,不能作为转账的任何一方,也不能存取款
+var ErrSystemAccount = errors.New("cannot transfer, deposit or withdraw with a system account")
+
+//现金清算、外汇清算和手续费账户都是系统账户
+func IsSystemAccountOwner(owner string) bool {
+	switch owner {
+	case CashAccountOwner, FXAccountOwner, FeeAccountOwner:
+		return true
+	}
+	return false
+}
+
+//同一个日记账下的分录按币种合计不为0
+var ErrUnbalancedJournal = errors.New("journal postings do not sum to zero")
+
+//一条分录,Amount为正表示账户增加,为负表示减少
+type Posting struct {
+	AccountID int64 `json:"account_id"`
+	Amount    int64 `json:"amount"`
+}
+
+type PostJournalParams struct {
+	Kind       string        `json:"kind"`
+	TransferID sql.NullInt64 `json:"transfer_id"`
+	Postings   []Posting     `json:"postings"`
+}
+
+type PostJournalResult struct {
+	Journal  Journal           `json:"journal"`
+	Entries  []Entry           `json:"entries"`  //与Postings的顺序相同
+	Accounts map[int64]Account `json:"accounts"` //记账之后的账户
+}
+
+//所有的资金变动都通过该方法记账:创建日记账,写入分录,修改余额
+//必须在事务中调用,涉及的账户按照id从小到大的顺序加锁,已经被本事务锁住的账户不会阻塞
+//每种货币的分录合计必须为0,否则返回ErrUnbalancedJournal,数据库的约束触发器在提交时也会再检查一次
+//透支检查由调用方在加锁之后完成
+func (q *Queries) PostJournal(ctx context.Context, arg PostJournalParams) (PostJournalResult, error) {
+	result := PostJournalResult{Accounts: make(map[int64]Account)}
+
+	//每个账户的变动合计
+	changes := make(map[int64]int64)
+	accountIDs := make([]int64, 0, len(arg.Postings))
+	for _, posting := range arg.Postings {
+		if _, ok := changes[posting.AccountID]; !ok {
+			accountIDs = append(accountIDs, posting.AccountID)
+		}
+		changes[posting.AccountID] += posting.Amount
+	}
+	sort.Slice(accountIDs, func(i, j int) bool { return accountIDs[i] < accountIDs[j] })
+
+	totals := make(map[string]int64)
+	for _, id := range accountIDs {
+		account, err := q.GetAccountForUpdate(ctx, id)
+		if err != nil {
+			return result, err
+		}
+		totals[account.Currency] += changes[id]
+	}
+	for currency, total := range totals {
+		if total != 0 {
+			return result, fmt.Errorf("%s off by %d: %w", currency, total, ErrUnbalancedJournal)
+		}
+	}
+
+	var err error
+	result.Journal, err = q.CreateJournal(ctx, CreateJournalParams{
+		Kind:       arg.Kind,
+		TransferID: arg.TransferID,
+	})
+	if err != nil {
+		return result, err
+	}
+
+	journalID := sql.NullInt64{Int64: result.Journal.ID, Valid: true}
+	result.Entries = make([]Entry, len(arg.Postings))
+	for i, posting := range arg.Postings {
+		result.Entries[i], err = q.CreateEntry(ctx, CreateEntryParams{
+			AccountID:  posting.AccountID,
+			Amount:     posting.Amount,
+			TransferID: arg.TransferID,
+			JournalID:  journalID,
+		})
+		if err != nil {
+			return result, err
+		}
+	}
+
+	//同样按照id的顺序修改余额
+	for _, id := range accountIDs {
+		result.Accounts[id], err = q.AddAccountBalance(ctx, AddAccountBalanceParams{
+			ID:     id,
+			Amount: changes[id],
+		})
+		if err != nil {
+			return result, err
+		}
+	}
+	return result, nil
+}
+
+//返回系统持有者在该币种下的账户,不存在时创建
+func systemAccount(ctx context.Context, q *Queries, owner, currency string) (Account, error) {
+	err := q.EnsureAccount(ctx, EnsureAccountParams{
+		Owner:    owner,
+		Currency: currency,
+	})
+	if err != nil {
+		return Account{}, err
+	}
+	return q.GetAccountByOwnerAndCurrency(ctx, GetAccountByOwnerAndCurrencyParams{
+		Owner:    owner,
+		Currency: currency,
+	})
+}
@@ -0,0 +1,143 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPostJournal(t *testing.T) {
+	account1 := createAccountWithBalance(t, 100)
+	account2 := createAccountWithBalance(t, 100)
+	_, err := testDB.Exec("UPDATE accounts SET currency = $2 WHERE id = $1", account2.ID, account1.Currency)
+	require.NoError(t, err)
+
+	result, err := testQueries.PostJournal(context.Background(), PostJournalParams{
+		Kind: JournalKindTransfer,
+		Postings: []Posting{
+			{AccountID: account1.ID, Amount: -30},
+			{AccountID: account2.ID, Amount: 30},
+		},
+	})
+	require.NoError(t, err)
+	require.NotZero(t, result.Journal.ID)
+	require.Equal(t, JournalKindTransfer, result.Journal.Kind)
+	require.Len(t, result.Entries, 2)
+	require.Equal(t, int64(70), result.Accounts[account1.ID].Balance)
+	require.Equal(t, int64(130), result.Accounts[account2.ID].Balance)
+
+	entries, err := testQueries.ListEntriesByJournal(context.Background(), sql.NullInt64{Int64: result.Journal.ID, Valid: true})
+	require.NoError(t, err)
+	require.Equal(t, result.Entries, entries)
+}
+
+func TestPostJournalUnbalanced(t *testing.T) {
+	account1 := createAccountWithBalance(t, 100)
+	account2 := createAccountWithBalance(t, 100)
+	_, err := testDB.Exec("UPDATE accounts SET currency = $2 WHERE id = $1", account2.ID, account1.Currency)
+	require.NoError(t, err)
+
+	_, err = testQueries.PostJournal(context.Background(), PostJournalParams{
+		Kind: JournalKindTransfer,
+		Postings: []Posting{
+			{AccountID: account1.ID, Amount: -30},
+			{AccountID: account2.ID, Amount: 20},
+		},
+	})
+	require.ErrorIs(t, err, ErrUnbalancedJournal)
+
+	//不同币种的分录即使金额相加为0也不平衡
+	currency := createRandomCurrency(t, 2).Code
+	_, err = testDB.Exec("UPDATE accounts SET currency = $2 WHERE id = $1", account2.ID, currency)
+	require.NoError(t, err)
+	_, err = testQueries.PostJournal(context.Background(), PostJournalParams{
+		Kind: JournalKindTransfer,
+		Postings: []Posting{
+			{AccountID: account1.ID, Amount: -30},
+			{AccountID: account2.ID, Amount: 30},
+		},
+	})
+	require.ErrorIs(t, err, ErrUnbalancedJournal)
+
+	//余额没有变化
+	updated, err := testQueries.GetAccount(context.Background(), account1.ID)
+	require.NoError(t, err)
+	require.Equal(t, int64(100), updated.Balance)
+}
+
+//绕过PostJournal直接写入不平衡的分录,提交时被数据库的约束拒绝
+func TestJournalBalancedConstraint(t *testing.T) {
+	account := createRandomAccount(t)
+
+	tx, err := testDB.BeginTx(context.Background(), nil)
+	require.NoError(t, err)
+	q := New(tx)
+
+	journal, err := q.CreateJournal(context.Background(), CreateJournalParams{Kind: JournalKindDeposit})
+	require.NoError(t, err)
+	_, err = q.CreateEntry(context.Background(), CreateEntryParams{
+		AccountID: account.ID,
+		Amount:    10,
+		JournalID: sql.NullInt64{Int64: journal.ID, Valid: true},
+	})
+	require.NoError(t, err)
+
+	require.Error(t, tx.Commit())
+}
+
+func TestTransferTxJournal(t *testing.T) {
+	store := NewStore(testDB)
+	account1 := createAccountWithBalance(t, 1000)
+	account2 := createAccountWithBalance(t, 1000)
+
+	base, quote := createRandomCurrency(t, 2).Code, createRandomCurrency(t, 2).Code
+	_, err := testDB.Exec("UPDATE accounts SET currency = $2 WHERE id = $1", account1.ID, base)
+	require.NoError(t, err)
+	_, err = testDB.Exec("UPDATE accounts SET currency = $2 WHERE id = $1", account2.ID, quote)
+	require.NoError(t, err)
+	createRandomExchangeRate(t, base, quote, "2", time.Now().Add(-time.Minute))
+
+	result, err := store.TransferTx(context.Background(), TransferTxParams{
+		FromAccountID: account1.ID,
+		ToAccountID:   account2.ID,
+		Amount:        100,
+		Fee:           5,
+	})
+	require.NoError(t, err)
+	require.Equal(t, int64(5), result.Transfer.Fee)
+	require.Equal(t, int64(1000-105), result.FromAccount.Balance)
+	require.Equal(t, int64(1000+200), result.ToAccount.Balance)
+
+	//转出,转入,外汇清算的两条,手续费的两条,都在同一个日记账下
+	require.True(t, result.FromEntry.JournalID.Valid)
+	require.Equal(t, result.FromEntry.JournalID, result.ToEntry.JournalID)
+	entries, err := testQueries.ListEntriesByJournal(context.Background(), result.FromEntry.JournalID)
+	require.NoError(t, err)
+	require.Len(t, entries, 6)
+
+	totals := make(map[string]int64)
+	for _, entry := range entries {
+		require.Equal(t, result.Transfer.ID, entry.TransferID.Int64)
+		account, err := testQueries.GetAccount(context.Background(), entry.AccountID)
+		require.NoError(t, err)
+		totals[account.Currency] += entry.Amount
+	}
+	require.Equal(t, map[string]int64{base: 0, quote: 0}, totals)
+
+	journal, err := testQueries.GetJournal(context.Background(), result.FromEntry.JournalID.Int64)
+	require.NoError(t, err)
+	require.Equal(t, JournalKindTransfer, journal.Kind)
+	require.Equal(t, result.Transfer.ID, journal.TransferID.Int64)
+
+	//手续费也要计入余额检查
+	_, err = store.TransferTx(context.Background(), TransferTxParams{
+		FromAccountID: account1.ID,
+		ToAccountID:   account2.ID,
+		Amount:        result.FromAccount.Balance,
+		Fee:           1,
+	})
+	require.ErrorIs(t, err, ErrInsufficientBalance)
+}
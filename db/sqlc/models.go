@@ -3,15 +3,30 @@
 package db
 
 import (
+	"database/sql"
+	"encoding/json"
 	"time"
+
+	"github.com/google/uuid"
 )
 
 type Account struct {
-	ID        int64     `json:"id"`
-	Owner     string    `json:"owner"`
+	ID    int64  `json:"id"`
+	Owner string `json:"owner"`
+	// in minor units of currency
 	Balance   int64     `json:"balance"`
 	Currency  string    `json:"currency"`
 	CreatedAt time.Time `json:"created_at"`
+	IsFrozen  bool      `json:"is_frozen"`
+}
+
+type Currency struct {
+	Code string `json:"code"`
+	// number of minor units digits, e.g. 2 means 1 USD = 100 cents
+	Exponent  int32     `json:"exponent"`
+	Symbol    string    `json:"symbol"`
+	Enabled   bool      `json:"enabled"`
+	CreatedAt time.Time `json:"created_at"`
 }
 
 type Entry struct {
@@ -20,6 +35,85 @@ type Entry struct {
 	// can be negative or positive
 	Amount    int64     `json:"amount"`
 	CreatedAt time.Time `json:"created_at"`
+	// transfer that produced this entry, null for cash movements and entries written before this column existed
+	TransferID sql.NullInt64 `json:"transfer_id"`
+	// journal this posting belongs to, null for entries written before journals existed
+	JournalID sql.NullInt64 `json:"journal_id"`
+}
+
+type ExchangeRate struct {
+	ID            int64  `json:"id"`
+	BaseCurrency  string `json:"base_currency"`
+	QuoteCurrency string `json:"quote_currency"`
+	// units of quote currency per unit of base currency
+	Rate          string    `json:"rate"`
+	EffectiveFrom time.Time `json:"effective_from"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+type IdempotencyKey struct {
+	Username    string `json:"username"`
+	Key         string `json:"key"`
+	RequestHash string `json:"request_hash"`
+	// serialized result of the original request
+	Response  json.RawMessage `json:"response"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+type Journal struct {
+	ID int64 `json:"id"`
+	// transfer, reversal, deposit or withdrawal
+	Kind       string        `json:"kind"`
+	TransferID sql.NullInt64 `json:"transfer_id"`
+	CreatedAt  time.Time     `json:"created_at"`
+}
+
+type ReconciliationRun struct {
+	ID       int64 `json:"id"`
+	HasDrift bool  `json:"has_drift"`
+	// serialized reconciliation report
+	Report     json.RawMessage `json:"report"`
+	StartedAt  time.Time       `json:"started_at"`
+	FinishedAt time.Time       `json:"finished_at"`
+	CreatedAt  time.Time       `json:"created_at"`
+}
+
+type ScheduledTransfer struct {
+	ID            int64  `json:"id"`
+	Owner         string `json:"owner"`
+	FromAccountID int64  `json:"from_account_id"`
+	ToAccountID   int64  `json:"to_account_id"`
+	// in the currency of the from account
+	Amount     int64  `json:"amount"`
+	Recurrence string `json:"recurrence"`
+	Status     string `json:"status"`
+	// first run or the last rescheduled run, monthly transfers keep its day of month
+	StartsAt  time.Time    `json:"starts_at"`
+	NextRunAt time.Time    `json:"next_run_at"`
+	LastRunAt sql.NullTime `json:"last_run_at"`
+	CreatedAt time.Time    `json:"created_at"`
+}
+
+type ScheduledTransferRun struct {
+	ID                  int64 `json:"id"`
+	ScheduledTransferID int64 `json:"scheduled_transfer_id"`
+	// null when the run failed
+	TransferID   sql.NullInt64 `json:"transfer_id"`
+	Status       string        `json:"status"`
+	Error        string        `json:"error"`
+	ScheduledFor time.Time     `json:"scheduled_for"`
+	CreatedAt    time.Time     `json:"created_at"`
+}
+
+type Session struct {
+	ID           uuid.UUID `json:"id"`
+	Username     string    `json:"username"`
+	RefreshToken string    `json:"refresh_token"`
+	UserAgent    string    `json:"user_agent"`
+	ClientIp     string    `json:"client_ip"`
+	IsBlocked    bool      `json:"is_blocked"`
+	ExpiresAt    time.Time `json:"expires_at"`
+	CreatedAt    time.Time `json:"created_at"`
 }
 
 type Transfer struct {
@@ -29,6 +123,14 @@ type Transfer struct {
 	// must be positive
 	Amount    int64     `json:"amount"`
 	CreatedAt time.Time `json:"created_at"`
+	// amount credited to the destination account, in its currency
+	CreditedAmount int64 `json:"credited_amount"`
+	// rate applied to convert amount into credited_amount
+	ExchangeRate string `json:"exchange_rate"`
+	// fee charged to the source account, in its currency
+	Fee int64 `json:"fee"`
+	// original transfer this one refunds, in whole or in part
+	ReversalOf sql.NullInt64 `json:"reversal_of"`
 }
 
 type User struct {
@@ -38,4 +140,5 @@ type User struct {
 	Email             string    `json:"email"`
 	PasswordChangedAt time.Time `json:"password_changed_at"`
 	CreatedAt         time.Time `json:"created_at"`
+	Role              string    `json:"role"`
 }
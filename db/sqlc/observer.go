@@ -0,0 +1,99 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+)
+
+//每条SQL执行之后的回调,name为sqlc生成的查询名(即Querier的方法名),err为执行的错误
+//QueryRow的sql.ErrNoRows要到Scan时才知道,所以不算作错误
+type QueryObserver func(ctx context.Context, name string, duration time.Duration, err error)
+
+//设置执行SQL之后的回调,事务中的查询同样会回调,可用于统计每个Querier方法的耗时和错误
+func WithQueryObserver(observer QueryObserver) StoreOption {
+	return func(store *SQLStore) {
+		store.queryObserver = observer
+	}
+}
+
+//每条SQL执行之前的回调,返回的ctx用于执行SQL,返回的函数在执行之后调用,可用于为每条SQL创建span
+type QueryTracer func(ctx context.Context, name string) (context.Context, func(err error))
+
+//设置执行SQL之前的回调,和WithQueryObserver一样会回调事务中的查询
+func WithQueryTracer(tracer QueryTracer) StoreOption {
+	return func(store *SQLStore) {
+		store.queryTracer = tracer
+	}
+}
+
+//不是sqlc生成的查询时使用的名称
+const unnamedQuery = "unnamed"
+
+//sqlc生成的查询以"-- name: GetAccount :one"开头
+func queryName(query string) string {
+	const prefix = "-- name: "
+	if !strings.HasPrefix(query, prefix) {
+		return unnamedQuery
+	}
+	name := query[len(prefix):]
+	if i := strings.IndexAny(name, " \n"); i >= 0 {
+		name = name[:i]
+	}
+	return name
+}
+
+//包装DBTX,执行之前调用tracer,执行之后调用observer
+type observedDBTX struct {
+	DBTX
+	observer QueryObserver
+	tracer   QueryTracer
+}
+
+//返回的函数在执行之后调用,ctx为tracer返回的ctx,SQL在其中执行
+func (o observedDBTX) start(ctx context.Context, query string) (context.Context, func(err error)) {
+	name := queryName(query)
+	start := time.Now()
+	var finish func(err error)
+	if o.tracer != nil {
+		ctx, finish = o.tracer(ctx, name)
+	}
+	return ctx, func(err error) {
+		if finish != nil {
+			finish(err)
+		}
+		if o.observer != nil {
+			o.observer(ctx, name, time.Since(start), err)
+		}
+	}
+}
+
+func (o observedDBTX) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	ctx, done := o.start(ctx, query)
+	result, err := o.DBTX.ExecContext(ctx, query, args...)
+	done(err)
+	return result, err
+}
+
+func (o observedDBTX) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	ctx, done := o.start(ctx, query)
+	rows, err := o.DBTX.QueryContext(ctx, query, args...)
+	done(err)
+	return rows, err
+}
+
+func (o observedDBTX) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	ctx, done := o.start(ctx, query)
+	row := o.DBTX.QueryRowContext(ctx, query, args...)
+	done(row.Err())
+	return row
+}
+
+//没有设置observer和tracer时直接返回db
+func (store *SQLStore) observe(db DBTX) DBTX {
+	if store.queryObserver == nil && store.queryTracer == nil {
+		return db
+	}
+	return observedDBTX{DBTX: db, observer: store.queryObserver, tracer: store.queryTracer}
+}
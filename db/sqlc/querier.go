@@ -4,24 +4,73 @@ package db
 
 import (
 	"context"
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
 )
 
 type Querier interface {
 	AddAccountBalance(ctx context.Context, arg AddAccountBalanceParams) (Account, error)
+	AdvanceScheduledTransfer(ctx context.Context, arg AdvanceScheduledTransferParams) (ScheduledTransfer, error)
+	BlockSession(ctx context.Context, id uuid.UUID) (Session, error)
+	BlockUserSessions(ctx context.Context, username string) error
+	CancelScheduledTransfer(ctx context.Context, id int64) (ScheduledTransfer, error)
+	ClaimDueScheduledTransfer(ctx context.Context, nextRunAt time.Time) (ScheduledTransfer, error)
 	CreateAccount(ctx context.Context, arg CreateAccountParams) (Account, error)
+	CreateCurrency(ctx context.Context, arg CreateCurrencyParams) (Currency, error)
 	CreateEntry(ctx context.Context, arg CreateEntryParams) (Entry, error)
+	CreateExchangeRate(ctx context.Context, arg CreateExchangeRateParams) (ExchangeRate, error)
+	CreateIdempotencyKey(ctx context.Context, arg CreateIdempotencyKeyParams) (IdempotencyKey, error)
+	CreateJournal(ctx context.Context, arg CreateJournalParams) (Journal, error)
+	CreateReconciliationRun(ctx context.Context, arg CreateReconciliationRunParams) (ReconciliationRun, error)
+	CreateScheduledTransfer(ctx context.Context, arg CreateScheduledTransferParams) (ScheduledTransfer, error)
+	CreateScheduledTransferRun(ctx context.Context, arg CreateScheduledTransferRunParams) (ScheduledTransferRun, error)
+	CreateSession(ctx context.Context, arg CreateSessionParams) (Session, error)
 	CreateTransfer(ctx context.Context, arg CreateTransferParams) (Transfer, error)
 	CreateUser(ctx context.Context, arg CreateUserParams) (User, error)
 	DeleteAccounts(ctx context.Context, id int64) error
+	EnsureAccount(ctx context.Context, arg EnsureAccountParams) error
 	GetAccount(ctx context.Context, id int64) (Account, error)
+	GetAccountByOwnerAndCurrency(ctx context.Context, arg GetAccountByOwnerAndCurrencyParams) (Account, error)
 	GetAccountForUpdate(ctx context.Context, id int64) (Account, error)
+	GetCurrency(ctx context.Context, code string) (Currency, error)
 	GetEntry(ctx context.Context, id int64) (Entry, error)
+	GetExchangeRate(ctx context.Context, arg GetExchangeRateParams) (ExchangeRate, error)
+	GetIdempotencyKey(ctx context.Context, arg GetIdempotencyKeyParams) (IdempotencyKey, error)
+	GetJournal(ctx context.Context, id int64) (Journal, error)
+	GetLatestReconciliationRun(ctx context.Context) (ReconciliationRun, error)
+	GetScheduledTransfer(ctx context.Context, id int64) (ScheduledTransfer, error)
+	GetSession(ctx context.Context, id uuid.UUID) (Session, error)
 	GetTransfer(ctx context.Context, id int64) (Transfer, error)
+	GetTransferForUpdate(ctx context.Context, id int64) (Transfer, error)
 	GetUser(ctx context.Context, username string) (User, error)
+	ListAccountEntryTotals(ctx context.Context, arg ListAccountEntryTotalsParams) ([]ListAccountEntryTotalsRow, error)
 	ListAccounts(ctx context.Context, arg ListAccountsParams) ([]Account, error)
+	ListAccountsAfter(ctx context.Context, arg ListAccountsAfterParams) ([]Account, error)
+	ListAccountsByOwner(ctx context.Context, arg ListAccountsByOwnerParams) ([]Account, error)
+	ListAccountsByOwnerAfter(ctx context.Context, arg ListAccountsByOwnerAfterParams) ([]Account, error)
+	ListActiveSessions(ctx context.Context, username string) ([]Session, error)
+	ListCurrencies(ctx context.Context) ([]Currency, error)
 	ListEntries(ctx context.Context, arg ListEntriesParams) ([]Entry, error)
+	ListEntriesByJournal(ctx context.Context, journalID sql.NullInt64) ([]Entry, error)
+	ListEntriesByTime(ctx context.Context, arg ListEntriesByTimeParams) ([]Entry, error)
+	ListExchangeRates(ctx context.Context, arg ListExchangeRatesParams) ([]ExchangeRate, error)
+	ListScheduledTransferRuns(ctx context.Context, arg ListScheduledTransferRunsParams) ([]ScheduledTransferRun, error)
+	ListScheduledTransfersByOwner(ctx context.Context, arg ListScheduledTransfersByOwnerParams) ([]ScheduledTransfer, error)
+	ListTransferEntryTotals(ctx context.Context, arg ListTransferEntryTotalsParams) ([]ListTransferEntryTotalsRow, error)
 	ListTransfers(ctx context.Context, arg ListTransfersParams) ([]Transfer, error)
+	ListUsers(ctx context.Context, arg ListUsersParams) ([]User, error)
+	RetryScheduledTransfer(ctx context.Context, arg RetryScheduledTransferParams) (ScheduledTransfer, error)
+	SetAccountFrozen(ctx context.Context, arg SetAccountFrozenParams) (Account, error)
+	SetCurrencyEnabled(ctx context.Context, arg SetCurrencyEnabledParams) (Currency, error)
+	SumEntryAmountsAfter(ctx context.Context, arg SumEntryAmountsAfterParams) (int64, error)
+	SumEntryAmountsInRange(ctx context.Context, arg SumEntryAmountsInRangeParams) (SumEntryAmountsInRangeRow, error)
+	SumEntryAmountsSince(ctx context.Context, arg SumEntryAmountsSinceParams) (int64, error)
+	SumTransferReversals(ctx context.Context, reversalOf sql.NullInt64) (SumTransferReversalsRow, error)
 	UpadateAccount(ctx context.Context, arg UpadateAccountParams) (Account, error)
+	UpdateIdempotencyKeyResponse(ctx context.Context, arg UpdateIdempotencyKeyResponseParams) error
+	UpdateScheduledTransfer(ctx context.Context, arg UpdateScheduledTransferParams) (ScheduledTransfer, error)
 }
 
 var _ Querier = (*Queries)(nil)
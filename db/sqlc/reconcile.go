@@ -0,0 +1,164 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+)
+
+//对账时每批扫描的默认行数
+const DefaultReconcileBatchSize = 500
+
+type ReconcileParams struct {
+	BatchSize int32 `json:"batch_size"` //每批扫描的账户或转账数,不大于0时使用默认值
+}
+
+//账户余额与该账户所有分录的合计不一致
+type AccountDrift struct {
+	AccountID    int64  `json:"account_id"`
+	Currency     string `json:"currency"`
+	Balance      int64  `json:"balance"`
+	EntriesTotal int64  `json:"entries_total"`
+	Drift        int64  `json:"drift"` //balance - entries_total
+}
+
+//转账的分录与转账金额不一致,正常情况下转出账户的分录合计为-(amount+fee),转入账户为+credited_amount
+//外汇清算和手续费账户上的分录由日记账的约束保证平衡,这里不单独检查
+type TransferDrift struct {
+	TransferID       int64 `json:"transfer_id"`
+	FromAccountID    int64 `json:"from_account_id"`
+	ToAccountID      int64 `json:"to_account_id"`
+	Amount           int64 `json:"amount"`
+	CreditedAmount   int64 `json:"credited_amount"`
+	Fee              int64 `json:"fee"`
+	EntryCount       int64 `json:"entry_count"`
+	FromEntriesTotal int64 `json:"from_entries_total"`
+	ToEntriesTotal   int64 `json:"to_entries_total"`
+}
+
+//一次对账的结果
+type ReconciliationReport struct {
+	RunID            int64     `json:"run_id"`
+	StartedAt        time.Time `json:"started_at"`
+	FinishedAt       time.Time `json:"finished_at"`
+	AccountsChecked  int64     `json:"accounts_checked"`
+	TransfersChecked int64     `json:"transfers_checked"`
+	//entries.transfer_id加入之前写入的转账没有关联的分录,无法逐笔检查
+	UnlinkedTransfers int64           `json:"unlinked_transfers"`
+	AccountDrifts     []AccountDrift  `json:"account_drifts"`
+	TransferDrifts    []TransferDrift `json:"transfer_drifts"`
+}
+
+func (report ReconciliationReport) HasDrift() bool {
+	return len(report.AccountDrifts) > 0 || len(report.TransferDrifts) > 0
+}
+
+//分批扫描所有账户和转账,检查余额与分录是否一致,结果保存到reconciliation_runs中
+//每批是一条查询,余额和分录在同一个快照中读取,并发的转账不会造成误报
+func (store *SQLStore) ReconcileLedger(ctx context.Context, arg ReconcileParams) (ReconciliationReport, error) {
+	batchSize := arg.BatchSize
+	if batchSize <= 0 {
+		batchSize = DefaultReconcileBatchSize
+	}
+	report := ReconciliationReport{
+		StartedAt:      time.Now(),
+		AccountDrifts:  []AccountDrift{},
+		TransferDrifts: []TransferDrift{},
+	}
+
+	if err := store.reconcileAccounts(ctx, batchSize, &report); err != nil {
+		return report, err
+	}
+	if err := store.reconcileTransfers(ctx, batchSize, &report); err != nil {
+		return report, err
+	}
+	report.FinishedAt = time.Now()
+
+	data, err := json.Marshal(report)
+	if err != nil {
+		return report, err
+	}
+	run, err := store.CreateReconciliationRun(ctx, CreateReconciliationRunParams{
+		HasDrift:   report.HasDrift(),
+		Report:     data,
+		StartedAt:  report.StartedAt,
+		FinishedAt: report.FinishedAt,
+	})
+	if err != nil {
+		return report, err
+	}
+	report.RunID = run.ID
+	return report, nil
+}
+
+func (store *SQLStore) reconcileAccounts(ctx context.Context, batchSize int32, report *ReconciliationReport) error {
+	var afterID int64
+	for {
+		rows, err := store.ListAccountEntryTotals(ctx, ListAccountEntryTotalsParams{
+			AfterID:    afterID,
+			LimitCount: batchSize,
+		})
+		if err != nil {
+			return err
+		}
+		for _, row := range rows {
+			report.AccountsChecked++
+			if row.Balance != row.EntriesTotal {
+				report.AccountDrifts = append(report.AccountDrifts, AccountDrift{
+					AccountID:    row.ID,
+					Currency:     row.Currency,
+					Balance:      row.Balance,
+					EntriesTotal: row.EntriesTotal,
+					Drift:        row.Balance - row.EntriesTotal,
+				})
+			}
+		}
+		if len(rows) < int(batchSize) {
+			return nil
+		}
+		afterID = rows[len(rows)-1].ID
+	}
+}
+
+func (store *SQLStore) reconcileTransfers(ctx context.Context, batchSize int32, report *ReconciliationReport) error {
+	var afterID int64
+	for {
+		rows, err := store.ListTransferEntryTotals(ctx, ListTransferEntryTotalsParams{
+			AfterID:    afterID,
+			LimitCount: batchSize,
+		})
+		if err != nil {
+			return err
+		}
+		for _, row := range rows {
+			report.TransfersChecked++
+			if row.EntryCount == 0 {
+				report.UnlinkedTransfers++
+				continue
+			}
+			expectedFrom, expectedTo := -row.Amount-row.Fee, row.CreditedAmount
+			if row.FromAccountID == row.ToAccountID {
+				//转给自己时双方的分录记在同一个账户上
+				expectedFrom = row.CreditedAmount - row.Amount - row.Fee
+				expectedTo = expectedFrom
+			}
+			if row.FromEntriesTotal != expectedFrom || row.ToEntriesTotal != expectedTo {
+				report.TransferDrifts = append(report.TransferDrifts, TransferDrift{
+					TransferID:       row.ID,
+					FromAccountID:    row.FromAccountID,
+					ToAccountID:      row.ToAccountID,
+					Amount:           row.Amount,
+					CreditedAmount:   row.CreditedAmount,
+					Fee:              row.Fee,
+					EntryCount:       row.EntryCount,
+					FromEntriesTotal: row.FromEntriesTotal,
+					ToEntriesTotal:   row.ToEntriesTotal,
+				})
+			}
+		}
+		if len(rows) < int(batchSize) {
+			return nil
+		}
+		afterID = rows[len(rows)-1].ID
+	}
+}
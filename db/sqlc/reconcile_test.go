@@ -0,0 +1,68 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestReconcileLedger(t *testing.T) {
+	store := NewStore(testDB)
+
+	//通过存款入账的账户余额和分录一致
+	account1 := createRandomAccount(t)
+	_, err := testQueries.UpadateAccount(context.Background(), UpadateAccountParams{ID: account1.ID, Balance: 0})
+	require.NoError(t, err)
+	_, err = store.DepositTx(context.Background(), CashTxParams{AccountID: account1.ID, Amount: 100})
+	require.NoError(t, err)
+
+	account2, err := testQueries.CreateAccount(context.Background(), CreateAccountParams{
+		Owner:    createRandomUser(t).Username,
+		Balance:  0,
+		Currency: account1.Currency,
+	})
+	require.NoError(t, err)
+
+	result, err := store.TransferTx(context.Background(), TransferTxParams{
+		FromAccountID: account1.ID,
+		ToAccountID:   account2.ID,
+		Amount:        30,
+	})
+	require.NoError(t, err)
+
+	//直接修改余额,没有对应的分录
+	drifted := createAccountWithBalance(t, 50)
+
+	//批次很小,确保分批扫描能覆盖所有的账户
+	report, err := store.ReconcileLedger(context.Background(), ReconcileParams{BatchSize: 3})
+	require.NoError(t, err)
+	require.NotZero(t, report.RunID)
+	require.True(t, report.HasDrift())
+	require.NotZero(t, report.AccountsChecked)
+	require.NotZero(t, report.TransfersChecked)
+
+	driftedAccounts := make(map[int64]AccountDrift)
+	for _, drift := range report.AccountDrifts {
+		driftedAccounts[drift.AccountID] = drift
+	}
+	require.NotContains(t, driftedAccounts, account1.ID)
+	require.NotContains(t, driftedAccounts, account2.ID)
+	require.Contains(t, driftedAccounts, drifted.ID)
+	require.Equal(t, int64(50), driftedAccounts[drifted.ID].Drift)
+
+	for _, drift := range report.TransferDrifts {
+		require.NotEqual(t, result.Transfer.ID, drift.TransferID)
+	}
+
+	//报告保存之后可以查询到
+	run, err := testQueries.GetLatestReconciliationRun(context.Background())
+	require.NoError(t, err)
+	require.GreaterOrEqual(t, run.ID, report.RunID)
+	require.True(t, run.HasDrift)
+
+	var saved ReconciliationReport
+	require.NoError(t, json.Unmarshal(run.Report, &saved))
+	require.NotZero(t, saved.AccountsChecked)
+}
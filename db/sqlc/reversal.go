@@ -0,0 +1,131 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/leilei3167/bank/db/util"
+)
+
+var (
+	ErrTransferAlreadyReversed = errors.New("transfer has already been fully reversed")
+	ErrRefundExceedsAmount     = errors.New("refund amount exceeds the remaining amount of the transfer")
+	ErrReverseReversal         = errors.New("cannot reverse a reversal transfer")
+)
+
+//冲正(退款)的参数,Amount以原转账转出方的货币计,为0时退还剩余的全部金额
+type ReverseTransferTxParams struct {
+	TransferID int64 `json:"transfer_id"`
+	Amount     int64 `json:"amount"`
+}
+
+//冲正的结果,Transfer为新创建的反向转账,Refunded为包括本次在内已经退还的总金额
+type ReverseTransferTxResult struct {
+	TransferTxResult
+	Original Transfer `json:"original"`
+	Refunded int64    `json:"refunded"`
+}
+
+//为一笔转账创建反向的转账,把钱从原来的转入方退回原来的转出方,新转账的reversal_of指向原转账
+//可以分多次部分退款,累计退款不能超过原转账的金额,全部退还之后不能再次冲正
+//冻结的账户不能冲正,返回ErrAccountFrozen
+//手续费不退还;跨币种转账按原汇率的倒数换算,最后一次退款从转入方扣除剩余的全部金额,避免舍入误差累积
+func (store *SQLStore) ReverseTransferTx(ctx context.Context, arg ReverseTransferTxParams) (ReverseTransferTxResult, error) {
+	var result ReverseTransferTxResult
+
+	err := store.execTx(ctx, transferTxOptions, func(q *Queries) error {
+		result = ReverseTransferTxResult{}
+
+		//锁住原转账,同一笔转账的并发冲正会在这里排队,不会超额退款
+		original, err := q.GetTransferForUpdate(ctx, arg.TransferID)
+		if err != nil {
+			return err
+		}
+		if original.ReversalOf.Valid {
+			return ErrReverseReversal
+		}
+		result.Original = original
+
+		reversed, err := q.SumTransferReversals(ctx, sql.NullInt64{Int64: original.ID, Valid: true})
+		if err != nil {
+			return err
+		}
+		remaining := original.Amount - reversed.RefundedAmount
+		if remaining <= 0 {
+			return ErrTransferAlreadyReversed
+		}
+
+		amount := arg.Amount
+		if amount == 0 {
+			amount = remaining
+		}
+		if amount > remaining {
+			return fmt.Errorf("remaining %d: %w", remaining, ErrRefundExceedsAmount)
+		}
+
+		//从原转入方扣除的金额,以原转入方的货币计
+		var debit int64
+		if amount == remaining {
+			debit = original.CreditedAmount - reversed.DebitedAmount
+		} else {
+			//按比例换算,乘积可能超出int64,用big.Int计算
+			product := new(big.Int).Mul(big.NewInt(amount), big.NewInt(original.CreditedAmount))
+			debit = util.RoundHalfEven(new(big.Rat).SetFrac(product, big.NewInt(original.Amount))).Int64()
+		}
+		if debit <= 0 {
+			return util.ErrConvertedAmountZero
+		}
+
+		//原转入方是这次的转出方,同样按照id的顺序加锁并检查余额
+		var fromAccount, toAccount Account
+		if original.ToAccountID < original.FromAccountID {
+			fromAccount, toAccount, err = lockAccounts(ctx, q, original.ToAccountID, original.FromAccountID)
+		} else {
+			toAccount, fromAccount, err = lockAccounts(ctx, q, original.FromAccountID, original.ToAccountID)
+		}
+		if err != nil {
+			return err
+		}
+		//和普通转账相同,冻结的账户既不能退出也不能收到退款,解冻之后再冲正
+		for _, account := range []Account{fromAccount, toAccount} {
+			if account.IsFrozen {
+				return fmt.Errorf("account [%v]: %w", account.ID, ErrAccountFrozen)
+			}
+		}
+		if fromAccount.Balance < debit {
+			return fmt.Errorf("account [%v]: %w", fromAccount.ID, ErrInsufficientBalance)
+		}
+
+		rate := identityExchangeRate
+		if fromAccount.Currency != toAccount.Currency {
+			rate, err = util.InvertExchangeRate(original.ExchangeRate)
+			if err != nil {
+				return err
+			}
+		}
+
+		transfer, err := q.CreateTransfer(ctx, CreateTransferParams{
+			FromAccountID:  original.ToAccountID,
+			ToAccountID:    original.FromAccountID,
+			Amount:         debit,
+			CreditedAmount: amount,
+			ExchangeRate:   rate,
+			ReversalOf:     sql.NullInt64{Int64: original.ID, Valid: true},
+		})
+		if err != nil {
+			return err
+		}
+
+		result.TransferTxResult, err = postTransfer(ctx, q, JournalKindReversal, transfer, fromAccount, toAccount)
+		if err != nil {
+			return err
+		}
+		result.Refunded = reversed.RefundedAmount + amount
+		return nil
+	})
+
+	return result, err
+}
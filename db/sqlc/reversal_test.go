@@ -0,0 +1,182 @@
+package db
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestReverseTransferTx(t *testing.T) {
+	store := NewStore(testDB)
+	account1 := createAccountWithBalance(t, 1000)
+	account2 := createAccountWithBalance(t, 1000)
+	_, err := testDB.Exec("UPDATE accounts SET currency = $2 WHERE id = $1", account2.ID, account1.Currency)
+	require.NoError(t, err)
+
+	original, err := store.TransferTx(context.Background(), TransferTxParams{
+		FromAccountID: account1.ID,
+		ToAccountID:   account2.ID,
+		Amount:        100,
+	})
+	require.NoError(t, err)
+
+	//部分退款
+	result, err := store.ReverseTransferTx(context.Background(), ReverseTransferTxParams{
+		TransferID: original.Transfer.ID,
+		Amount:     30,
+	})
+	require.NoError(t, err)
+	require.Equal(t, original.Transfer.ID, result.Transfer.ReversalOf.Int64)
+	require.Equal(t, account2.ID, result.Transfer.FromAccountID)
+	require.Equal(t, account1.ID, result.Transfer.ToAccountID)
+	require.Equal(t, int64(30), result.Transfer.Amount)
+	require.Equal(t, int64(30), result.Transfer.CreditedAmount)
+	require.Equal(t, int64(30), result.Refunded)
+	require.Equal(t, int64(-30), result.FromEntry.Amount)
+	require.Equal(t, int64(30), result.ToEntry.Amount)
+	require.Equal(t, account1.Balance-70, result.ToAccount.Balance)
+	require.Equal(t, account2.Balance+70, result.FromAccount.Balance)
+
+	journal, err := testQueries.GetJournal(context.Background(), result.FromEntry.JournalID.Int64)
+	require.NoError(t, err)
+	require.Equal(t, JournalKindReversal, journal.Kind)
+
+	//累计退款不能超过原转账的金额
+	_, err = store.ReverseTransferTx(context.Background(), ReverseTransferTxParams{
+		TransferID: original.Transfer.ID,
+		Amount:     71,
+	})
+	require.ErrorIs(t, err, ErrRefundExceedsAmount)
+
+	//不传金额时退还剩余的全部金额
+	result, err = store.ReverseTransferTx(context.Background(), ReverseTransferTxParams{
+		TransferID: original.Transfer.ID,
+	})
+	require.NoError(t, err)
+	require.Equal(t, int64(70), result.Transfer.Amount)
+	require.Equal(t, int64(100), result.Refunded)
+	require.Equal(t, account1.Balance, result.ToAccount.Balance)
+	require.Equal(t, account2.Balance, result.FromAccount.Balance)
+
+	//全部退还之后不能再次冲正
+	_, err = store.ReverseTransferTx(context.Background(), ReverseTransferTxParams{
+		TransferID: original.Transfer.ID,
+	})
+	require.ErrorIs(t, err, ErrTransferAlreadyReversed)
+
+	//冲正产生的转账本身不能再冲正
+	_, err = store.ReverseTransferTx(context.Background(), ReverseTransferTxParams{
+		TransferID: result.Transfer.ID,
+	})
+	require.ErrorIs(t, err, ErrReverseReversal)
+}
+
+func TestReverseTransferTxCrossCurrency(t *testing.T) {
+	store := NewStore(testDB)
+	account1 := createAccountWithBalance(t, 1000)
+	account2 := createAccountWithBalance(t, 1000)
+
+	base, quote := createRandomCurrency(t, 2).Code, createRandomCurrency(t, 2).Code
+	_, err := testDB.Exec("UPDATE accounts SET currency = $2 WHERE id = $1", account1.ID, base)
+	require.NoError(t, err)
+	_, err = testDB.Exec("UPDATE accounts SET currency = $2 WHERE id = $1", account2.ID, quote)
+	require.NoError(t, err)
+	createRandomExchangeRate(t, base, quote, "7.125", time.Now().Add(-time.Minute))
+
+	//100 -> 712
+	original, err := store.TransferTx(context.Background(), TransferTxParams{
+		FromAccountID: account1.ID,
+		ToAccountID:   account2.ID,
+		Amount:        100,
+	})
+	require.NoError(t, err)
+
+	//40 * 712 / 100 = 284.8,舍入为285
+	result, err := store.ReverseTransferTx(context.Background(), ReverseTransferTxParams{
+		TransferID: original.Transfer.ID,
+		Amount:     40,
+	})
+	require.NoError(t, err)
+	require.Equal(t, int64(285), result.Transfer.Amount)
+	require.Equal(t, int64(40), result.Transfer.CreditedAmount)
+	require.Equal(t, "0.1403508772", result.Transfer.ExchangeRate)
+
+	//最后一次退款扣除剩余的全部金额,双方余额恢复原状
+	result, err = store.ReverseTransferTx(context.Background(), ReverseTransferTxParams{
+		TransferID: original.Transfer.ID,
+	})
+	require.NoError(t, err)
+	require.Equal(t, int64(712-285), result.Transfer.Amount)
+	require.Equal(t, int64(60), result.Transfer.CreditedAmount)
+	require.Equal(t, account1.Balance, result.ToAccount.Balance)
+	require.Equal(t, account2.Balance, result.FromAccount.Balance)
+}
+
+func TestReverseTransferTxInsufficientBalance(t *testing.T) {
+	store := NewStore(testDB)
+	account1 := createAccountWithBalance(t, 1000)
+	account2 := createAccountWithBalance(t, 0)
+	_, err := testDB.Exec("UPDATE accounts SET currency = $2 WHERE id = $1", account2.ID, account1.Currency)
+	require.NoError(t, err)
+
+	original, err := store.TransferTx(context.Background(), TransferTxParams{
+		FromAccountID: account1.ID,
+		ToAccountID:   account2.ID,
+		Amount:        100,
+	})
+	require.NoError(t, err)
+
+	//转入方已经把钱转走,不能透支退款
+	_, err = store.TransferTx(context.Background(), TransferTxParams{
+		FromAccountID: account2.ID,
+		ToAccountID:   account1.ID,
+		Amount:        50,
+	})
+	require.NoError(t, err)
+
+	_, err = store.ReverseTransferTx(context.Background(), ReverseTransferTxParams{
+		TransferID: original.Transfer.ID,
+	})
+	require.ErrorIs(t, err, ErrInsufficientBalance)
+}
+
+func TestReverseTransferTxFrozenAccount(t *testing.T) {
+	store := NewStore(testDB)
+	account1 := createAccountWithBalance(t, 1000)
+	account2 := createAccountWithBalance(t, 1000)
+	_, err := testDB.Exec("UPDATE accounts SET currency = $2 WHERE id = $1", account2.ID, account1.Currency)
+	require.NoError(t, err)
+
+	original, err := store.TransferTx(context.Background(), TransferTxParams{
+		FromAccountID: account1.ID,
+		ToAccountID:   account2.ID,
+		Amount:        100,
+	})
+	require.NoError(t, err)
+
+	//原转出方和原转入方任何一个被冻结都不能冲正,余额保持不变
+	for _, frozen := range []Account{account1, account2} {
+		_, err = testQueries.SetAccountFrozen(context.Background(), SetAccountFrozenParams{ID: frozen.ID, IsFrozen: true})
+		require.NoError(t, err)
+
+		_, err = store.ReverseTransferTx(context.Background(), ReverseTransferTxParams{
+			TransferID: original.Transfer.ID,
+		})
+		require.ErrorIs(t, err, ErrAccountFrozen)
+
+		_, err = testQueries.SetAccountFrozen(context.Background(), SetAccountFrozenParams{ID: frozen.ID, IsFrozen: false})
+		require.NoError(t, err)
+	}
+
+	updatedAccount2, err := testQueries.GetAccount(context.Background(), account2.ID)
+	require.NoError(t, err)
+	require.Equal(t, original.ToAccount.Balance, updatedAccount2.Balance)
+
+	//解冻之后可以冲正
+	_, err = store.ReverseTransferTx(context.Background(), ReverseTransferTxParams{
+		TransferID: original.Transfer.ID,
+	})
+	require.NoError(t, err)
+}
@@ -0,0 +1,191 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/leilei3167/bank/db/util"
+)
+
+//定时转账的重复规则
+const (
+	RecurrenceOnce    = "once"
+	RecurrenceDaily   = "daily"
+	RecurrenceWeekly  = "weekly"
+	RecurrenceMonthly = "monthly"
+)
+
+//定时转账的状态,只执行一次的转账执行后变为completed,用户取消后变为cancelled,都不会再执行
+const (
+	ScheduledTransferActive    = "active"
+	ScheduledTransferCompleted = "completed"
+	ScheduledTransferCancelled = "cancelled"
+)
+
+//每次执行的结果
+const (
+	ScheduledRunSucceeded = "succeeded"
+	ScheduledRunFailed    = "failed"
+)
+
+//计算下一次执行的时间,返回的时间一定晚于now,停机期间错过的多次执行只补执行一次
+//按月执行时保持startsAt的日期,当月没有该日期时(如31号)在月底执行
+//只执行一次的转账返回false
+func NextScheduledRun(recurrence string, startsAt, previous, now time.Time) (time.Time, bool) {
+	next := previous
+	for !next.After(now) {
+		switch recurrence {
+		case RecurrenceDaily:
+			next = next.AddDate(0, 0, 1)
+		case RecurrenceWeekly:
+			next = next.AddDate(0, 0, 7)
+		case RecurrenceMonthly:
+			next = addMonthKeepDay(next, startsAt.Day())
+		default:
+			return time.Time{}, false
+		}
+	}
+	return next, true
+}
+
+//下个月的day号,超过当月的天数时取月底
+func addMonthKeepDay(t time.Time, day int) time.Time {
+	year, month, _ := t.Date()
+	month++
+	//下下个月的第0天即下个月的最后一天
+	if last := time.Date(year, month+1, 0, 0, 0, 0, 0, t.Location()).Day(); day > last {
+		day = last
+	}
+	return time.Date(year, month, day, t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), t.Location())
+}
+
+type RunScheduledTransferResult struct {
+	Scheduled ScheduledTransfer    `json:"scheduled"` //执行之后的定时转账,next_run_at已经推进
+	Run       ScheduledTransferRun `json:"run"`
+	Transfer  TransferTxResult     `json:"transfer"` //执行成功时的转账,失败时为空
+}
+
+//数据库出错、重试次数用完等系统错误之后,定时转账推迟这么久再执行
+const ScheduledTransferRetryDelay = 10 * time.Minute
+
+//执行一笔已经到期的定时转账,没有到期的转账时返回sql.ErrNoRows
+//领取、转账、记录结果和推进下次执行时间在同一个事务中完成,进程在执行中退出时整个事务回滚,转账之后仍然到期,不会漏转也不会重复转账
+//多个实例同时执行时用SKIP LOCKED跳过其他实例正在执行的转账
+//余额不足、账户冻结等客户的问题记录为失败的执行并照常推进
+//其他错误回滚事务,再用单独的事务记录失败并推迟ScheduledTransferRetryDelay,返回错误的同时result.Scheduled不为空,
+//调用方可以跳过这笔继续执行其他到期的转账,否则排在最前面的这笔会一直被领取,挡住后面所有的转账
+func (store *SQLStore) RunScheduledTransferTx(ctx context.Context, now time.Time) (RunScheduledTransferResult, error) {
+	var result RunScheduledTransferResult
+	var claimed ScheduledTransfer
+
+	err := store.execTx(ctx, transferTxOptions, func(q *Queries) error {
+		result = RunScheduledTransferResult{}
+		claimed = ScheduledTransfer{}
+
+		scheduled, err := q.ClaimDueScheduledTransfer(ctx, now)
+		if err != nil {
+			return err
+		}
+		claimed = scheduled
+
+		run := CreateScheduledTransferRunParams{
+			ScheduledTransferID: scheduled.ID,
+			Status:              ScheduledRunSucceeded,
+			ScheduledFor:        scheduled.NextRunAt,
+		}
+		transfer, err := store.scheduledTransferTx(ctx, q, scheduled)
+		if err != nil {
+			if !isScheduledTransferRejection(err) {
+				return err
+			}
+			run.Status = ScheduledRunFailed
+			run.Error = err.Error()
+		} else {
+			result.Transfer = transfer
+			run.TransferID = sql.NullInt64{Int64: transfer.Transfer.ID, Valid: true}
+		}
+
+		result.Run, err = q.CreateScheduledTransferRun(ctx, run)
+		if err != nil {
+			return err
+		}
+
+		advance := AdvanceScheduledTransferParams{
+			ID:        scheduled.ID,
+			NextRunAt: scheduled.NextRunAt,
+			Status:    ScheduledTransferActive,
+			LastRunAt: sql.NullTime{Time: now, Valid: true},
+		}
+		//推迟重试过的转账next_run_at不在原来的周期上,从starts_at开始计算
+		if next, ok := NextScheduledRun(scheduled.Recurrence, scheduled.StartsAt, scheduled.StartsAt, now); ok {
+			advance.NextRunAt = next
+		} else {
+			advance.Status = ScheduledTransferCompleted
+		}
+		result.Scheduled, err = q.AdvanceScheduledTransfer(ctx, advance)
+		return err
+	})
+	//ctx被取消时是进程在退出,不是这笔转账的问题,保持到期留给下次启动
+	if err != nil && claimed.ID != 0 && ctx.Err() == nil {
+		return store.retryScheduledTransferTx(ctx, claimed, now, err)
+	}
+
+	return result, err
+}
+
+//记录失败的执行并推迟下次执行,其他实例在这期间已经执行了这笔转账时(next_run_at已经变化)不做修改
+//返回的错误都包含执行转账时的错误cause
+func (store *SQLStore) retryScheduledTransferTx(ctx context.Context, scheduled ScheduledTransfer, now time.Time, cause error) (RunScheduledTransferResult, error) {
+	var result RunScheduledTransferResult
+
+	err := store.execTx(ctx, nil, func(q *Queries) error {
+		result = RunScheduledTransferResult{}
+
+		var err error
+		result.Scheduled, err = q.RetryScheduledTransfer(ctx, RetryScheduledTransferParams{
+			RetryAt:   now.Add(ScheduledTransferRetryDelay),
+			ID:        scheduled.ID,
+			NextRunAt: scheduled.NextRunAt,
+		})
+		if err != nil {
+			return err
+		}
+
+		result.Run, err = q.CreateScheduledTransferRun(ctx, CreateScheduledTransferRunParams{
+			ScheduledTransferID: scheduled.ID,
+			Status:              ScheduledRunFailed,
+			Error:               cause.Error(),
+			ScheduledFor:        scheduled.NextRunAt,
+		})
+		return err
+	})
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return RunScheduledTransferResult{Scheduled: scheduled}, fmt.Errorf("scheduled transfer [%v]: %w", scheduled.ID, cause)
+	case err != nil:
+		//没能推迟,这笔转账仍然到期
+		return RunScheduledTransferResult{}, fmt.Errorf("scheduled transfer [%v]: %v, record failure: %w", scheduled.ID, cause, err)
+	}
+	return result, fmt.Errorf("scheduled transfer [%v] retry at %v: %w",
+		scheduled.ID, result.Scheduled.NextRunAt.Format(time.RFC3339), cause)
+}
+
+//冻结的账户不能转出也不能转入,和手动转账的规则相同,由transferTx在加锁之后检查
+func (store *SQLStore) scheduledTransferTx(ctx context.Context, q *Queries, scheduled ScheduledTransfer) (TransferTxResult, error) {
+	return store.transferTx(ctx, q, TransferTxParams{
+		FromAccountID: scheduled.FromAccountID,
+		ToAccountID:   scheduled.ToAccountID,
+		Amount:        scheduled.Amount,
+	})
+}
+
+//这些错误不会改变数据库的状态,事务可以继续记录失败的结果
+func isScheduledTransferRejection(err error) bool {
+	return errors.Is(err, ErrInsufficientBalance) ||
+		errors.Is(err, ErrAccountFrozen) ||
+		errors.Is(err, ErrExchangeRateNotFound) ||
+		errors.Is(err, util.ErrConvertedAmountZero)
+}
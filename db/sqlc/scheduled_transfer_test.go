@@ -0,0 +1,191 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/leilei3167/bank/db/util"
+	"github.com/stretchr/testify/require"
+)
+
+func createRandomScheduledTransfer(t *testing.T, account1, account2 Account, amount int64, recurrence string, startsAt time.Time) ScheduledTransfer {
+	arg := CreateScheduledTransferParams{
+		Owner:         account1.Owner,
+		FromAccountID: account1.ID,
+		ToAccountID:   account2.ID,
+		Amount:        amount,
+		Recurrence:    recurrence,
+		StartsAt:      startsAt,
+	}
+	scheduled, err := testQueries.CreateScheduledTransfer(context.Background(), arg)
+	require.NoError(t, err)
+	require.Equal(t, ScheduledTransferActive, scheduled.Status)
+	require.WithinDuration(t, startsAt, scheduled.NextRunAt, time.Second)
+	require.False(t, scheduled.LastRunAt.Valid)
+	return scheduled
+}
+
+//测试数据库中可能还有其他测试留下的到期转账,一直执行到轮到目标转账为止
+func runScheduledTransferUntil(t *testing.T, store *SQLStore, id int64, now time.Time) RunScheduledTransferResult {
+	for i := 0; i < 100; i++ {
+		result, err := store.RunScheduledTransferTx(context.Background(), now)
+		require.NoError(t, err)
+		if result.Scheduled.ID == id {
+			return result
+		}
+	}
+	t.Fatalf("scheduled transfer %d was not run", id)
+	return RunScheduledTransferResult{}
+}
+
+func TestNextScheduledRun(t *testing.T) {
+	startsAt := time.Date(2024, time.January, 31, 9, 0, 0, 0, time.UTC)
+
+	//按月执行时保持31号,当月没有时在月底
+	next, ok := NextScheduledRun(RecurrenceMonthly, startsAt, startsAt, startsAt)
+	require.True(t, ok)
+	require.Equal(t, time.Date(2024, time.February, 29, 9, 0, 0, 0, time.UTC), next)
+	next, ok = NextScheduledRun(RecurrenceMonthly, startsAt, next, next)
+	require.True(t, ok)
+	require.Equal(t, time.Date(2024, time.March, 31, 9, 0, 0, 0, time.UTC), next)
+
+	//错过的多次执行只补一次,下一次在now之后
+	now := startsAt.Add(72*time.Hour + time.Minute)
+	next, ok = NextScheduledRun(RecurrenceDaily, startsAt, startsAt, now)
+	require.True(t, ok)
+	require.Equal(t, startsAt.AddDate(0, 0, 4), next)
+
+	next, ok = NextScheduledRun(RecurrenceWeekly, startsAt, startsAt, startsAt)
+	require.True(t, ok)
+	require.Equal(t, startsAt.AddDate(0, 0, 7), next)
+
+	_, ok = NextScheduledRun(RecurrenceOnce, startsAt, startsAt, startsAt)
+	require.False(t, ok)
+}
+
+func TestRunScheduledTransferTx(t *testing.T) {
+	store := NewStore(testDB)
+	account1 := createAccountWithBalance(t, 1000)
+	account2 := createAccountWithBalance(t, 1000)
+	_, err := testDB.Exec("UPDATE accounts SET currency = $2 WHERE id = $1", account2.ID, account1.Currency)
+	require.NoError(t, err)
+
+	//使用很早的时间,避免影响正在运行的调度器
+	startsAt := time.Date(2000, time.January, 1, 0, 0, 0, 0, time.UTC).Add(time.Duration(util.RandomInt(0, 1000)) * time.Minute)
+	scheduled := createRandomScheduledTransfer(t, account1, account2, 100, RecurrenceDaily, startsAt)
+	defer testQueries.CancelScheduledTransfer(context.Background(), scheduled.ID)
+
+	result := runScheduledTransferUntil(t, store, scheduled.ID, startsAt)
+	require.Equal(t, ScheduledRunSucceeded, result.Run.Status)
+	require.True(t, result.Run.TransferID.Valid)
+	require.WithinDuration(t, startsAt, result.Run.ScheduledFor, time.Second)
+	require.Equal(t, ScheduledTransferActive, result.Scheduled.Status)
+	require.WithinDuration(t, startsAt.AddDate(0, 0, 1), result.Scheduled.NextRunAt, time.Second)
+	require.True(t, result.Scheduled.LastRunAt.Valid)
+
+	transfer, err := testQueries.GetTransfer(context.Background(), result.Run.TransferID.Int64)
+	require.NoError(t, err)
+	require.Equal(t, account1.ID, transfer.FromAccountID)
+	require.Equal(t, int64(100), transfer.Amount)
+	require.Equal(t, transfer.ID, result.Transfer.Transfer.ID)
+	require.Equal(t, account1.Currency, result.Transfer.FromAccount.Currency)
+
+	//余额不足时记录失败的执行,只执行一次的转账同样结束
+	once := createRandomScheduledTransfer(t, account1, account2, 5000, RecurrenceOnce, startsAt)
+	result = runScheduledTransferUntil(t, store, once.ID, startsAt)
+	require.Equal(t, ScheduledRunFailed, result.Run.Status)
+	require.False(t, result.Run.TransferID.Valid)
+	require.Zero(t, result.Transfer.Transfer.ID)
+	require.Contains(t, result.Run.Error, ErrInsufficientBalance.Error())
+	require.Equal(t, ScheduledTransferCompleted, result.Scheduled.Status)
+
+	runs, err := testQueries.ListScheduledTransferRuns(context.Background(), ListScheduledTransferRunsParams{
+		ScheduledTransferID: once.ID,
+		LimitCount:          10,
+	})
+	require.NoError(t, err)
+	require.Len(t, runs, 1)
+	require.Equal(t, result.Run.ID, runs[0].ID)
+
+	account1, err = testQueries.GetAccount(context.Background(), account1.ID)
+	require.NoError(t, err)
+	require.Equal(t, int64(900), account1.Balance)
+}
+
+func TestRunScheduledTransferTxFrozenAccount(t *testing.T) {
+	store := NewStore(testDB)
+	account1 := createAccountWithBalance(t, 1000)
+	account2 := createAccountWithBalance(t, 1000)
+	_, err := testDB.Exec("UPDATE accounts SET currency = $2 WHERE id = $1", account2.ID, account1.Currency)
+	require.NoError(t, err)
+	_, err = testQueries.SetAccountFrozen(context.Background(), SetAccountFrozenParams{ID: account2.ID, IsFrozen: true})
+	require.NoError(t, err)
+
+	startsAt := time.Date(2000, time.January, 1, 0, 0, 0, 0, time.UTC).Add(time.Duration(util.RandomInt(0, 1000)) * time.Minute)
+	scheduled := createRandomScheduledTransfer(t, account1, account2, 100, RecurrenceOnce, startsAt)
+
+	result := runScheduledTransferUntil(t, store, scheduled.ID, startsAt)
+	require.Equal(t, ScheduledRunFailed, result.Run.Status)
+	require.Contains(t, result.Run.Error, ErrAccountFrozen.Error())
+}
+
+func TestRetryScheduledTransferTx(t *testing.T) {
+	store := NewStore(testDB)
+	account1 := createRandomAccount(t)
+	account2 := createRandomAccount(t)
+	startsAt := time.Date(2000, time.January, 1, 0, 0, 0, 0, time.UTC).Add(time.Duration(util.RandomInt(0, 1000)) * time.Minute)
+	scheduled := createRandomScheduledTransfer(t, account1, account2, 100, RecurrenceDaily, startsAt)
+	defer testQueries.CancelScheduledTransfer(context.Background(), scheduled.ID)
+
+	//记录失败的执行并推迟,不再到期
+	cause := errors.New("journal is not balanced")
+	result, err := store.retryScheduledTransferTx(context.Background(), scheduled, startsAt, cause)
+	require.ErrorIs(t, err, cause)
+	require.Equal(t, ScheduledTransferActive, result.Scheduled.Status)
+	require.WithinDuration(t, startsAt.Add(ScheduledTransferRetryDelay), result.Scheduled.NextRunAt, time.Second)
+	require.Equal(t, ScheduledRunFailed, result.Run.Status)
+	require.Equal(t, cause.Error(), result.Run.Error)
+	require.WithinDuration(t, startsAt, result.Run.ScheduledFor, time.Second)
+
+	//next_run_at已经变化,不会再推迟一次
+	result, err = store.retryScheduledTransferTx(context.Background(), scheduled, startsAt, cause)
+	require.ErrorIs(t, err, cause)
+	require.Equal(t, scheduled.ID, result.Scheduled.ID)
+	require.Zero(t, result.Run.ID)
+}
+
+func TestUpdateAndCancelScheduledTransfer(t *testing.T) {
+	account1 := createRandomAccount(t)
+	account2 := createRandomAccount(t)
+	startsAt := time.Now().Add(time.Hour)
+	scheduled := createRandomScheduledTransfer(t, account1, account2, 100, RecurrenceWeekly, startsAt)
+
+	//修改执行时间的同时修改按月执行的基准日期
+	nextRunAt := startsAt.Add(24 * time.Hour)
+	updated, err := testQueries.UpdateScheduledTransfer(context.Background(), UpdateScheduledTransferParams{
+		ID:        scheduled.ID,
+		Amount:    sql.NullInt64{Int64: 200, Valid: true},
+		NextRunAt: sql.NullTime{Time: nextRunAt, Valid: true},
+	})
+	require.NoError(t, err)
+	require.Equal(t, int64(200), updated.Amount)
+	require.Equal(t, RecurrenceWeekly, updated.Recurrence)
+	require.WithinDuration(t, nextRunAt, updated.NextRunAt, time.Second)
+	require.WithinDuration(t, nextRunAt, updated.StartsAt, time.Second)
+
+	cancelled, err := testQueries.CancelScheduledTransfer(context.Background(), scheduled.ID)
+	require.NoError(t, err)
+	require.Equal(t, ScheduledTransferCancelled, cancelled.Status)
+
+	//取消之后不能再修改或取消
+	_, err = testQueries.UpdateScheduledTransfer(context.Background(), UpdateScheduledTransferParams{
+		ID:     scheduled.ID,
+		Amount: sql.NullInt64{Int64: 300, Valid: true},
+	})
+	require.ErrorIs(t, err, sql.ErrNoRows)
+	_, err = testQueries.CancelScheduledTransfer(context.Background(), scheduled.ID)
+	require.ErrorIs(t, err, sql.ErrNoRows)
+}
@@ -3,39 +3,118 @@ package db
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"math/rand"
+	"time"
+
+	"github.com/leilei3167/bank/db/util"
+	"github.com/leilei3167/bank/logger"
+	"github.com/lib/pq"
 )
 
 //通过内嵌Queries继承其所有方法,并添加更多方法来支持事务
 type SQLStore struct {
 	*Queries //只适用于单次查询
 	db       *sql.DB
+
+	maxTxAttempts int           //事务因序列化失败或死锁被中止时最多执行的次数
+	retryHook     TxRetryHook   //每次重试前调用,可用于统计重试次数
+	queryObserver QueryObserver //每条SQL执行之后调用
+	queryTracer   QueryTracer   //每条SQL执行之前调用
 }
 
 //定义一个接口用于mock,包含之前数据库交互的所有方法
 type Store interface {
 	Querier
 	TransferTx(ctx context.Context, arg TransferTxParams) (TransferTxResult, error)
+	IdempotentTransferTx(ctx context.Context, arg IdempotentTransferTxParams) (IdempotentTransferTxResult, error)
+	ReverseTransferTx(ctx context.Context, arg ReverseTransferTxParams) (ReverseTransferTxResult, error)
+	RunScheduledTransferTx(ctx context.Context, now time.Time) (RunScheduledTransferResult, error)
+	DepositTx(ctx context.Context, arg CashTxParams) (CashTxResult, error)
+	WithdrawTx(ctx context.Context, arg CashTxParams) (CashTxResult, error)
+	ListEntriesWithBalance(ctx context.Context, arg ListEntriesWithBalanceParams) ([]EntryWithBalance, error)
+	AccountStatementTx(ctx context.Context, arg AccountStatementParams) (AccountStatement, error)
+	ReconcileLedger(ctx context.Context, arg ReconcileParams) (ReconciliationReport, error)
+	Ping(ctx context.Context) error
+	GetMigrationVersion(ctx context.Context) (MigrationVersion, error)
 }
 
+//事务重试的回调,attempt为刚刚失败的是第几次执行(从1开始),err为导致重试的错误
+type TxRetryHook func(ctx context.Context, attempt int, err error)
+
+//NewStore的可选配置
+type StoreOption func(*SQLStore)
+
+//设置事务最多执行的次数(包括第一次),小于1时按1处理
+func WithMaxTxAttempts(n int) StoreOption {
+	return func(store *SQLStore) {
+		if n < 1 {
+			n = 1
+		}
+		store.maxTxAttempts = n
+	}
+}
+
+//设置事务重试时的回调
+func WithTxRetryHook(hook TxRetryHook) StoreOption {
+	return func(store *SQLStore) {
+		store.retryHook = hook
+	}
+}
+
+const (
+	defaultMaxTxAttempts = 10
+	txRetryBaseDelay     = 5 * time.Millisecond
+	txRetryMaxDelay      = 200 * time.Millisecond
+)
+
 //使用db构建Store实例,
-func NewStore(db *sql.DB) *SQLStore {
-	return &SQLStore{
-		db:      db,
-		Queries: New(db), //直接用db New一个Queries
+func NewStore(db *sql.DB, opts ...StoreOption) *SQLStore {
+	store := &SQLStore{
+		db:            db,
+		maxTxAttempts: defaultMaxTxAttempts,
 	}
+	for _, opt := range opts {
+		opt(store)
+	}
+	store.Queries = New(store.observe(db)) //直接用db New一个Queries
+	return store
 }
 
-//构建事务操作,传入一个ctx和一个回调函数
+//构建事务操作,传入一个ctx,事务选项和一个回调函数
+//opts为nil时使用数据库默认的隔离级别(读已提交)
+//事务因序列化失败或死锁被中止时会重新执行fn,因此fn必须可以安全地重复执行
 //不希望其他包调用此函数
-func (store *SQLStore) execTx(ctx context.Context, fn func(*Queries) error) error {
-	//开始事务,可设置隔离级别(默认读已提交)
-	tx, err := store.db.BeginTx(ctx, nil)
+func (store *SQLStore) execTx(ctx context.Context, opts *sql.TxOptions, fn func(*Queries) error) error {
+	for attempt := 1; ; attempt++ {
+		err := store.runTx(ctx, opts, fn)
+		if err == nil || !isRetryableTxError(err) || attempt >= store.maxTxAttempts {
+			return err
+		}
+
+		logger.Ctx(ctx).Warn().Err(err).Int("attempt", attempt).Msg("事务被数据库中止,准备重试")
+		if store.retryHook != nil {
+			store.retryHook(ctx, attempt, err)
+		}
+		//等待一段随机的时间再重试,避免冲突的事务同时重试而再次冲突
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(txRetryBackoff(attempt)):
+		}
+	}
+}
+
+//执行一次事务
+func (store *SQLStore) runTx(ctx context.Context, opts *sql.TxOptions, fn func(*Queries) error) error {
+	tx, err := store.db.BeginTx(ctx, opts)
 	if err != nil {
 		return err
 	}
 	//此处创建的tx,同时也是实现了DBTX的(方法都满足),调用new生成Queries,用于在事务中组合各种单次数据库操作
-	q := New(tx)
+	q := New(store.observe(tx))
 	//现在有了能够再事务中执行操作的Queries
 	//执行事务
 	err = fn(q)
@@ -44,21 +123,45 @@ func (store *SQLStore) execTx(ctx context.Context, fn func(*Queries) error) erro
 		//要同时处理执行事务的错误和回滚出现的错误
 		rbErr := tx.Rollback()
 		if rbErr != nil {
-			return fmt.Errorf("事务错误:%v,回滚错误:%v", err, rbErr)
+			logger.Ctx(ctx).Error().Err(err).AnErr("rollback_error", rbErr).Msg("事务回滚失败")
+			return fmt.Errorf("事务错误:%w,回滚错误:%v", err, rbErr)
 		}
 		//回滚成功只返回事务失败的错误
 		return err
 	}
-	//如果事务执行成功,则提交,返回的错误直接返回给调用处
+	//如果事务执行成功,则提交,返回的错误直接返回给调用处(提交时也可能出现序列化失败)
 	return tx.Commit()
+}
+
+//serialization_failure和deadlock_detected表示事务被数据库中止,重新执行即可
+func isRetryableTxError(err error) bool {
+	var pqErr *pq.Error
+	if !errors.As(err, &pqErr) {
+		return false
+	}
+	return pqErr.Code == "40001" || pqErr.Code == "40P01"
+}
 
+//指数退避并加入随机抖动,第attempt次失败后等待[0,min(base*2^(attempt-1),max))
+func txRetryBackoff(attempt int) time.Duration {
+	delay := txRetryMaxDelay
+	if attempt < 16 {
+		if d := txRetryBaseDelay << (attempt - 1); d < delay {
+			delay = d
+		}
+	}
+	return time.Duration(rand.Int63n(int64(delay)))
 }
 
+//转账使用可串行化隔离级别,冲突时由execTx自动重试
+var transferTxOptions = &sql.TxOptions{Isolation: sql.LevelSerializable}
+
 //z转账相关的结构体
 type TransferTxParams struct {
 	FromAccountID int64 `json:"from_account_id"`
 	ToAccountID   int64 `json:"to_account_id"`
 	Amount        int64 `json:"amount"`
+	Fee           int64 `json:"fee"` //手续费,以转出账户的货币计,在Amount之外从转出账户扣除
 }
 
 //转账的结果,要求转账的记录的表,转出和接收方的账户表,转出和接收的记录表
@@ -70,8 +173,6 @@ type TransferTxResult struct {
 	ToEntry     Entry    `json:"to_entry"`
 }
 
-var txKey = struct{}{}
-
 //写一个转账的处理,需要传入转账的参数结构体,返回结果结构体
 //创建转账记录,添加account entries,更新account的balance
 
@@ -80,96 +181,486 @@ func (store *SQLStore) TransferTx(ctx context.Context, arg TransferTxParams) (Tr
 	var result TransferTxResult
 
 	//调用
-	err := store.execTx(ctx, func(q *Queries) error {
+	err := store.execTx(ctx, transferTxOptions, func(q *Queries) error {
 		//fn之内为多个语句的组合,任意一个失败都返回err到execTx,并且回滚
 		var err error
-		//TODO:判断转账金额是否大于FromAccount的余额
-		res, err := store.GetAccount(ctx, arg.FromAccountID)
+		result, err = store.transferTx(ctx, q, arg)
+		return err
+	})
+
+	return result, err
+}
+
+//转出账户余额不足以完成转账
+var ErrInsufficientBalance = errors.New("insufficient balance")
+
+//账户被冻结,不能参与转账和存取款
+var ErrAccountFrozen = errors.New("account is frozen")
+
+//转账的具体步骤,必须在事务中执行,q为事务中的Queries,以便和其他操作组合在同一个事务里
+func (store *SQLStore) transferTx(ctx context.Context, q *Queries, arg TransferTxParams) (TransferTxResult, error) {
+	var result TransferTxResult
+	var err error
+
+	//--------------------转账较为复杂,要考虑死锁问题----------------------
+	//先按照id从小到大的顺序锁住两个账户,确保多个事务都按照相同的顺序加锁
+	//余额检查必须在加锁之后进行,否则并发的转账都能通过检查而导致透支
+	var fromAccount, toAccount Account
+	if arg.FromAccountID < arg.ToAccountID {
+		fromAccount, toAccount, err = lockAccounts(ctx, q, arg.FromAccountID, arg.ToAccountID)
+	} else {
+		toAccount, fromAccount, err = lockAccounts(ctx, q, arg.ToAccountID, arg.FromAccountID)
+	}
+	if err != nil {
+		return result, err
+	}
+	//冻结检查同样要在加锁之后,加锁之前提交的冻结不会被忽略,加锁之后的冻结要等转账完成
+	//系统账户的分录只能由postTransfer等内部记账产生,不能作为转账的双方
+	for _, account := range []Account{fromAccount, toAccount} {
+		if IsSystemAccountOwner(account.Owner) {
+			return result, fmt.Errorf("account [%v]: %w", account.ID, ErrSystemAccount)
+		}
+		if account.IsFrozen {
+			return result, fmt.Errorf("account [%v]: %w", account.ID, ErrAccountFrozen)
+		}
+	}
+	if fromAccount.Balance < arg.Amount+arg.Fee {
+		return result, fmt.Errorf("account [%v]: %w", arg.FromAccountID, ErrInsufficientBalance)
+	}
+
+	//币种不同时按照当前生效的汇率换算转入方收到的金额
+	rate, creditedAmount, err := convertTransferAmount(ctx, q, fromAccount.Currency, toAccount.Currency, arg.Amount)
+	if err != nil {
+		return result, err
+	}
+
+	//1.用Queries调用创建转账记录的方法,并将结果写入result transfer字段
+	result.Transfer, err = q.CreateTransfer(ctx, CreateTransferParams{
+		FromAccountID:  arg.FromAccountID,
+		ToAccountID:    arg.ToAccountID,
+		Amount:         arg.Amount,
+		CreditedAmount: creditedAmount,
+		ExchangeRate:   rate,
+		Fee:            arg.Fee,
+	})
+	if err != nil {
+		return result, err
+	}
+
+	logger.Ctx(ctx).Debug().
+		Int64("transfer_id", result.Transfer.ID).
+		Int64("from_account_id", arg.FromAccountID).
+		Int64("to_account_id", arg.ToAccountID).
+		Int64("amount", arg.Amount).
+		Msg("创建Transfer")
+
+	//2.写入分录并修改余额,失败时返回错误,由execTx回滚整个事务
+	return postTransfer(ctx, q, JournalKindTransfer, result.Transfer, fromAccount, toAccount)
+}
+
+//为已经创建的转账记账,前两条分录分别是转出方和转入方,调用方需要已经锁住双方账户并检查过余额
+func postTransfer(ctx context.Context, q *Queries, kind string, transfer Transfer, fromAccount, toAccount Account) (TransferTxResult, error) {
+	result := TransferTxResult{Transfer: transfer}
+
+	postings := []Posting{
+		{AccountID: transfer.FromAccountID, Amount: -transfer.Amount},      //对于转出账户来讲,是负数
+		{AccountID: transfer.ToAccountID, Amount: transfer.CreditedAmount}, //收入账户为正,金额为换算后的金额
+	}
+	if fromAccount.Currency != toAccount.Currency {
+		//外汇清算账户收入转出的货币,付出转入的货币,两种货币各自平衡
+		fxFrom, err := systemAccount(ctx, q, FXAccountOwner, fromAccount.Currency)
 		if err != nil {
-			return err
+			return result, err
 		}
-		if res.Balance-arg.Amount < 0 {
-			err = fmt.Errorf("FromAccountID:%v余额不足!", arg.FromAccountID)
-			return err
+		fxTo, err := systemAccount(ctx, q, FXAccountOwner, toAccount.Currency)
+		if err != nil {
+			return result, err
+		}
+		postings = append(postings,
+			Posting{AccountID: fxFrom.ID, Amount: transfer.Amount},
+			Posting{AccountID: fxTo.ID, Amount: -transfer.CreditedAmount},
+		)
+	}
+	if transfer.Fee > 0 {
+		feeAccount, err := systemAccount(ctx, q, FeeAccountOwner, fromAccount.Currency)
+		if err != nil {
+			return result, err
 		}
+		postings = append(postings,
+			Posting{AccountID: transfer.FromAccountID, Amount: -transfer.Fee},
+			Posting{AccountID: feeAccount.ID, Amount: transfer.Fee},
+		)
+	}
+
+	posted, err := q.PostJournal(ctx, PostJournalParams{
+		Kind:       kind,
+		TransferID: sql.NullInt64{Int64: transfer.ID, Valid: true},
+		Postings:   postings,
+	})
+	if err != nil {
+		return result, err
+	}
+	result.FromEntry = posted.Entries[0]
+	result.ToEntry = posted.Entries[1]
+	result.FromAccount = posted.Accounts[transfer.FromAccountID]
+	result.ToAccount = posted.Accounts[transfer.ToAccountID]
+	return result, nil
+}
+
+//两种货币之间没有可用的汇率
+var ErrExchangeRateNotFound = errors.New("exchange rate not found")
+
+//相同币种的转账汇率为1
+const identityExchangeRate = "1"
+
+//返回适用的汇率和换算后的金额,舍入规则见util.ConvertAmount
+func convertTransferAmount(ctx context.Context, q *Queries, fromCurrency, toCurrency string, amount int64) (string, int64, error) {
+	if fromCurrency == toCurrency {
+		return identityExchangeRate, amount, nil
+	}
+
+	rate, err := q.GetExchangeRate(ctx, GetExchangeRateParams{
+		BaseCurrency:  fromCurrency,
+		QuoteCurrency: toCurrency,
+		At:            time.Now(),
+	})
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return "", 0, fmt.Errorf("%s->%s: %w", fromCurrency, toCurrency, ErrExchangeRateNotFound)
+		}
+		return "", 0, err
+	}
+
+	//金额是最小单位,需要两种货币的小数位数
+	from, err := q.GetCurrency(ctx, fromCurrency)
+	if err != nil {
+		return "", 0, err
+	}
+	to, err := q.GetCurrency(ctx, toCurrency)
+	if err != nil {
+		return "", 0, err
+	}
+
+	creditedAmount, err := util.ConvertAmount(amount, rate.Rate, from.Exponent, to.Exponent)
+	if err != nil {
+		return "", 0, err
+	}
+	return rate.Rate, creditedAmount, nil
+}
+
+//按照传入的顺序对两个账户加行锁,调用方需保证accountID1 < accountID2
+func lockAccounts(ctx context.Context, q *Queries, accountID1, accountID2 int64) (account1 Account, account2 Account, err error) {
+	account1, err = q.GetAccountForUpdate(ctx, accountID1)
+	if err != nil {
+		return
+	}
+
+	account2, err = q.GetAccountForUpdate(ctx, accountID2)
+	return
+}
+
+//同一个幂等键被用于不同的请求
+var ErrIdempotencyKeyReused = errors.New("idempotency key has already been used for a different request")
 
-		//1.用Queries调用创建转账记录的方法,并将结果写入result transfer字段
+//带幂等键的转账,客户端重试时使用相同的key不会重复转账
+type IdempotentTransferTxParams struct {
+	TransferTxParams
+	Username    string `json:"username"`
+	Key         string `json:"key"`
+	RequestHash string `json:"request_hash"` //请求内容的哈希,用于判断重试的是否为同一个请求
+}
+
+type IdempotentTransferTxResult struct {
+	TransferTxResult
+	Replayed bool `json:"replayed"` //为true表示这是之前已经完成的结果,本次没有再转账
+}
+
+//幂等键的写入,转账和结果的保存在同一个事务中,要么全部成功要么全部回滚
+func (store *SQLStore) IdempotentTransferTx(ctx context.Context, arg IdempotentTransferTxParams) (IdempotentTransferTxResult, error) {
+	var result IdempotentTransferTxResult
 
-		txName := ctx.Value(txKey)
-		fmt.Println(txName, "创建Transfer")
-		//引用外部函数变量result,构成闭包
-		result.Transfer, err = q.CreateTransfer(ctx, CreateTransferParams{
-			FromAccountID: arg.FromAccountID,
-			ToAccountID:   arg.ToAccountID,
-			Amount:        arg.Amount,
+	err := store.execTx(ctx, transferTxOptions, func(q *Queries) error {
+		//重试时需要清空上一次执行留下的结果
+		result = IdempotentTransferTxResult{}
+
+		//先占用幂等键,如果有并发的相同请求还未提交,INSERT会阻塞直到其提交或回滚
+		//对方提交后本事务会因序列化失败而重试,重试时就能读到对方保存的结果
+		_, err := q.CreateIdempotencyKey(ctx, CreateIdempotencyKeyParams{
+			Username:    arg.Username,
+			Key:         arg.Key,
+			RequestHash: arg.RequestHash,
 		})
+		if err == sql.ErrNoRows {
+			//ON CONFLICT DO NOTHING没有返回行,说明该键已被之前的请求使用
+			key, err := q.GetIdempotencyKey(ctx, GetIdempotencyKeyParams{
+				Username: arg.Username,
+				Key:      arg.Key,
+			})
+			if err != nil {
+				return err
+			}
+			if key.RequestHash != arg.RequestHash {
+				return ErrIdempotencyKeyReused
+			}
+			result.Replayed = true
+			return json.Unmarshal(key.Response, &result.TransferTxResult)
+		}
 		if err != nil {
 			return err
 		}
-		//2.转出转入的双方的Account表
-		fmt.Println(txName, "创建Entry1")
-		result.FromEntry, err = q.CreateEntry(ctx, CreateEntryParams{
-			AccountID: arg.FromAccountID,
-			Amount:    -arg.Amount, //对于转出账户来讲,是负数
 
+		result.TransferTxResult, err = store.transferTx(ctx, q, arg.TransferTxParams)
+		if err != nil {
+			return err
+		}
+
+		//保存结果,之后的重试直接返回该结果
+		response, err := json.Marshal(result.TransferTxResult)
+		if err != nil {
+			return err
+		}
+		return q.UpdateIdempotencyKeyResponse(ctx, UpdateIdempotencyKeyResponseParams{
+			Username: arg.Username,
+			Key:      arg.Key,
+			Response: response,
 		})
+	})
+
+	return result, err
+}
+
+//系统现金清算账户的持有者,每种货币一个账户,在第一次存取款时创建
+//存款时客户账户增加,清算账户减少相同的金额,取款相反,因此所有分录的总和始终为0
+const CashAccountOwner = "bank_cash"
+
+//存取款的参数,Amount为正数,以账户的货币计
+type CashTxParams struct {
+	AccountID int64 `json:"account_id"`
+	Amount    int64 `json:"amount"`
+}
+
+//存取款的结果,包括客户账户和对应的清算账户双方的分录
+type CashTxResult struct {
+	Account     Account `json:"account"`
+	Entry       Entry   `json:"entry"`
+	CashAccount Account `json:"cash_account"`
+	CashEntry   Entry   `json:"cash_entry"`
+}
+
+//存款:现金从外部进入系统
+func (store *SQLStore) DepositTx(ctx context.Context, arg CashTxParams) (CashTxResult, error) {
+	return store.cashTx(ctx, arg.AccountID, arg.Amount)
+}
+
+//取款:现金离开系统,和转账一样不允许透支
+func (store *SQLStore) WithdrawTx(ctx context.Context, arg CashTxParams) (CashTxResult, error) {
+	return store.cashTx(ctx, arg.AccountID, -arg.Amount)
+}
+
+//amount为客户账户的变动金额,存款为正,取款为负
+func (store *SQLStore) cashTx(ctx context.Context, accountID int64, amount int64) (CashTxResult, error) {
+	var result CashTxResult
+
+	err := store.execTx(ctx, transferTxOptions, func(q *Queries) error {
+		account, err := q.GetAccount(ctx, accountID)
+		if err != nil {
+			return err
+		}
+		if IsSystemAccountOwner(account.Owner) {
+			return fmt.Errorf("account [%v]: %w", account.ID, ErrSystemAccount)
+		}
+
+		//该货币的清算账户不存在时创建
+		cashAccount, err := systemAccount(ctx, q, CashAccountOwner, account.Currency)
+		if err != nil {
+			return err
+		}
+
+		//和转账一样按照id的顺序加锁
+		if account.ID < cashAccount.ID {
+			account, cashAccount, err = lockAccounts(ctx, q, account.ID, cashAccount.ID)
+		} else {
+			cashAccount, account, err = lockAccounts(ctx, q, cashAccount.ID, account.ID)
+		}
 		if err != nil {
 			return err
 		}
-		fmt.Println(txName, "创建Entry2")
-		result.ToEntry, err = q.CreateEntry(ctx, CreateEntryParams{
-			AccountID: arg.ToAccountID,
-			Amount:    arg.Amount, //收入账户为正
+		if account.IsFrozen {
+			return fmt.Errorf("account [%v]: %w", account.ID, ErrAccountFrozen)
+		}
+		//清算账户的余额可以为负,客户账户不能透支
+		if account.Balance+amount < 0 {
+			return fmt.Errorf("account [%v]: %w", account.ID, ErrInsufficientBalance)
+		}
+
+		kind := JournalKindDeposit
+		if amount < 0 {
+			kind = JournalKindWithdrawal
+		}
+		posted, err := q.PostJournal(ctx, PostJournalParams{
+			Kind: kind,
+			Postings: []Posting{
+				{AccountID: account.ID, Amount: amount},
+				{AccountID: cashAccount.ID, Amount: -amount},
+			},
 		})
 		if err != nil {
 			return err
 		}
-		//--------------------转账较为复杂,要考虑死锁问题----------------------
-		if arg.FromAccountID < arg.ToAccountID { //确保多个事务都按照相同的顺序执行修改
-			//先修改转出方
-			result.FromAccount, result.ToAccount, err = addMoney(ctx, q, arg.FromAccountID, -arg.Amount,
-				arg.ToAccountID, arg.Amount)
+		result.Entry = posted.Entries[0]
+		result.CashEntry = posted.Entries[1]
+		result.Account = posted.Accounts[account.ID]
+		result.CashAccount = posted.Accounts[cashAccount.ID]
+		return err
+	})
 
-		} else { //否则就先修改转入方
-			result.ToAccount, result.FromAccount, err = addMoney(ctx, q, arg.ToAccountID, arg.Amount,
-				arg.FromAccountID, -arg.Amount)
+	return result, err
+}
+
+//账单和流水查询使用只读的可重复读事务,保证余额和分录来自同一个快照
+var statementTxOptions = &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true}
 
+//附带该笔分录记账之后账户余额的流水
+type EntryWithBalance struct {
+	Entry
+	BalanceAfter int64 `json:"balance_after"`
+}
+
+//查询[From,To)时间段内的流水
+type ListEntriesWithBalanceParams struct {
+	AccountID int64     `json:"account_id"`
+	From      time.Time `json:"from"`
+	To        time.Time `json:"to"`
+	AfterID   int64     `json:"after_id"` //游标分页时为上一页最后一笔分录的ID,偏移分页时为0,按(created_at,id)排序
+	Limit     int32     `json:"limit"`
+	Offset    int32     `json:"offset"`
+}
+
+//分页列出流水,余额由账户的当前余额减去之后所有分录的金额倒推得到
+func (store *SQLStore) ListEntriesWithBalance(ctx context.Context, arg ListEntriesWithBalanceParams) ([]EntryWithBalance, error) {
+	var result []EntryWithBalance
+
+	err := store.execTx(ctx, statementTxOptions, func(q *Queries) error {
+		account, err := q.GetAccount(ctx, arg.AccountID)
+		if err != nil {
+			return err
+		}
+		entries, err := q.ListEntriesByTime(ctx, ListEntriesByTimeParams{
+			AccountID:   arg.AccountID,
+			FromTime:    arg.From,
+			ToTime:      arg.To,
+			AfterID:     arg.AfterID,
+			LimitCount:  arg.Limit,
+			OffsetCount: arg.Offset,
+		})
+		if err != nil {
+			return err
+		}
+
+		result = make([]EntryWithBalance, len(entries))
+		if len(entries) == 0 {
+			return nil
+		}
+		//本页最后一笔分录之后的余额,"之后"和列出流水一样按(created_at,id)的顺序
+		last := entries[len(entries)-1]
+		after, err := q.SumEntryAmountsAfter(ctx, SumEntryAmountsAfterParams{
+			AccountID: arg.AccountID,
+			CreatedAt: last.CreatedAt,
+			ID:        last.ID,
+		})
+		if err != nil {
+			return err
+		}
+		balance := account.Balance - after
+		for i := len(entries) - 1; i >= 0; i-- {
+			result[i] = EntryWithBalance{Entry: entries[i], BalanceAfter: balance}
+			balance -= entries[i].Amount
 		}
-		//暂时return nil
 		return nil
 	})
 
 	return result, err
 }
 
-//为精简代码而将其封装为函数
-func addMoney(
-	ctx context.Context,
-	q *Queries,
+type AccountStatementParams struct {
+	AccountID int64     `json:"account_id"`
+	From      time.Time `json:"from"`
+	To        time.Time `json:"to"`
+}
 
-	accountID1 int64,
-	amount1 int64, //应该添加到第一个账户的金额
-	accountID2 int64,
-	amount2 int64, //应该添加到第2个账户的金额
-	//返回修改后的两个账户和一个潜在的错误
-) (account1 Account, account2 Account, err error) {
+//账户在[From,To)期间的对账单
+type AccountStatement struct {
+	Account        Account            `json:"account"`
+	From           time.Time          `json:"from"`
+	To             time.Time          `json:"to"`
+	OpeningBalance int64              `json:"opening_balance"`
+	ClosingBalance int64              `json:"closing_balance"`
+	TotalIn        int64              `json:"total_in"`
+	TotalOut       int64              `json:"total_out"`
+	Entries        []EntryWithBalance `json:"entries"`
+}
 
-	account1, err = q.AddAccountBalance(ctx, AddAccountBalanceParams{
-		ID:     accountID1,
-		Amount: amount1,
-	})
-	if err != nil {
-		return
-	}
+//对账单最多包含的分录数,超过时需要缩短时间区间或者分页查询流水,避免一次把账户的全部历史读入内存
+const MaxStatementEntries = 10000
 
-	account2, err = q.AddAccountBalance(ctx, AddAccountBalanceParams{
-		ID:     accountID2,
-		Amount: amount2,
-	})
-	if err != nil {
-		return
-	}
+var ErrStatementTooLarge = fmt.Errorf("statement has more than %d entries, use a shorter period", MaxStatementEntries)
 
-	return
+//期初余额为当前余额减去From之后的所有分录,期末余额再加上期间的净额
+//分录超过MaxStatementEntries时返回ErrStatementTooLarge
+func (store *SQLStore) AccountStatementTx(ctx context.Context, arg AccountStatementParams) (AccountStatement, error) {
+	var result AccountStatement
+
+	err := store.execTx(ctx, statementTxOptions, func(q *Queries) error {
+		account, err := q.GetAccount(ctx, arg.AccountID)
+		if err != nil {
+			return err
+		}
+		since, err := q.SumEntryAmountsSince(ctx, SumEntryAmountsSinceParams{
+			AccountID: arg.AccountID,
+			CreatedAt: arg.From,
+		})
+		if err != nil {
+			return err
+		}
+		totals, err := q.SumEntryAmountsInRange(ctx, SumEntryAmountsInRangeParams{
+			AccountID: arg.AccountID,
+			FromTime:  arg.From,
+			ToTime:    arg.To,
+		})
+		if err != nil {
+			return err
+		}
+		entries, err := q.ListEntriesByTime(ctx, ListEntriesByTimeParams{
+			AccountID:   arg.AccountID,
+			FromTime:    arg.From,
+			ToTime:      arg.To,
+			LimitCount:  MaxStatementEntries + 1,
+			OffsetCount: 0,
+		})
+		if err != nil {
+			return err
+		}
+		if len(entries) > MaxStatementEntries {
+			return ErrStatementTooLarge
+		}
 
+		result = AccountStatement{
+			Account:        account,
+			From:           arg.From,
+			To:             arg.To,
+			OpeningBalance: account.Balance - since,
+			TotalIn:        totals.TotalIn,
+			TotalOut:       totals.TotalOut,
+			Entries:        make([]EntryWithBalance, 0, len(entries)),
+		}
+		balance := result.OpeningBalance
+		for _, entry := range entries {
+			balance += entry.Amount
+			result.Entries = append(result.Entries, EntryWithBalance{Entry: entry, BalanceAfter: balance})
+		}
+		result.ClosingBalance = result.OpeningBalance + totals.TotalIn - totals.TotalOut
+		return nil
+	})
+
+	return result, err
 }
@@ -2,17 +2,36 @@ package db
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"math/rand"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/leilei3167/bank/db/util"
+	"github.com/leilei3167/bank/logger"
+	"github.com/lib/pq"
 	"github.com/stretchr/testify/require"
 )
 
+//创建一个指定余额的账户,保证转账测试不会因为随机余额不足而失败
+func createAccountWithBalance(t *testing.T, balance int64) Account {
+	account := createRandomAccount(t)
+	account, err := testQueries.UpadateAccount(context.Background(), UpadateAccountParams{
+		ID:      account.ID,
+		Balance: balance,
+	})
+	require.NoError(t, err)
+	require.Equal(t, balance, account.Balance)
+	return account
+}
+
 func TestTransferTx(t *testing.T) {
 	store := NewStore(testDB)
 	//生成2个随机的账户来转账
-	account1 := createRandomAccount(t)
-	account2 := createRandomAccount(t)
+	account1 := createAccountWithBalance(t, 1000)
+	account2 := createAccountWithBalance(t, 1000)
 	fmt.Println(">>>转账之前:", account1.Balance, account2.Balance)
 	//必须谨慎处理事务,不小心处理并发的话将会是一个噩梦
 
@@ -24,10 +43,10 @@ func TestTransferTx(t *testing.T) {
 	results := make(chan TransferTxResult) //接收结果
 
 	for i := 0; i < n; i++ {
-		//用于标记协程
+		//用于标记协程,作为请求ID出现在store的日志中
 		txName := fmt.Sprintf("tx %d", i+1)
 		go func() {
-			ctx := context.WithValue(context.Background(), txKey, txName)
+			ctx := logger.WithRequestID(context.Background(), txName)
 			result, err := store.TransferTx(ctx, TransferTxParams{
 				FromAccountID: account1.ID,
 				ToAccountID:   account2.ID,
@@ -69,6 +88,7 @@ func TestTransferTx(t *testing.T) {
 		require.Equal(t, account1.ID, fromEntry.AccountID)
 		require.Equal(t, -amount, fromEntry.Amount)
 		require.NotZero(t, fromEntry.CreatedAt)
+		require.Equal(t, transfer.ID, fromEntry.TransferID.Int64)
 
 		_, err = store.GetEntry(context.Background(), fromEntry.ID)
 		require.NoError(t, err)
@@ -78,6 +98,7 @@ func TestTransferTx(t *testing.T) {
 		require.Equal(t, account2.ID, ToEntry.AccountID)
 		require.Equal(t, amount, ToEntry.Amount)
 		require.NotZero(t, ToEntry.CreatedAt)
+		require.Equal(t, transfer.ID, ToEntry.TransferID.Int64)
 
 		_, err = store.GetEntry(context.Background(), ToEntry.ID)
 		require.NoError(t, err)
@@ -123,8 +144,8 @@ func TestTransferTx(t *testing.T) {
 func TestTransferTxDeadlock(t *testing.T) {
 	store := NewStore(testDB)
 	//生成2个随机的账户来转账
-	account1 := createRandomAccount(t)
-	account2 := createRandomAccount(t)
+	account1 := createAccountWithBalance(t, 1000)
+	account2 := createAccountWithBalance(t, 1000)
 
 	n := 10
 	amount := int64(10)
@@ -142,7 +163,7 @@ func TestTransferTxDeadlock(t *testing.T) {
 
 		txName := fmt.Sprintf("tx %d", i+1)
 		go func() {
-			ctx := context.WithValue(context.Background(), txKey, txName)
+			ctx := logger.WithRequestID(context.Background(), txName)
 			_, err := store.TransferTx(ctx, TransferTxParams{
 				FromAccountID: fromAccountID,
 				ToAccountID:   toAccountID,
@@ -173,3 +194,436 @@ func TestTransferTxDeadlock(t *testing.T) {
 	require.Equal(t, account2.Balance, upadateAccount2.Balance)
 
 }
+
+func TestTransferTxInsufficientBalance(t *testing.T) {
+	store := NewStore(testDB)
+	account1 := createAccountWithBalance(t, 10)
+	account2 := createAccountWithBalance(t, 10)
+
+	_, err := store.TransferTx(context.Background(), TransferTxParams{
+		FromAccountID: account1.ID,
+		ToAccountID:   account2.ID,
+		Amount:        11,
+	})
+	require.ErrorIs(t, err, ErrInsufficientBalance)
+
+	//失败的转账不能留下任何记录
+	transfers, err := testQueries.ListTransfers(context.Background(), ListTransfersParams{
+		AccountID:  account1.ID,
+		LimitCount: 5,
+	})
+	require.NoError(t, err)
+	require.Empty(t, transfers)
+
+	updatedAccount1, err := testQueries.GetAccount(context.Background(), account1.ID)
+	require.NoError(t, err)
+	require.Equal(t, account1.Balance, updatedAccount1.Balance)
+}
+
+//处理器检查之后才冻结的账户由事务在加锁之后拒绝
+func TestTransferTxFrozenAccount(t *testing.T) {
+	store := NewStore(testDB)
+	account1 := createAccountWithBalance(t, 100)
+	account2 := createAccountWithBalance(t, 100)
+	_, err := testQueries.SetAccountFrozen(context.Background(), SetAccountFrozenParams{ID: account2.ID, IsFrozen: true})
+	require.NoError(t, err)
+
+	_, err = store.TransferTx(context.Background(), TransferTxParams{
+		FromAccountID: account1.ID,
+		ToAccountID:   account2.ID,
+		Amount:        10,
+	})
+	require.ErrorIs(t, err, ErrAccountFrozen)
+
+	_, err = store.WithdrawTx(context.Background(), CashTxParams{AccountID: account2.ID, Amount: 10})
+	require.ErrorIs(t, err, ErrAccountFrozen)
+
+	updatedAccount1, err := testQueries.GetAccount(context.Background(), account1.ID)
+	require.NoError(t, err)
+	require.Equal(t, account1.Balance, updatedAccount1.Balance)
+}
+
+//多个账户之间随机并发转账,余额不足的转账会失败,但总金额始终守恒,任何账户都不会透支
+func TestTransferTxConcurrentStress(t *testing.T) {
+	//可串行化隔离级别下大量并发转账会频繁冲突,放宽重试次数
+	var mu sync.Mutex
+	retries := 0
+	store := NewStore(testDB,
+		WithMaxTxAttempts(100),
+		WithTxRetryHook(func(ctx context.Context, attempt int, err error) {
+			mu.Lock()
+			retries++
+			mu.Unlock()
+		}),
+	)
+
+	nAccounts := 4
+	nTransfers := 100
+	initialBalance := int64(100)
+
+	accounts := make([]Account, nAccounts)
+	for i := range accounts {
+		accounts[i] = createAccountWithBalance(t, initialBalance)
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, nTransfers)
+	for i := 0; i < nTransfers; i++ {
+		from := rand.Intn(nAccounts)
+		to := (from + 1 + rand.Intn(nAccounts-1)) % nAccounts
+		amount := util.RandomInt(1, initialBalance)
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			result, err := store.TransferTx(context.Background(), TransferTxParams{
+				FromAccountID: accounts[from].ID,
+				ToAccountID:   accounts[to].ID,
+				Amount:        amount,
+			})
+			if err == nil && result.FromAccount.Balance < 0 {
+				err = fmt.Errorf("account %d overdrawn: %d", result.FromAccount.ID, result.FromAccount.Balance)
+			}
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			require.True(t, errors.Is(err, ErrInsufficientBalance), err)
+		}
+	}
+
+	var total int64
+	for _, account := range accounts {
+		updated, err := testQueries.GetAccount(context.Background(), account.ID)
+		require.NoError(t, err)
+		require.GreaterOrEqual(t, updated.Balance, int64(0))
+		total += updated.Balance
+	}
+	require.Equal(t, initialBalance*int64(nAccounts), total)
+	t.Logf("%d transfers retried %d times", nTransfers, retries)
+}
+
+func TestExecTxRetry(t *testing.T) {
+	var attempts []int
+	store := NewStore(testDB,
+		WithMaxTxAttempts(3),
+		WithTxRetryHook(func(ctx context.Context, attempt int, err error) {
+			attempts = append(attempts, attempt)
+		}),
+	)
+
+	//前两次执行模拟序列化失败,第三次成功
+	calls := 0
+	err := store.execTx(context.Background(), transferTxOptions, func(q *Queries) error {
+		calls++
+		if calls < 3 {
+			return &pq.Error{Code: "40001"}
+		}
+		return nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, 3, calls)
+	require.Equal(t, []int{1, 2}, attempts)
+
+	//超过最大次数后返回最后一次的错误
+	calls = 0
+	attempts = nil
+	err = store.execTx(context.Background(), nil, func(q *Queries) error {
+		calls++
+		return &pq.Error{Code: "40P01"}
+	})
+	require.True(t, isRetryableTxError(err))
+	require.Equal(t, 3, calls)
+	require.Equal(t, []int{1, 2}, attempts)
+
+	//其他错误不重试
+	calls = 0
+	attempts = nil
+	err = store.execTx(context.Background(), nil, func(q *Queries) error {
+		calls++
+		return ErrInsufficientBalance
+	})
+	require.ErrorIs(t, err, ErrInsufficientBalance)
+	require.Equal(t, 1, calls)
+	require.Empty(t, attempts)
+}
+
+func TestTxRetryBackoff(t *testing.T) {
+	for attempt := 1; attempt <= 100; attempt++ {
+		delay := txRetryBackoff(attempt)
+		require.GreaterOrEqual(t, delay, time.Duration(0))
+		require.Less(t, delay, txRetryMaxDelay)
+	}
+}
+
+func TestTransferTxCrossCurrency(t *testing.T) {
+	store := NewStore(testDB)
+	account1 := createAccountWithBalance(t, 1000)
+	account2 := createAccountWithBalance(t, 1000)
+
+	//使用随机的货币,避免和其他测试录入的汇率冲突
+	base, quote := createRandomCurrency(t, 2).Code, createRandomCurrency(t, 2).Code
+	_, err := testDB.Exec("UPDATE accounts SET currency = $2 WHERE id = $1", account1.ID, base)
+	require.NoError(t, err)
+	_, err = testDB.Exec("UPDATE accounts SET currency = $2 WHERE id = $1", account2.ID, quote)
+	require.NoError(t, err)
+
+	//没有汇率时不能转账
+	arg := TransferTxParams{
+		FromAccountID: account1.ID,
+		ToAccountID:   account2.ID,
+		Amount:        100,
+	}
+	_, err = store.TransferTx(context.Background(), arg)
+	require.ErrorIs(t, err, ErrExchangeRateNotFound)
+
+	//100 * 7.125 = 712.5,按银行家舍入得到712
+	createRandomExchangeRate(t, base, quote, "7.125", time.Now().Add(-time.Minute))
+	result, err := store.TransferTx(context.Background(), arg)
+	require.NoError(t, err)
+
+	require.Equal(t, int64(100), result.Transfer.Amount)
+	require.Equal(t, int64(712), result.Transfer.CreditedAmount)
+	rate, err := util.ParseExchangeRate(result.Transfer.ExchangeRate)
+	require.NoError(t, err)
+	require.Equal(t, "57/8", rate.String())
+
+	require.Equal(t, int64(-100), result.FromEntry.Amount)
+	require.Equal(t, int64(712), result.ToEntry.Amount)
+	require.Equal(t, account1.Balance-100, result.FromAccount.Balance)
+	require.Equal(t, account2.Balance+712, result.ToAccount.Balance)
+}
+
+func TestTransferTxCurrencyExponent(t *testing.T) {
+	store := NewStore(testDB)
+	account1 := createAccountWithBalance(t, 1000)
+	account2 := createAccountWithBalance(t, 1000)
+
+	//两位小数的货币转到没有小数的货币
+	base, quote := createRandomCurrency(t, 2).Code, createRandomCurrency(t, 0).Code
+	_, err := testDB.Exec("UPDATE accounts SET currency = $2 WHERE id = $1", account1.ID, base)
+	require.NoError(t, err)
+	_, err = testDB.Exec("UPDATE accounts SET currency = $2 WHERE id = $1", account2.ID, quote)
+	require.NoError(t, err)
+	createRandomExchangeRate(t, base, quote, "150", time.Now().Add(-time.Minute))
+
+	//1.00 -> 150
+	result, err := store.TransferTx(context.Background(), TransferTxParams{
+		FromAccountID: account1.ID,
+		ToAccountID:   account2.ID,
+		Amount:        100,
+	})
+	require.NoError(t, err)
+	require.Equal(t, int64(150), result.Transfer.CreditedAmount)
+	require.Equal(t, account2.Balance+150, result.ToAccount.Balance)
+}
+
+func TestDepositAndWithdrawTx(t *testing.T) {
+	store := NewStore(testDB)
+	account := createAccountWithBalance(t, 0)
+
+	deposit, err := store.DepositTx(context.Background(), CashTxParams{AccountID: account.ID, Amount: 300})
+	require.NoError(t, err)
+	require.Equal(t, int64(300), deposit.Account.Balance)
+	require.Equal(t, int64(300), deposit.Entry.Amount)
+	require.Equal(t, account.ID, deposit.Entry.AccountID)
+
+	//清算账户记录相反的分录,两条分录之和为0
+	require.Equal(t, CashAccountOwner, deposit.CashAccount.Owner)
+	require.Equal(t, account.Currency, deposit.CashAccount.Currency)
+	require.Equal(t, deposit.CashAccount.ID, deposit.CashEntry.AccountID)
+	require.Equal(t, int64(0), deposit.Entry.Amount+deposit.CashEntry.Amount)
+
+	withdrawal, err := store.WithdrawTx(context.Background(), CashTxParams{AccountID: account.ID, Amount: 100})
+	require.NoError(t, err)
+	require.Equal(t, int64(200), withdrawal.Account.Balance)
+	require.Equal(t, int64(-100), withdrawal.Entry.Amount)
+	require.Equal(t, int64(100), withdrawal.CashEntry.Amount)
+	//同一种货币使用同一个清算账户
+	require.Equal(t, deposit.CashAccount.ID, withdrawal.CashAccount.ID)
+
+	//不能透支
+	_, err = store.WithdrawTx(context.Background(), CashTxParams{AccountID: account.ID, Amount: 201})
+	require.ErrorIs(t, err, ErrInsufficientBalance)
+
+	updated, err := testQueries.GetAccount(context.Background(), account.ID)
+	require.NoError(t, err)
+	require.Equal(t, int64(200), updated.Balance)
+
+	//不能对清算账户以及其他系统账户存取款
+	_, err = store.DepositTx(context.Background(), CashTxParams{AccountID: deposit.CashAccount.ID, Amount: 1})
+	require.ErrorIs(t, err, ErrSystemAccount)
+	for _, owner := range []string{FXAccountOwner, FeeAccountOwner} {
+		systemAccount, err := systemAccount(context.Background(), testQueries, owner, account.Currency)
+		require.NoError(t, err)
+		_, err = store.WithdrawTx(context.Background(), CashTxParams{AccountID: systemAccount.ID, Amount: 1})
+		require.ErrorIs(t, err, ErrSystemAccount)
+
+		//也不能向系统账户转账
+		_, err = store.TransferTx(context.Background(), TransferTxParams{
+			FromAccountID: account.ID,
+			ToAccountID:   systemAccount.ID,
+			Amount:        1,
+		})
+		require.ErrorIs(t, err, ErrSystemAccount)
+	}
+}
+
+func TestConcurrentDepositTx(t *testing.T) {
+	store := NewStore(testDB, WithMaxTxAttempts(50))
+	account := createAccountWithBalance(t, 0)
+
+	//并发存款会争用同一个清算账户,由execTx重试
+	n := 10
+	errs := make(chan error)
+	for i := 0; i < n; i++ {
+		go func() {
+			_, err := store.DepositTx(context.Background(), CashTxParams{AccountID: account.ID, Amount: 10})
+			errs <- err
+		}()
+	}
+	for i := 0; i < n; i++ {
+		require.NoError(t, <-errs)
+	}
+
+	updated, err := testQueries.GetAccount(context.Background(), account.ID)
+	require.NoError(t, err)
+	require.Equal(t, int64(n*10), updated.Balance)
+}
+
+func TestListEntriesWithBalance(t *testing.T) {
+	store := NewStore(testDB)
+	account := createAccountWithBalance(t, 0)
+
+	//通过存取款产生分录,余额为100,70,120
+	amounts := []int64{100, -30, 50}
+	for _, amount := range amounts {
+		var err error
+		if amount > 0 {
+			_, err = store.DepositTx(context.Background(), CashTxParams{AccountID: account.ID, Amount: amount})
+		} else {
+			_, err = store.WithdrawTx(context.Background(), CashTxParams{AccountID: account.ID, Amount: -amount})
+		}
+		require.NoError(t, err)
+	}
+
+	arg := ListEntriesWithBalanceParams{
+		AccountID: account.ID,
+		From:      time.Now().Add(-time.Hour),
+		To:        time.Now().Add(time.Hour),
+		Limit:     5,
+		Offset:    0,
+	}
+	entries, err := store.ListEntriesWithBalance(context.Background(), arg)
+	require.NoError(t, err)
+	require.Len(t, entries, 3)
+	require.Equal(t, int64(100), entries[0].BalanceAfter)
+	require.Equal(t, int64(70), entries[1].BalanceAfter)
+	require.Equal(t, int64(120), entries[2].BalanceAfter)
+
+	//分页之后余额依然正确
+	arg.Limit = 1
+	arg.Offset = 1
+	entries, err = store.ListEntriesWithBalance(context.Background(), arg)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	require.Equal(t, int64(-30), entries[0].Amount)
+	require.Equal(t, int64(70), entries[0].BalanceAfter)
+}
+
+func TestAccountStatementTx(t *testing.T) {
+	store := NewStore(testDB)
+	account := createAccountWithBalance(t, 0)
+
+	_, err := store.DepositTx(context.Background(), CashTxParams{AccountID: account.ID, Amount: 100})
+	require.NoError(t, err)
+	from := time.Now()
+	_, err = store.WithdrawTx(context.Background(), CashTxParams{AccountID: account.ID, Amount: 30})
+	require.NoError(t, err)
+	_, err = store.DepositTx(context.Background(), CashTxParams{AccountID: account.ID, Amount: 50})
+	require.NoError(t, err)
+	to := time.Now()
+	_, err = store.DepositTx(context.Background(), CashTxParams{AccountID: account.ID, Amount: 7})
+	require.NoError(t, err)
+
+	statement, err := store.AccountStatementTx(context.Background(), AccountStatementParams{
+		AccountID: account.ID,
+		From:      from,
+		To:        to,
+	})
+	require.NoError(t, err)
+	require.Equal(t, account.ID, statement.Account.ID)
+	require.Equal(t, int64(100), statement.OpeningBalance)
+	require.Equal(t, int64(50), statement.TotalIn)
+	require.Equal(t, int64(30), statement.TotalOut)
+	require.Equal(t, int64(120), statement.ClosingBalance)
+	require.Len(t, statement.Entries, 2)
+	require.Equal(t, int64(70), statement.Entries[0].BalanceAfter)
+	require.Equal(t, statement.ClosingBalance, statement.Entries[1].BalanceAfter)
+}
+
+func TestIdempotentTransferTx(t *testing.T) {
+	store := NewStore(testDB)
+	account1 := createAccountWithBalance(t, 1000)
+	account2 := createAccountWithBalance(t, 1000)
+
+	//同一个key的5个并发请求,只能有一个真正转账
+	n := 5
+	amount := int64(1)
+	arg := IdempotentTransferTxParams{
+		TransferTxParams: TransferTxParams{
+			FromAccountID: account1.ID,
+			ToAccountID:   account2.ID,
+			Amount:        amount,
+		},
+		Username:    account1.Owner,
+		Key:         util.RandomString(16),
+		RequestHash: util.RandomString(64),
+	}
+
+	errs := make(chan error)
+	results := make(chan IdempotentTransferTxResult)
+	for i := 0; i < n; i++ {
+		go func() {
+			result, err := store.IdempotentTransferTx(context.Background(), arg)
+			errs <- err
+			results <- result
+		}()
+	}
+
+	replayed := 0
+	var transferID int64
+	for i := 0; i < n; i++ {
+		err := <-errs
+		require.NoError(t, err)
+
+		result := <-results
+		require.NotZero(t, result.Transfer.ID)
+		if transferID == 0 {
+			transferID = result.Transfer.ID
+		}
+		//所有请求得到的都是同一笔转账
+		require.Equal(t, transferID, result.Transfer.ID)
+		if result.Replayed {
+			replayed++
+		}
+	}
+	require.Equal(t, n-1, replayed)
+
+	updatedAccount1, err := testQueries.GetAccount(context.Background(), account1.ID)
+	require.NoError(t, err)
+	require.Equal(t, account1.Balance-amount, updatedAccount1.Balance)
+
+	updatedAccount2, err := testQueries.GetAccount(context.Background(), account2.ID)
+	require.NoError(t, err)
+	require.Equal(t, account2.Balance+amount, updatedAccount2.Balance)
+
+	//相同的key用于不同的请求
+	arg.RequestHash = util.RandomString(64)
+	_, err = store.IdempotentTransferTx(context.Background(), arg)
+	require.ErrorIs(t, err, ErrIdempotencyKeyReused)
+}
@@ -5,24 +5,41 @@ package db
 
 import (
 	"context"
+	"database/sql"
 )
 
 const createTransfer = `-- name: CreateTransfer :one
 insert into transfers(
     from_account_id,
     to_account_id,
-    amount
-)values($1,$2,$3)returning id, from_account_id, to_account_id, amount, created_at
+    amount,
+    credited_amount,
+    exchange_rate,
+    fee,
+    reversal_of
+)values($1,$2,$3,$4,$5,$6,$7)returning id, from_account_id, to_account_id, amount, created_at, credited_amount, exchange_rate, fee, reversal_of
 `
 
 type CreateTransferParams struct {
-	FromAccountID int64 `json:"from_account_id"`
-	ToAccountID   int64 `json:"to_account_id"`
-	Amount        int64 `json:"amount"`
+	FromAccountID  int64         `json:"from_account_id"`
+	ToAccountID    int64         `json:"to_account_id"`
+	Amount         int64         `json:"amount"`
+	CreditedAmount int64         `json:"credited_amount"`
+	ExchangeRate   string        `json:"exchange_rate"`
+	Fee            int64         `json:"fee"`
+	ReversalOf     sql.NullInt64 `json:"reversal_of"`
 }
 
 func (q *Queries) CreateTransfer(ctx context.Context, arg CreateTransferParams) (Transfer, error) {
-	row := q.db.QueryRowContext(ctx, createTransfer, arg.FromAccountID, arg.ToAccountID, arg.Amount)
+	row := q.db.QueryRowContext(ctx, createTransfer,
+		arg.FromAccountID,
+		arg.ToAccountID,
+		arg.Amount,
+		arg.CreditedAmount,
+		arg.ExchangeRate,
+		arg.Fee,
+		arg.ReversalOf,
+	)
 	var i Transfer
 	err := row.Scan(
 		&i.ID,
@@ -30,12 +47,16 @@ func (q *Queries) CreateTransfer(ctx context.Context, arg CreateTransferParams)
 		&i.ToAccountID,
 		&i.Amount,
 		&i.CreatedAt,
+		&i.CreditedAmount,
+		&i.ExchangeRate,
+		&i.Fee,
+		&i.ReversalOf,
 	)
 	return i, err
 }
 
 const getTransfer = `-- name: GetTransfer :one
-SELECT id, from_account_id, to_account_id, amount, created_at FROM transfers
+SELECT id, from_account_id, to_account_id, amount, created_at, credited_amount, exchange_rate, fee, reversal_of FROM transfers
 WHERE "id" = $1 LIMIT 1
 `
 
@@ -48,33 +69,82 @@ func (q *Queries) GetTransfer(ctx context.Context, id int64) (Transfer, error) {
 		&i.ToAccountID,
 		&i.Amount,
 		&i.CreatedAt,
+		&i.CreditedAmount,
+		&i.ExchangeRate,
+		&i.Fee,
+		&i.ReversalOf,
+	)
+	return i, err
+}
+
+const getTransferForUpdate = `-- name: GetTransferForUpdate :one
+SELECT id, from_account_id, to_account_id, amount, created_at, credited_amount, exchange_rate, fee, reversal_of FROM transfers
+WHERE "id" = $1 LIMIT 1
+FOR NO KEY UPDATE
+`
+
+func (q *Queries) GetTransferForUpdate(ctx context.Context, id int64) (Transfer, error) {
+	row := q.db.QueryRowContext(ctx, getTransferForUpdate, id)
+	var i Transfer
+	err := row.Scan(
+		&i.ID,
+		&i.FromAccountID,
+		&i.ToAccountID,
+		&i.Amount,
+		&i.CreatedAt,
+		&i.CreditedAmount,
+		&i.ExchangeRate,
+		&i.Fee,
+		&i.ReversalOf,
 	)
 	return i, err
 }
 
 const listTransfers = `-- name: ListTransfers :many
-SELECT id, from_account_id, to_account_id, amount, created_at FROM transfers
-WHERE 
-    from_account_id = $1 OR
-    to_account_id = $2
+SELECT id, from_account_id, to_account_id, amount, created_at, credited_amount, exchange_rate, fee, reversal_of FROM transfers
+WHERE (from_account_id = $1 OR to_account_id = $1)
+  AND ($2::varchar IS NULL
+    OR ($2 = 'outgoing' AND from_account_id = $1)
+    OR ($2 = 'incoming' AND to_account_id = $1))
+  AND ($3::bigint IS NULL
+    OR (CASE WHEN from_account_id = $1 THEN to_account_id ELSE from_account_id END) = $3)
+  AND ($4::bigint IS NULL
+    OR (CASE WHEN from_account_id = $1 THEN amount ELSE credited_amount END) >= $4)
+  AND ($5::bigint IS NULL
+    OR (CASE WHEN from_account_id = $1 THEN amount ELSE credited_amount END) <= $5)
+  AND ($6::timestamptz IS NULL OR created_at >= $6)
+  AND ($7::timestamptz IS NULL OR created_at < $7)
+  AND id > $8
 ORDER BY id
-LIMIT $3
-OFFSET $4
+LIMIT $9
+OFFSET $10
 `
 
 type ListTransfersParams struct {
-	FromAccountID int64 `json:"from_account_id"`
-	ToAccountID   int64 `json:"to_account_id"`
-	Limit         int32 `json:"limit"`
-	Offset        int32 `json:"offset"`
+	AccountID      int64          `json:"account_id"`
+	Direction      sql.NullString `json:"direction"`
+	CounterpartyID sql.NullInt64  `json:"counterparty_id"`
+	MinAmount      sql.NullInt64  `json:"min_amount"`
+	MaxAmount      sql.NullInt64  `json:"max_amount"`
+	FromTime       sql.NullTime   `json:"from_time"`
+	ToTime         sql.NullTime   `json:"to_time"`
+	AfterID        int64          `json:"after_id"`
+	LimitCount     int32          `json:"limit_count"`
+	OffsetCount    int32          `json:"offset_count"`
 }
 
 func (q *Queries) ListTransfers(ctx context.Context, arg ListTransfersParams) ([]Transfer, error) {
 	rows, err := q.db.QueryContext(ctx, listTransfers,
-		arg.FromAccountID,
-		arg.ToAccountID,
-		arg.Limit,
-		arg.Offset,
+		arg.AccountID,
+		arg.Direction,
+		arg.CounterpartyID,
+		arg.MinAmount,
+		arg.MaxAmount,
+		arg.FromTime,
+		arg.ToTime,
+		arg.AfterID,
+		arg.LimitCount,
+		arg.OffsetCount,
 	)
 	if err != nil {
 		return nil, err
@@ -89,6 +159,10 @@ func (q *Queries) ListTransfers(ctx context.Context, arg ListTransfersParams) ([
 			&i.ToAccountID,
 			&i.Amount,
 			&i.CreatedAt,
+			&i.CreditedAmount,
+			&i.ExchangeRate,
+			&i.Fee,
+			&i.ReversalOf,
 		); err != nil {
 			return nil, err
 		}
@@ -102,3 +176,23 @@ func (q *Queries) ListTransfers(ctx context.Context, arg ListTransfersParams) ([
 	}
 	return items, nil
 }
+
+const sumTransferReversals = `-- name: SumTransferReversals :one
+SELECT
+    COALESCE(SUM(amount), 0)::bigint AS debited_amount,
+    COALESCE(SUM(credited_amount), 0)::bigint AS refunded_amount
+FROM transfers
+WHERE reversal_of = $1
+`
+
+type SumTransferReversalsRow struct {
+	DebitedAmount  int64 `json:"debited_amount"`
+	RefundedAmount int64 `json:"refunded_amount"`
+}
+
+func (q *Queries) SumTransferReversals(ctx context.Context, reversalOf sql.NullInt64) (SumTransferReversalsRow, error) {
+	row := q.db.QueryRowContext(ctx, sumTransferReversals, reversalOf)
+	var i SumTransferReversalsRow
+	err := row.Scan(&i.DebitedAmount, &i.RefundedAmount)
+	return i, err
+}
@@ -2,18 +2,23 @@ package db
 
 import (
 	"context"
+	"database/sql"
 	"github.com/leilei3167/bank/db/util"
 	"github.com/stretchr/testify/require"
 	"testing"
+	"time"
 )
 
 //transfer有2个外键,所以必须创建2个account
 
 func createRandomTransfer(t *testing.T, account1 Account, account2 Account) Transfer {
+	amount := util.RandomMoney() //不大于转出者的余额
 	arg := CreateTransferParams{
-		FromAccountID: account1.ID,
-		ToAccountID:   account2.ID,
-		Amount:        util.RandomMoney(), //不大于转出者的余额
+		FromAccountID:  account1.ID,
+		ToAccountID:    account2.ID,
+		Amount:         amount,
+		CreditedAmount: amount,
+		ExchangeRate:   "1",
 	}
 	transfer, err := testQueries.CreateTransfer(context.Background(), arg)
 	require.NoError(t, err)
@@ -22,6 +27,7 @@ func createRandomTransfer(t *testing.T, account1 Account, account2 Account) Tran
 	require.Equal(t, transfer.FromAccountID, account1.ID)
 	require.Equal(t, transfer.ToAccountID, account2.ID)
 	require.Equal(t, transfer.Amount, arg.Amount)
+	require.Equal(t, transfer.CreditedAmount, arg.CreditedAmount)
 
 	require.NotZero(t, transfer.ID)
 	require.NotZero(t, transfer.CreatedAt)
@@ -42,10 +48,9 @@ func TestQueries_ListTransfers(t *testing.T) {
 		createRandomTransfer(t, account1, account2)
 	}
 	arg := ListTransfersParams{
-		FromAccountID: account1.ID,
-		ToAccountID:   account2.ID,
-		Limit:         5,
-		Offset:        5,
+		AccountID:   account1.ID,
+		LimitCount:  5,
+		OffsetCount: 5,
 	}
 	transfers, err := testQueries.ListTransfers(context.Background(), arg)
 	require.NoError(t, err)
@@ -58,3 +63,70 @@ func TestQueries_ListTransfers(t *testing.T) {
 	}
 
 }
+
+func TestQueries_ListTransfersFilter(t *testing.T) {
+	account1 := createRandomAccount(t)
+	account2 := createRandomAccount(t)
+	account3 := createRandomAccount(t)
+
+	outgoing := createRandomTransfer(t, account1, account2)
+	incoming := createRandomTransfer(t, account3, account1)
+
+	//转入和转出都会列出
+	transfers, err := testQueries.ListTransfers(context.Background(), ListTransfersParams{
+		AccountID:  account1.ID,
+		LimitCount: 10,
+	})
+	require.NoError(t, err)
+	require.Len(t, transfers, 2)
+	require.Equal(t, outgoing.ID, transfers[0].ID)
+	require.Equal(t, incoming.ID, transfers[1].ID)
+
+	transfers, err = testQueries.ListTransfers(context.Background(), ListTransfersParams{
+		AccountID:  account1.ID,
+		Direction:  sql.NullString{String: "incoming", Valid: true},
+		LimitCount: 10,
+	})
+	require.NoError(t, err)
+	require.Len(t, transfers, 1)
+	require.Equal(t, incoming.ID, transfers[0].ID)
+
+	transfers, err = testQueries.ListTransfers(context.Background(), ListTransfersParams{
+		AccountID:      account1.ID,
+		CounterpartyID: sql.NullInt64{Int64: account2.ID, Valid: true},
+		LimitCount:     10,
+	})
+	require.NoError(t, err)
+	require.Len(t, transfers, 1)
+	require.Equal(t, outgoing.ID, transfers[0].ID)
+
+	//对方是另一端的账户,查询的账户本身不是对方
+	transfers, err = testQueries.ListTransfers(context.Background(), ListTransfersParams{
+		AccountID:      account1.ID,
+		CounterpartyID: sql.NullInt64{Int64: account1.ID, Valid: true},
+		LimitCount:     10,
+	})
+	require.NoError(t, err)
+	require.Empty(t, transfers)
+
+	//金额超出范围时没有结果,转入的转账按转入金额比较
+	maxAmount := outgoing.Amount
+	if incoming.CreditedAmount > maxAmount {
+		maxAmount = incoming.CreditedAmount
+	}
+	transfers, err = testQueries.ListTransfers(context.Background(), ListTransfersParams{
+		AccountID:  account1.ID,
+		MinAmount:  sql.NullInt64{Int64: maxAmount + 1, Valid: true},
+		LimitCount: 10,
+	})
+	require.NoError(t, err)
+	require.Empty(t, transfers)
+
+	transfers, err = testQueries.ListTransfers(context.Background(), ListTransfersParams{
+		AccountID:  account1.ID,
+		FromTime:   sql.NullTime{Time: time.Now().Add(time.Hour), Valid: true},
+		LimitCount: 10,
+	})
+	require.NoError(t, err)
+	require.Empty(t, transfers)
+}
@@ -1,11 +1,36 @@
 package util
 
-import "github.com/spf13/viper"
+import (
+	"time"
+
+	"github.com/spf13/viper"
+)
 
 type Config struct {
-	DBDriver     string `mapstructure:"DB_DRIVER"`
-	DBSource     string `mapstructure:"DB_SOURCE"`
-	ServerAdress string `mapstructure:"SERVER_ADDRESS"`
+	DBDriver             string        `mapstructure:"DB_DRIVER"`
+	DBSource             string        `mapstructure:"DB_SOURCE"`
+	ServerAdress         string        `mapstructure:"SERVER_ADDRESS"`
+	GRPCServerAddress    string        `mapstructure:"GRPC_SERVER_ADDRESS"`    //gRPC服务监听的地址,为空时不启动
+	MetricsAddress       string        `mapstructure:"METRICS_ADDRESS"`        //Prometheus抓取指标的内部地址,不要对客户开放,为空时不启动
+	TokenSymmetricKey    string        `mapstructure:"TOKEN_SYMMETRIC_KEY"`    //签发token的对称密钥,必须为32位
+	AccessTokenDuration  time.Duration `mapstructure:"ACCESS_TOKEN_DURATION"`  //access token的有效期,如15m
+	RefreshTokenDuration time.Duration `mapstructure:"REFRESH_TOKEN_DURATION"` //refresh token的有效期,即会话的有效期
+	DefaultPageLimit     int32         `mapstructure:"DEFAULT_PAGE_LIMIT"`     //游标分页未指定limit时每页的条数
+	MaxPageLimit         int32         `mapstructure:"MAX_PAGE_LIMIT"`         //游标分页每页最多的条数
+	ReconcileInterval    time.Duration `mapstructure:"RECONCILE_INTERVAL"`     //后台定期对账的间隔,为0时不启动
+	ReconcileBatchSize   int32         `mapstructure:"RECONCILE_BATCH_SIZE"`   //对账时每批扫描的行数
+	SchedulerInterval    time.Duration `mapstructure:"SCHEDULER_INTERVAL"`     //检查到期定时转账的间隔,为0时不启动
+	CurrencySyncInterval time.Duration `mapstructure:"CURRENCY_SYNC_INTERVAL"` //从数据库刷新货币注册表的间隔,未设置时为30s
+	HTTPReadTimeout      time.Duration `mapstructure:"HTTP_READ_TIMEOUT"`      //读取整个请求(包括请求体)的超时
+	HTTPWriteTimeout     time.Duration `mapstructure:"HTTP_WRITE_TIMEOUT"`     //从读完请求头到写完响应的超时
+	HTTPIdleTimeout      time.Duration `mapstructure:"HTTP_IDLE_TIMEOUT"`      //keep-alive连接空闲的超时
+	ShutdownTimeout      time.Duration `mapstructure:"SHUTDOWN_TIMEOUT"`       //优雅关闭时等待正在处理的请求完成的最长时间
+	ShutdownGracePeriod  time.Duration `mapstructure:"SHUTDOWN_GRACE_PERIOD"`  //就绪检查失败之后继续接受请求的时间,让负载均衡先摘除实例,为0时不等待
+	LogFormat            string        `mapstructure:"LOG_FORMAT"`             //日志格式,json或console
+	LogLevel             string        `mapstructure:"LOG_LEVEL"`              //日志级别,如debug,info,warn
+	HealthCheckTimeout   time.Duration `mapstructure:"HEALTH_CHECK_TIMEOUT"`   //就绪检查访问数据库的超时
+	TraceExporter        string        `mapstructure:"TRACE_EXPORTER"`         //链路追踪的exporter,otlp,stdout或none
+	OTLPEndpoint         string        `mapstructure:"OTLP_ENDPOINT"`          //OTLP collector的gRPC地址,如localhost:4317
 }
 
 func LoadConfig(path string) (config Config, err error) {
@@ -22,3 +47,11 @@ func LoadConfig(path string) (config Config, err error) {
 	err = viper.Unmarshal(&config) //将获取的配置信息写入结构体
 	return
 }
+
+//配置中没有设置的时长为0,此时使用默认值
+func DurationOrDefault(d, def time.Duration) time.Duration {
+	if d <= 0 {
+		return def
+	}
+	return d
+}
@@ -1,16 +1,125 @@
 package util
 
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
 const (
 	USD = "USD"
 	EUR = "EUR"
 	RMB = "RMB"
 )
 
-//判断是否支持该货币
+//货币信息,金额在数据库中都以最小单位(如美分)的整数保存
+type Currency struct {
+	Code     string `json:"code"`
+	Exponent int32  `json:"exponent"` //最小单位的小数位数,2表示1美元=100美分
+	Symbol   string `json:"symbol"`
+	Enabled  bool   `json:"enabled"`
+}
+
+//与数据库迁移中预置的货币一致,在从数据库加载之前使用
+var DefaultCurrencies = []Currency{
+	{Code: EUR, Exponent: 2, Symbol: "€", Enabled: true},
+	{Code: RMB, Exponent: 2, Symbol: "¥", Enabled: true},
+	{Code: USD, Exponent: 2, Symbol: "$", Enabled: true},
+}
+
+//并发安全的货币注册表,内容来自currencies表
+type CurrencyRegistry struct {
+	mu         sync.RWMutex
+	currencies map[string]Currency
+}
+
+func NewCurrencyRegistry(currencies []Currency) *CurrencyRegistry {
+	registry := &CurrencyRegistry{}
+	registry.Replace(currencies)
+	return registry
+}
+
+//用新的货币列表替换注册表的全部内容
+func (r *CurrencyRegistry) Replace(currencies []Currency) {
+	m := make(map[string]Currency, len(currencies))
+	for _, currency := range currencies {
+		m[currency.Code] = currency
+	}
+
+	r.mu.Lock()
+	r.currencies = m
+	r.mu.Unlock()
+}
+
+//添加或更新一种货币
+func (r *CurrencyRegistry) Put(currency Currency) {
+	r.mu.Lock()
+	r.currencies[currency.Code] = currency
+	r.mu.Unlock()
+}
+
+func (r *CurrencyRegistry) Get(code string) (Currency, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	currency, ok := r.currencies[code]
+	return currency, ok
+}
+
+//按代码排序返回所有货币
+func (r *CurrencyRegistry) List() []Currency {
+	r.mu.RLock()
+	currencies := make([]Currency, 0, len(r.currencies))
+	for _, currency := range r.currencies {
+		currencies = append(currencies, currency)
+	}
+	r.mu.RUnlock()
+
+	sort.Slice(currencies, func(i, j int) bool {
+		return currencies[i].Code < currencies[j].Code
+	})
+	return currencies
+}
+
+//货币存在并且已启用
+func (r *CurrencyRegistry) IsEnabled(code string) bool {
+	currency, ok := r.Get(code)
+	return ok && currency.Enabled
+}
+
+//将最小单位的金额格式化为十进制字符串,未知的货币按原样输出
+func (r *CurrencyRegistry) FormatAmount(amount int64, code string) string {
+	currency, ok := r.Get(code)
+	if !ok {
+		return strconv.FormatInt(amount, 10)
+	}
+	return FormatMinorUnits(amount, currency.Exponent)
+}
+
+//全局的货币注册表,服务启动时从数据库同步
+var Currencies = NewCurrencyRegistry(DefaultCurrencies)
+
+//判断是否支持该货币,只有已启用的货币才能开户和转账
 func IsSupportedCurrency(currency string) bool {
-	switch currency {
-	case USD, EUR, RMB:
-		return true
+	return Currencies.IsEnabled(currency)
+}
+
+//按照小数位数把最小单位的整数转换为十进制字符串,如(12345, 2) -> "123.45"
+func FormatMinorUnits(amount int64, exponent int32) string {
+	if exponent <= 0 {
+		return strconv.FormatInt(amount, 10)
+	}
+
+	sign := ""
+	digits := strconv.FormatInt(amount, 10)
+	if amount < 0 {
+		sign = "-"
+		digits = digits[1:]
+	}
+	//位数不够时在前面补0,保证整数部分至少有一位
+	if len(digits) <= int(exponent) {
+		digits = strings.Repeat("0", int(exponent)-len(digits)+1) + digits
 	}
-	return false
+	point := len(digits) - int(exponent)
+	return sign + digits[:point] + "." + digits[point:]
 }
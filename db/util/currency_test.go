@@ -0,0 +1,48 @@
+package util
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFormatMinorUnits(t *testing.T) {
+	testCases := []struct {
+		amount   int64
+		exponent int32
+		want     string
+	}{
+		{12345, 2, "123.45"},
+		{5, 2, "0.05"},
+		{-5, 2, "-0.05"},
+		{-12345, 2, "-123.45"},
+		{0, 2, "0.00"},
+		{100, 0, "100"},
+		{1, 3, "0.001"},
+		{math.MinInt64, 2, "-92233720368547758.08"},
+	}
+
+	for _, tc := range testCases {
+		require.Equal(t, tc.want, FormatMinorUnits(tc.amount, tc.exponent))
+	}
+}
+
+func TestCurrencyRegistry(t *testing.T) {
+	registry := NewCurrencyRegistry(DefaultCurrencies)
+	require.True(t, registry.IsEnabled(USD))
+	require.False(t, registry.IsEnabled("JPY"))
+
+	//禁用之后不再支持
+	registry.Put(Currency{Code: USD, Exponent: 2, Symbol: "$", Enabled: false})
+	require.False(t, registry.IsEnabled(USD))
+	_, ok := registry.Get(USD)
+	require.True(t, ok)
+
+	registry.Replace([]Currency{{Code: "JPY", Exponent: 0, Symbol: "¥", Enabled: true}})
+	require.True(t, registry.IsEnabled("JPY"))
+	require.False(t, registry.IsEnabled(EUR))
+	require.Equal(t, "1500", registry.FormatAmount(1500, "JPY"))
+	require.Equal(t, "1500", registry.FormatAmount(1500, "XXX"))
+	require.Len(t, registry.List(), 1)
+}
@@ -0,0 +1,114 @@
+package util
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+//汇率在数据库中保存为numeric(20,10),最多10位整数和10位小数
+const (
+	MaxExchangeRateScale     = 10
+	MaxExchangeRateIntDigits = 10
+)
+
+var (
+	ErrInvalidExchangeRate = errors.New("exchange rate must be a positive decimal with at most 10 integer and 10 fractional digits")
+	ErrConvertedAmountZero = errors.New("converted amount rounds to zero")
+)
+
+//解析十进制字符串形式的汇率,如"7.1234",不接受分数形式和科学计数法
+func ParseExchangeRate(rate string) (*big.Rat, error) {
+	for _, c := range rate {
+		if (c < '0' || c > '9') && c != '.' {
+			return nil, ErrInvalidExchangeRate
+		}
+	}
+	r, ok := new(big.Rat).SetString(rate)
+	if !ok || r.Sign() <= 0 {
+		return nil, ErrInvalidExchangeRate
+	}
+	//乘以10^10之后必须是整数,否则数据库会悄悄截断多余的小数
+	scaled := new(big.Rat).Mul(r, pow10Rat(MaxExchangeRateScale))
+	if !scaled.IsInt() {
+		return nil, ErrInvalidExchangeRate
+	}
+	//整数部分超过10位时插入会溢出,要在这里拒绝而不是让数据库报错
+	if r.Cmp(pow10Rat(MaxExchangeRateIntDigits)) >= 0 {
+		return nil, ErrInvalidExchangeRate
+	}
+	return r, nil
+}
+
+//按照汇率把amount换算为目标货币的金额,金额都是最小单位,汇率是主单位之间的比率,
+//因此还要按照两种货币的小数位数调整,如1.00USD(100美分)按7.1换算为710分人民币
+//舍入规则:结果四舍六入五成双(银行家舍入),即恰好在两个整数中间时取偶数,
+//这样大量换算的舍入误差不会系统性地偏向某一方
+func ConvertAmount(amount int64, rate string, fromExponent, toExponent int32) (int64, error) {
+	r, err := ParseExchangeRate(rate)
+	if err != nil {
+		return 0, err
+	}
+	product := new(big.Rat).Mul(new(big.Rat).SetInt64(amount), r)
+	product.Mul(product, pow10Rat(toExponent-fromExponent))
+	rounded := RoundHalfEven(product)
+	if !rounded.IsInt64() {
+		return 0, fmt.Errorf("converted amount overflows: %s", rounded)
+	}
+	converted := rounded.Int64()
+	if amount != 0 && converted == 0 {
+		return 0, ErrConvertedAmountZero
+	}
+	return converted, nil
+}
+
+//汇率的倒数,用于反向换算(如退款),结果舍入到MaxExchangeRateScale位小数
+//倒数舍入为0或者整数部分超出范围时返回ErrInvalidExchangeRate
+func InvertExchangeRate(rate string) (string, error) {
+	r, err := ParseExchangeRate(rate)
+	if err != nil {
+		return "", err
+	}
+	inverse := new(big.Rat).Inv(r)
+	scaled := RoundHalfEven(new(big.Rat).Mul(inverse, pow10Rat(MaxExchangeRateScale)))
+	inverseRate := new(big.Rat).SetFrac(scaled, pow10Rat(MaxExchangeRateScale).Num()).FloatString(MaxExchangeRateScale)
+	if _, err := ParseExchangeRate(inverseRate); err != nil {
+		return "", err
+	}
+	return inverseRate, nil
+}
+
+// 10的n次方,n可以为负数
+func pow10Rat(n int32) *big.Rat {
+	abs := n
+	if abs < 0 {
+		abs = -abs
+	}
+	p := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(abs)), nil)
+	if n < 0 {
+		return new(big.Rat).SetFrac(big.NewInt(1), p)
+	}
+	return new(big.Rat).SetInt(p)
+}
+
+//将有理数舍入为整数,恰好为.5时取最近的偶数
+func RoundHalfEven(r *big.Rat) *big.Int {
+	//Quo为向零截断的除法,rem与被除数同号
+	quo, rem := new(big.Int).QuoRem(r.Num(), r.Denom(), new(big.Int))
+	if rem.Sign() == 0 {
+		return quo
+	}
+
+	//比较2*|rem|与分母的大小,判断小数部分是否超过一半
+	twiceRem := new(big.Int).Mul(new(big.Int).Abs(rem), big.NewInt(2))
+	cmp := twiceRem.Cmp(r.Denom())
+	if cmp > 0 || (cmp == 0 && quo.Bit(0) == 1) {
+		//远离零的方向进一
+		if r.Sign() > 0 {
+			quo.Add(quo, big.NewInt(1))
+		} else {
+			quo.Sub(quo, big.NewInt(1))
+		}
+	}
+	return quo
+}
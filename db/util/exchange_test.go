@@ -0,0 +1,122 @@
+package util
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseExchangeRate(t *testing.T) {
+	valid := []string{"1", "7.1234", "0.0000000001", "123456.5", "9999999999.9999999999"}
+	for _, rate := range valid {
+		_, err := ParseExchangeRate(rate)
+		require.NoError(t, err, rate)
+	}
+
+	invalid := []string{"", "0", "0.000", "-1", "abc", "1/3", "1e3", "0.00000000001", "10000000000", "12345678901.5"}
+	for _, rate := range invalid {
+		_, err := ParseExchangeRate(rate)
+		require.ErrorIs(t, err, ErrInvalidExchangeRate, rate)
+	}
+}
+
+func TestRoundHalfEven(t *testing.T) {
+	testCases := []struct {
+		num, denom int64
+		want       int64
+	}{
+		{5, 2, 2},     //2.5 -> 2
+		{7, 2, 4},     //3.5 -> 4
+		{-5, 2, -2},   //-2.5 -> -2
+		{-7, 2, -4},   //-3.5 -> -4
+		{251, 100, 3}, //2.51 -> 3
+		{249, 100, 2}, //2.49 -> 2
+		{-251, 100, -3},
+		{6, 3, 2},
+		{0, 1, 0},
+	}
+
+	for _, tc := range testCases {
+		got := RoundHalfEven(big.NewRat(tc.num, tc.denom))
+		require.Equal(t, tc.want, got.Int64(), "%d/%d", tc.num, tc.denom)
+	}
+}
+
+func TestConvertAmount(t *testing.T) {
+	testCases := []struct {
+		amount int64
+		rate   string
+		want   int64
+	}{
+		{100, "1", 100},
+		{100, "7.1234", 712},  //712.34
+		{100, "7.125", 712},   //712.5 -> 712
+		{100, "7.135", 714},   //713.5 -> 714
+		{1000, "0.1405", 140}, //140.5 -> 140
+		{1000, "0.1415", 142}, //141.5 -> 142
+		{3, "0.5", 2},         //1.5 -> 2
+		{5, "0.5", 2},         //2.5 -> 2
+	}
+
+	for _, tc := range testCases {
+		got, err := ConvertAmount(tc.amount, tc.rate, 2, 2)
+		require.NoError(t, err)
+		require.Equal(t, tc.want, got, "%d * %s", tc.amount, tc.rate)
+	}
+
+	//金额太小换算后为0
+	_, err := ConvertAmount(1, "0.1", 2, 2)
+	require.ErrorIs(t, err, ErrConvertedAmountZero)
+
+	_, err = ConvertAmount(100, "-1", 2, 2)
+	require.ErrorIs(t, err, ErrInvalidExchangeRate)
+
+	//溢出
+	_, err = ConvertAmount(1<<62, "4", 2, 2)
+	require.Error(t, err)
+
+	//不同的小数位数:1.00USD -> 150JPY(JPY没有小数)
+	got, err := ConvertAmount(100, "150", 2, 0)
+	require.NoError(t, err)
+	require.Equal(t, int64(150), got)
+
+	//150JPY -> 1.00USD
+	got, err = ConvertAmount(150, "0.0066666667", 0, 2)
+	require.NoError(t, err)
+	require.Equal(t, int64(100), got)
+
+	//12.345 KWD(3位小数) -> USD,40.258...美元舍入为4026美分
+	got, err = ConvertAmount(12345, "3.2611", 3, 2)
+	require.NoError(t, err)
+	require.Equal(t, int64(4026), got)
+}
+
+func TestInvertExchangeRate(t *testing.T) {
+	testCases := []struct {
+		rate    string
+		inverse string
+	}{
+		{"1", "1.0000000000"},
+		{"2", "0.5000000000"},
+		{"8", "0.1250000000"},
+		{"7.125", "0.1403508772"},
+		{"0.5", "2.0000000000"},
+	}
+	for _, tc := range testCases {
+		inverse, err := InvertExchangeRate(tc.rate)
+		require.NoError(t, err, tc.rate)
+		require.Equal(t, tc.inverse, inverse, tc.rate)
+
+		//结果可以作为汇率保存
+		_, err = ParseExchangeRate(inverse)
+		require.NoError(t, err)
+	}
+
+	_, err := InvertExchangeRate("abc")
+	require.ErrorIs(t, err, ErrInvalidExchangeRate)
+
+	//倒数为10000000000,超过numeric(20,10)的整数位数
+	_, err = InvertExchangeRate("0.0000000001")
+	require.ErrorIs(t, err, ErrInvalidExchangeRate)
+}
@@ -0,0 +1,10 @@
+package util
+
+//用户角色,普通用户只能操作自己的账户,银行职员可以查看和管理所有账户
+const (
+	DepositorRole = "depositor"
+	BankerRole    = "banker"
+)
+
+//系统内部用户的角色,不能登录,只用于持有清算账户
+const SystemRole = "system"
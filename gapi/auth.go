@@ -0,0 +1,92 @@
+package gapi
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/leilei3167/bank/apiutil"
+	"github.com/leilei3167/bank/token"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	authorizationHeaderKey  = "authorization"
+	authorizationTypeBearer = "bearer"
+)
+
+//不需要鉴权的方法,与HTTP接口的公开路由对应
+var publicMethods = map[string]bool{
+	"/pb.UserService/CreateUser":       true,
+	"/pb.UserService/LoginUser":        true,
+	"/pb.UserService/RenewAccessToken": true,
+}
+
+type authorizationPayloadKey struct{}
+
+//鉴权拦截器,与HTTP接口的authMiddleware规则相同:验证metadata中的token及其所属会话
+//通过后将负载放入ctx供后续的方法使用
+func (server *Server) authInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	if publicMethods[info.FullMethod] {
+		return handler(ctx, req)
+	}
+
+	payload, err := server.authorizeUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return handler(context.WithValue(ctx, authorizationPayloadKey{}, payload), req)
+}
+
+func (server *Server) authorizeUser(ctx context.Context) (*token.Payload, error) {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return nil, unauthenticatedError(errors.New("missing metadata"))
+	}
+	values := md.Get(authorizationHeaderKey)
+	if len(values) == 0 {
+		return nil, unauthenticatedError(errors.New("authorization header is not provided"))
+	}
+
+	//格式应该为: Bearer <token>
+	fields := strings.Fields(values[0])
+	if len(fields) < 2 {
+		return nil, unauthenticatedError(errors.New("invalid authorization header format"))
+	}
+	authorizationType := strings.ToLower(fields[0])
+	if authorizationType != authorizationTypeBearer {
+		return nil, unauthenticatedError(fmt.Errorf("unsupported authorization type %s", authorizationType))
+	}
+
+	payload, err := server.tokenMaker.VerifyToken(fields[1], token.TokenTypeAccess)
+	if err != nil {
+		return nil, unauthenticatedError(err)
+	}
+
+	//会话被吊销后,即使access token还未过期也不能再使用
+	session, err := server.store.GetSession(ctx, payload.SessionID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, unauthenticatedError(err)
+		}
+		return nil, apiutil.GRPCError(err)
+	}
+	if session.IsBlocked {
+		return nil, unauthenticatedError(errors.New("blocked session"))
+	}
+	return payload, nil
+}
+
+func unauthenticatedError(err error) error {
+	return status.Error(codes.Unauthenticated, err.Error())
+}
+
+//鉴权拦截器放入的负载,只能在需要鉴权的方法中调用
+func authPayload(ctx context.Context) *token.Payload {
+	return ctx.Value(authorizationPayloadKey{}).(*token.Payload)
+}
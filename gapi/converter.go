@@ -0,0 +1,71 @@
+package gapi
+
+import (
+	db "github.com/leilei3167/bank/db/sqlc"
+	"github.com/leilei3167/bank/db/util"
+	"github.com/leilei3167/bank/pb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+//不返回哈希后的密码
+func convertUser(user db.User) *pb.User {
+	return &pb.User{
+		Username:          user.Username,
+		FullName:          user.FullName,
+		Email:             user.Email,
+		Role:              user.Role,
+		PasswordChangedAt: timestamppb.New(user.PasswordChangedAt),
+		CreatedAt:         timestamppb.New(user.CreatedAt),
+	}
+}
+
+func convertAccount(account db.Account) *pb.Account {
+	return &pb.Account{
+		Id:             account.ID,
+		Owner:          account.Owner,
+		Balance:        account.Balance,
+		BalanceDecimal: util.Currencies.FormatAmount(account.Balance, account.Currency),
+		Currency:       account.Currency,
+		IsFrozen:       account.IsFrozen,
+		CreatedAt:      timestamppb.New(account.CreatedAt),
+	}
+}
+
+//格式化金额需要双方账户的币种
+func convertTransfer(transfer db.Transfer, fromCurrency, toCurrency string) *pb.Transfer {
+	return &pb.Transfer{
+		Id:                    transfer.ID,
+		FromAccountId:         transfer.FromAccountID,
+		ToAccountId:           transfer.ToAccountID,
+		Amount:                transfer.Amount,
+		AmountDecimal:         util.Currencies.FormatAmount(transfer.Amount, fromCurrency),
+		CreditedAmount:        transfer.CreditedAmount,
+		CreditedAmountDecimal: util.Currencies.FormatAmount(transfer.CreditedAmount, toCurrency),
+		ExchangeRate:          transfer.ExchangeRate,
+		Fee:                   transfer.Fee,
+		ReversalOf:            transfer.ReversalOf.Int64,
+		CreatedAt:             timestamppb.New(transfer.CreatedAt),
+	}
+}
+
+func convertEntry(entry db.Entry, currency string) *pb.Entry {
+	return &pb.Entry{
+		Id:            entry.ID,
+		AccountId:     entry.AccountID,
+		Amount:        entry.Amount,
+		AmountDecimal: util.Currencies.FormatAmount(entry.Amount, currency),
+		CreatedAt:     timestamppb.New(entry.CreatedAt),
+	}
+}
+
+func convertTransferTxResult(result db.TransferTxResult) *pb.CreateTransferResponse {
+	fromCurrency := result.FromAccount.Currency
+	toCurrency := result.ToAccount.Currency
+	return &pb.CreateTransferResponse{
+		Transfer:    convertTransfer(result.Transfer, fromCurrency, toCurrency),
+		FromAccount: convertAccount(result.FromAccount),
+		ToAccount:   convertAccount(result.ToAccount),
+		FromEntry:   convertEntry(result.FromEntry, fromCurrency),
+		ToEntry:     convertEntry(result.ToEntry, toCurrency),
+	}
+}
@@ -0,0 +1,59 @@
+package gapi
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/leilei3167/bank/logger"
+	"github.com/rs/zerolog"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	requestIDHeader    = "x-request-id"
+	maxRequestIDLength = 64
+)
+
+//与HTTP接口的requestLogger相同:沿用或生成请求ID,写入ctx和响应的header,请求结束后记录一行日志
+func requestLogger(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	start := time.Now()
+
+	var requestID string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get(requestIDHeader); len(values) > 0 {
+			requestID = values[0]
+		}
+	}
+	if requestID == "" || len(requestID) > maxRequestIDLength {
+		requestID = uuid.NewString()
+	}
+	ctx = logger.WithRequestID(ctx, requestID)
+	grpc.SetHeader(ctx, metadata.Pairs(requestIDHeader, requestID))
+
+	resp, err := handler(ctx, req)
+
+	code := status.Code(err)
+	var event *zerolog.Event
+	switch code {
+	case codes.OK:
+		event = logger.Ctx(ctx).Info()
+	case codes.Internal, codes.Unknown, codes.Unavailable, codes.DataLoss:
+		event = logger.Ctx(ctx).Error()
+	default:
+		event = logger.Ctx(ctx).Warn()
+	}
+	event = event.
+		Str("protocol", "grpc").
+		Str("method", info.FullMethod).
+		Str("code", code.String()).
+		Dur("latency", time.Since(start))
+	if err != nil {
+		event = event.Str("error", status.Convert(err).Message())
+	}
+	event.Msg("处理请求")
+	return resp, err
+}
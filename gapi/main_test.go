@@ -0,0 +1,79 @@
+package gapi
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/google/uuid"
+	mockdb "github.com/leilei3167/bank/db/mock"
+	db "github.com/leilei3167/bank/db/sqlc"
+	"github.com/leilei3167/bank/db/util"
+	"github.com/leilei3167/bank/token"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+func newTestServer(t *testing.T, store db.Store) *Server {
+	config := util.Config{
+		TokenSymmetricKey:    util.RandomString(32),
+		AccessTokenDuration:  time.Minute,
+		RefreshTokenDuration: time.Hour,
+	}
+
+	server, err := NewServer(config, store)
+	require.NoError(t, err)
+	return server
+}
+
+//在内存中的listener上启动服务并返回连接,测试结束时关闭
+func newTestConn(t *testing.T, server *Server) *grpc.ClientConn {
+	listener := bufconn.Listen(1024 * 1024)
+	go server.Serve(listener)
+
+	conn, err := grpc.Dial("bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithInsecure(),
+	)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		conn.Close()
+		server.Shutdown(context.Background())
+	})
+	return conn
+}
+
+//在metadata中携带access token,与HTTP接口的Authorization请求头格式相同
+func newContextWithBearerToken(t *testing.T, tokenMaker token.Maker, username string, role string) context.Context {
+	accessToken, _, err := tokenMaker.CreateToken(username, role, uuid.New(), token.TokenTypeAccess, time.Minute)
+	require.NoError(t, err)
+
+	md := metadata.Pairs(authorizationHeaderKey, fmt.Sprintf("%s %s", authorizationTypeBearer, accessToken))
+	return metadata.NewOutgoingContext(context.Background(), md)
+}
+
+//让鉴权拦截器查询会话时总是得到一个有效的会话
+func stubActiveSession(store *mockdb.MockStore) {
+	store.EXPECT().
+		GetSession(gomock.Any(), gomock.Any()).
+		AnyTimes().
+		DoAndReturn(func(_ context.Context, id uuid.UUID) (db.Session, error) {
+			return db.Session{ID: id, ExpiresAt: time.Now().Add(time.Hour)}, nil
+		})
+}
+
+func randomAccount(owner string) db.Account {
+	return db.Account{
+		ID:       util.RandomInt(1, 1000),
+		Owner:    owner,
+		Balance:  util.RandomMoney(),
+		Currency: util.USD,
+	}
+}
@@ -0,0 +1,36 @@
+package gapi
+
+import (
+	"github.com/leilei3167/bank/apiutil"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+//列表方法的分页规则与HTTP接口的pageRequest相同:
+//page_id大于0时使用偏移分页,否则使用after/limit游标分页,游标在两种接口之间通用
+type pageRequest struct {
+	PageID   int32 `binding:"omitempty,min=1"`
+	PageSize int32 `binding:"required_with=PageID,omitempty,min=5,max=10"`
+	Limit    int32 `binding:"omitempty,min=1"`
+}
+
+func (req pageRequest) isOffset() bool {
+	return req.PageID > 0
+}
+
+func (req pageRequest) offset() int32 {
+	return (req.PageID - 1) * req.PageSize
+}
+
+//解析游标和每页条数,未指定limit时使用配置中的默认值,无效的游标和超过上限的limit都是客户端的问题
+func (server *Server) cursorPage(after string, limit int32) (apiutil.CursorPage, error) {
+	page, err := apiutil.NewCursorPage(after, limit, server.config.DefaultPageLimit, server.config.MaxPageLimit)
+	if err != nil {
+		return page, invalidArgumentError(err)
+	}
+	return page, nil
+}
+
+func invalidArgumentError(err error) error {
+	return status.Error(codes.InvalidArgument, err.Error())
+}
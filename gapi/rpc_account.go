@@ -0,0 +1,106 @@
+package gapi
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/leilei3167/bank/apiutil"
+	db "github.com/leilei3167/bank/db/sqlc"
+	"github.com/leilei3167/bank/pb"
+)
+
+type createAccountRequest struct {
+	Currency string `binding:"required,currency"`
+}
+
+//只能为自己创建账户,余额创建时为0
+func (server *Server) CreateAccount(ctx context.Context, req *pb.CreateAccountRequest) (*pb.CreateAccountResponse, error) {
+	if err := apiutil.ValidateStruct(createAccountRequest{Currency: req.GetCurrency()}); err != nil {
+		return nil, apiutil.GRPCError(err)
+	}
+
+	account, err := server.store.CreateAccount(ctx, db.CreateAccountParams{
+		Owner:    authPayload(ctx).Username,
+		Currency: req.GetCurrency(),
+		Balance:  0,
+	})
+	if err != nil {
+		return nil, apiutil.GRPCError(err)
+	}
+	return &pb.CreateAccountResponse{Account: convertAccount(account)}, nil
+}
+
+type getAccountRequest struct {
+	ID int64 `binding:"required,min=1"`
+}
+
+//只能查询属于自己的账户
+func (server *Server) GetAccount(ctx context.Context, req *pb.GetAccountRequest) (*pb.GetAccountResponse, error) {
+	if err := apiutil.ValidateStruct(getAccountRequest{ID: req.GetId()}); err != nil {
+		return nil, apiutil.GRPCError(err)
+	}
+
+	account, err := server.ownedAccount(ctx, req.GetId())
+	if err != nil {
+		return nil, err
+	}
+	return &pb.GetAccountResponse{Account: convertAccount(account)}, nil
+}
+
+//查询属于当前用户的账户
+func (server *Server) ownedAccount(ctx context.Context, accountID int64) (db.Account, error) {
+	account, err := server.store.GetAccount(ctx, accountID)
+	if err != nil {
+		return account, apiutil.GRPCError(err)
+	}
+	if account.Owner != authPayload(ctx).Username {
+		return account, apiutil.GRPCError(fmt.Errorf("account [%v]: %w", account.ID, apiutil.ErrNotOwner))
+	}
+	return account, nil
+}
+
+//只列出当前用户的账户
+func (server *Server) ListAccounts(ctx context.Context, req *pb.ListAccountsRequest) (*pb.ListAccountsResponse, error) {
+	pageReq := pageRequest{PageID: req.GetPageId(), PageSize: req.GetPageSize(), Limit: req.GetLimit()}
+	if err := apiutil.ValidateStruct(pageReq); err != nil {
+		return nil, apiutil.GRPCError(err)
+	}
+	owner := authPayload(ctx).Username
+
+	var accounts []db.Account
+	var nextCursor string
+	if pageReq.isOffset() {
+		var err error
+		accounts, err = server.store.ListAccountsByOwner(ctx, db.ListAccountsByOwnerParams{
+			Owner:  owner,
+			Limit:  pageReq.PageSize,
+			Offset: pageReq.offset(),
+		})
+		if err != nil {
+			return nil, apiutil.GRPCError(err)
+		}
+	} else {
+		page, err := server.cursorPage(req.GetAfter(), req.GetLimit())
+		if err != nil {
+			return nil, err
+		}
+		accounts, err = server.store.ListAccountsByOwnerAfter(ctx, db.ListAccountsByOwnerAfterParams{
+			Owner:      owner,
+			AfterID:    page.AfterID,
+			LimitCount: page.QueryLimit(),
+		})
+		if err != nil {
+			return nil, apiutil.GRPCError(err)
+		}
+		if page.HasMore(len(accounts)) {
+			accounts = accounts[:page.Limit]
+			nextCursor = apiutil.EncodePageCursor(accounts[len(accounts)-1].ID)
+		}
+	}
+
+	resp := &pb.ListAccountsResponse{Accounts: make([]*pb.Account, 0, len(accounts)), NextCursor: nextCursor}
+	for _, account := range accounts {
+		resp.Accounts = append(resp.Accounts, convertAccount(account))
+	}
+	return resp, nil
+}
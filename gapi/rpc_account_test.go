@@ -0,0 +1,234 @@
+package gapi
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/google/uuid"
+	"github.com/leilei3167/bank/apiutil"
+	mockdb "github.com/leilei3167/bank/db/mock"
+	db "github.com/leilei3167/bank/db/sqlc"
+	"github.com/leilei3167/bank/db/util"
+	"github.com/leilei3167/bank/pb"
+	"github.com/leilei3167/bank/token"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestGetAccountRPC(t *testing.T) {
+	account := randomAccount(util.RandOwner())
+
+	testCases := []struct {
+		name          string
+		accountID     int64
+		buildContext  func(t *testing.T, tokenMaker token.Maker) context.Context
+		buildStubs    func(store *mockdb.MockStore)
+		checkResponse func(t *testing.T, res *pb.GetAccountResponse, err error)
+	}{
+		{
+			name:      "OK",
+			accountID: account.ID,
+			buildContext: func(t *testing.T, tokenMaker token.Maker) context.Context {
+				return newContextWithBearerToken(t, tokenMaker, account.Owner, util.DepositorRole)
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				stubActiveSession(store)
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(account.ID)).Times(1).Return(account, nil)
+			},
+			checkResponse: func(t *testing.T, res *pb.GetAccountResponse, err error) {
+				require.NoError(t, err)
+				require.Equal(t, account.ID, res.GetAccount().GetId())
+				require.Equal(t, account.Balance, res.GetAccount().GetBalance())
+				require.Equal(t, util.Currencies.FormatAmount(account.Balance, account.Currency), res.GetAccount().GetBalanceDecimal())
+			},
+		},
+		{
+			name:      "NotFound",
+			accountID: account.ID,
+			buildContext: func(t *testing.T, tokenMaker token.Maker) context.Context {
+				return newContextWithBearerToken(t, tokenMaker, account.Owner, util.DepositorRole)
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				stubActiveSession(store)
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(account.ID)).Times(1).Return(db.Account{}, sql.ErrNoRows)
+			},
+			checkResponse: func(t *testing.T, res *pb.GetAccountResponse, err error) {
+				require.Equal(t, codes.NotFound, status.Code(err))
+			},
+		},
+		{
+			name:      "InvalidID",
+			accountID: 0,
+			buildContext: func(t *testing.T, tokenMaker token.Maker) context.Context {
+				return newContextWithBearerToken(t, tokenMaker, account.Owner, util.DepositorRole)
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				stubActiveSession(store)
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(t *testing.T, res *pb.GetAccountResponse, err error) {
+				require.Equal(t, codes.InvalidArgument, status.Code(err))
+			},
+		},
+		{
+			name:      "UnauthorizedUser",
+			accountID: account.ID,
+			buildContext: func(t *testing.T, tokenMaker token.Maker) context.Context {
+				return newContextWithBearerToken(t, tokenMaker, "unauthorized_user", util.DepositorRole)
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				stubActiveSession(store)
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(account.ID)).Times(1).Return(account, nil)
+			},
+			checkResponse: func(t *testing.T, res *pb.GetAccountResponse, err error) {
+				//与HTTP接口的403一致
+				require.Equal(t, codes.PermissionDenied, status.Code(err))
+			},
+		},
+		{
+			name:      "NoAuthorization",
+			accountID: account.ID,
+			buildContext: func(t *testing.T, tokenMaker token.Maker) context.Context {
+				return context.Background()
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetSession(gomock.Any(), gomock.Any()).Times(0)
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(t *testing.T, res *pb.GetAccountResponse, err error) {
+				require.Equal(t, codes.Unauthenticated, status.Code(err))
+			},
+		},
+		{
+			name:      "UnsupportedAuthorization",
+			accountID: account.ID,
+			buildContext: func(t *testing.T, tokenMaker token.Maker) context.Context {
+				return metadata.AppendToOutgoingContext(context.Background(), authorizationHeaderKey, "basic user:password")
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetSession(gomock.Any(), gomock.Any()).Times(0)
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(t *testing.T, res *pb.GetAccountResponse, err error) {
+				require.Equal(t, codes.Unauthenticated, status.Code(err))
+			},
+		},
+		{
+			name:      "RefreshToken",
+			accountID: account.ID,
+			buildContext: func(t *testing.T, tokenMaker token.Maker) context.Context {
+				refreshToken, _, err := tokenMaker.CreateToken(account.Owner, util.DepositorRole, uuid.New(), token.TokenTypeRefresh, time.Hour)
+				require.NoError(t, err)
+				return metadata.AppendToOutgoingContext(context.Background(), authorizationHeaderKey, authorizationTypeBearer+" "+refreshToken)
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetSession(gomock.Any(), gomock.Any()).Times(0)
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(t *testing.T, res *pb.GetAccountResponse, err error) {
+				require.Equal(t, codes.Unauthenticated, status.Code(err))
+			},
+		},
+		{
+			name:      "BlockedSession",
+			accountID: account.ID,
+			buildContext: func(t *testing.T, tokenMaker token.Maker) context.Context {
+				return newContextWithBearerToken(t, tokenMaker, account.Owner, util.DepositorRole)
+			},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetSession(gomock.Any(), gomock.Any()).Times(1).Return(db.Session{IsBlocked: true}, nil)
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(t *testing.T, res *pb.GetAccountResponse, err error) {
+				require.Equal(t, codes.Unauthenticated, status.Code(err))
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			store := mockdb.NewMockStore(ctrl)
+			tc.buildStubs(store)
+
+			server := newTestServer(t, store)
+			conn := newTestConn(t, server)
+			ctx := tc.buildContext(t, server.tokenMaker)
+			res, err := pb.NewAccountServiceClient(conn).GetAccount(ctx, &pb.GetAccountRequest{Id: tc.accountID})
+			tc.checkResponse(t, res, err)
+		})
+	}
+}
+
+func TestListAccountsRPC(t *testing.T) {
+	owner := util.RandOwner()
+	accounts := []db.Account{randomAccount(owner), randomAccount(owner)}
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	store := mockdb.NewMockStore(ctrl)
+	stubActiveSession(store)
+	arg := db.ListAccountsByOwnerParams{Owner: owner, Limit: 5, Offset: 5}
+	store.EXPECT().ListAccountsByOwner(gomock.Any(), gomock.Eq(arg)).Times(1).Return(accounts, nil)
+
+	server := newTestServer(t, store)
+	client := pb.NewAccountServiceClient(newTestConn(t, server))
+	ctx := newContextWithBearerToken(t, server.tokenMaker, owner, util.DepositorRole)
+
+	res, err := client.ListAccounts(ctx, &pb.ListAccountsRequest{PageId: 2, PageSize: 5})
+	require.NoError(t, err)
+	require.Len(t, res.GetAccounts(), len(accounts))
+	require.Empty(t, res.GetNextCursor())
+
+	//分页的规则和HTTP接口相同
+	_, err = client.ListAccounts(ctx, &pb.ListAccountsRequest{PageId: 1, PageSize: 20})
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestListAccountsCursorRPC(t *testing.T) {
+	owner := util.RandOwner()
+	accounts := make([]db.Account, 3)
+	for i := range accounts {
+		accounts[i] = randomAccount(owner)
+		accounts[i].ID = int64(i + 1)
+	}
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	store := mockdb.NewMockStore(ctrl)
+	stubActiveSession(store)
+	//多查询一条用来判断是否还有下一页
+	gomock.InOrder(
+		store.EXPECT().ListAccountsByOwnerAfter(gomock.Any(), gomock.Eq(db.ListAccountsByOwnerAfterParams{Owner: owner, AfterID: 0, LimitCount: 3})).
+			Times(1).Return(accounts, nil),
+		store.EXPECT().ListAccountsByOwnerAfter(gomock.Any(), gomock.Eq(db.ListAccountsByOwnerAfterParams{Owner: owner, AfterID: 2, LimitCount: 3})).
+			Times(1).Return(accounts[2:], nil),
+	)
+
+	server := newTestServer(t, store)
+	client := pb.NewAccountServiceClient(newTestConn(t, server))
+	ctx := newContextWithBearerToken(t, server.tokenMaker, owner, util.DepositorRole)
+
+	res, err := client.ListAccounts(ctx, &pb.ListAccountsRequest{Limit: 2})
+	require.NoError(t, err)
+	require.Len(t, res.GetAccounts(), 2)
+	//游标和HTTP接口通用
+	require.Equal(t, apiutil.EncodePageCursor(2), res.GetNextCursor())
+
+	res, err = client.ListAccounts(ctx, &pb.ListAccountsRequest{After: res.GetNextCursor(), Limit: 2})
+	require.NoError(t, err)
+	require.Len(t, res.GetAccounts(), 1)
+	require.Empty(t, res.GetNextCursor())
+
+	_, err = client.ListAccounts(ctx, &pb.ListAccountsRequest{After: "invalid"})
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+}
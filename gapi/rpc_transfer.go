@@ -0,0 +1,266 @@
+package gapi
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/leilei3167/bank/apiutil"
+	db "github.com/leilei3167/bank/db/sqlc"
+	"github.com/leilei3167/bank/pb"
+)
+
+//校验规则与HTTP接口的transferRequest相同,幂等键在HTTP接口中通过请求头传入
+type createTransferRequest struct {
+	FromAccountID  int64  `binding:"required,min=1"`
+	ToAccountID    int64  `binding:"required,min=1"`
+	Amount         int64  `binding:"required,min=0"`
+	Currency       string `binding:"required,currency"`
+	IdempotencyKey string `binding:"max=255"`
+}
+
+//与HTTP接口的createTransfer相同:只有转出账户的拥有者才能发起转账,金额以转出账户的货币计算
+//带幂等键的请求如果已经完成,直接返回之前的结果
+func (server *Server) CreateTransfer(ctx context.Context, req *pb.CreateTransferRequest) (*pb.CreateTransferResponse, error) {
+	if err := apiutil.ValidateStruct(createTransferRequest{
+		FromAccountID:  req.GetFromAccountId(),
+		ToAccountID:    req.GetToAccountId(),
+		Amount:         req.GetAmount(),
+		Currency:       req.GetCurrency(),
+		IdempotencyKey: req.GetIdempotencyKey(),
+	}); err != nil {
+		return nil, apiutil.GRPCError(err)
+	}
+	username := authPayload(ctx).Username
+
+	//和HTTP接口使用同样的哈希,同一个幂等键可以在两种接口之间重试
+	requestHash := apiutil.HashTransferRequest(req.GetFromAccountId(), req.GetToAccountId(), req.GetAmount(), req.GetCurrency())
+	idempotencyKey := req.GetIdempotencyKey()
+	if idempotencyKey != "" {
+		resp, err := server.replayTransfer(ctx, username, idempotencyKey, requestHash)
+		if err != nil || resp != nil {
+			return resp, err
+		}
+	}
+
+	fromAccount, err := server.validAccount(ctx, req.GetFromAccountId())
+	if err != nil {
+		return nil, err
+	}
+	if fromAccount.Owner != username {
+		return nil, apiutil.GRPCError(fmt.Errorf("from account [%v]: %w", fromAccount.ID, apiutil.ErrNotOwner))
+	}
+	if fromAccount.Currency != req.GetCurrency() {
+		err := fmt.Errorf("account [%v] currency mismatch:[%v]->[%v]: %w",
+			fromAccount.ID, fromAccount.Currency, req.GetCurrency(), apiutil.ErrCurrencyMismatch)
+		return nil, apiutil.GRPCError(err)
+	}
+	//转入账户可以是其他币种,由TransferTx按照汇率换算
+	if _, err := server.validAccount(ctx, req.GetToAccountId()); err != nil {
+		return nil, err
+	}
+
+	arg := db.TransferTxParams{
+		FromAccountID: req.GetFromAccountId(),
+		ToAccountID:   req.GetToAccountId(),
+		Amount:        req.GetAmount(),
+	}
+	if idempotencyKey == "" {
+		result, err := server.store.TransferTx(ctx, arg)
+		if err != nil {
+			return nil, apiutil.GRPCError(err)
+		}
+		return convertTransferTxResult(result), nil
+	}
+
+	result, err := server.store.IdempotentTransferTx(ctx, db.IdempotentTransferTxParams{
+		TransferTxParams: arg,
+		Username:         username,
+		Key:              idempotencyKey,
+		RequestHash:      requestHash,
+	})
+	if err != nil {
+		return nil, apiutil.GRPCError(err)
+	}
+	resp := convertTransferTxResult(result.TransferTxResult)
+	resp.Replayed = result.Replayed
+	return resp, nil
+}
+
+//幂等键对应的请求已经完成时返回之前的结果,还没有使用过时返回nil
+func (server *Server) replayTransfer(ctx context.Context, username, idempotencyKey, requestHash string) (*pb.CreateTransferResponse, error) {
+	key, err := server.store.GetIdempotencyKey(ctx, db.GetIdempotencyKeyParams{
+		Username: username,
+		Key:      idempotencyKey,
+	})
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, apiutil.GRPCError(err)
+	}
+	if key.RequestHash != requestHash {
+		return nil, apiutil.GRPCError(db.ErrIdempotencyKeyReused)
+	}
+
+	var result db.TransferTxResult
+	if err := json.Unmarshal(key.Response, &result); err != nil {
+		return nil, apiutil.GRPCError(err)
+	}
+	resp := convertTransferTxResult(result)
+	resp.Replayed = true
+	return resp, nil
+}
+
+//检查账户是否存在以及是否被冻结,冻结的账户不能参与转账
+func (server *Server) validAccount(ctx context.Context, accountID int64) (db.Account, error) {
+	account, err := server.store.GetAccount(ctx, accountID)
+	if err != nil {
+		return account, apiutil.GRPCError(err)
+	}
+	if db.IsSystemAccountOwner(account.Owner) {
+		return account, apiutil.GRPCError(fmt.Errorf("account [%v]: %w", accountID, db.ErrSystemAccount))
+	}
+	if account.IsFrozen {
+		return account, apiutil.GRPCError(fmt.Errorf("account [%v]: %w", accountID, db.ErrAccountFrozen))
+	}
+	return account, nil
+}
+
+type getTransferRequest struct {
+	ID int64 `binding:"required,min=1"`
+}
+
+//用户只能查看转出或转入账户属于自己的转账
+func (server *Server) GetTransfer(ctx context.Context, req *pb.GetTransferRequest) (*pb.GetTransferResponse, error) {
+	if err := apiutil.ValidateStruct(getTransferRequest{ID: req.GetId()}); err != nil {
+		return nil, apiutil.GRPCError(err)
+	}
+
+	transfer, err := server.store.GetTransfer(ctx, req.GetId())
+	if err != nil {
+		return nil, apiutil.GRPCError(err)
+	}
+	fromAccount, err := server.store.GetAccount(ctx, transfer.FromAccountID)
+	if err != nil {
+		return nil, apiutil.GRPCError(err)
+	}
+	toAccount, err := server.store.GetAccount(ctx, transfer.ToAccountID)
+	if err != nil {
+		return nil, apiutil.GRPCError(err)
+	}
+
+	username := authPayload(ctx).Username
+	if fromAccount.Owner != username && toAccount.Owner != username {
+		return nil, apiutil.GRPCError(fmt.Errorf("transfer [%v]: %w", transfer.ID, apiutil.ErrNotOwner))
+	}
+	return &pb.GetTransferResponse{Transfer: convertTransfer(transfer, fromAccount.Currency, toAccount.Currency)}, nil
+}
+
+//校验规则与HTTP接口的listTransfersRequest相同
+type listTransfersRequest struct {
+	AccountID      int64  `binding:"required,min=1"`
+	Direction      string `binding:"omitempty,oneof=incoming outgoing"`
+	CounterpartyID int64  `binding:"omitempty,min=1"`
+	MinAmount      int64  `binding:"omitempty,min=1"`
+	MaxAmount      int64  `binding:"omitempty,min=1"`
+	pageRequest
+}
+
+//列出属于当前用户的账户的转账
+func (server *Server) ListTransfers(ctx context.Context, req *pb.ListTransfersRequest) (*pb.ListTransfersResponse, error) {
+	pageReq := pageRequest{PageID: req.GetPageId(), PageSize: req.GetPageSize(), Limit: req.GetLimit()}
+	if err := apiutil.ValidateStruct(listTransfersRequest{
+		AccountID:      req.GetAccountId(),
+		Direction:      req.GetDirection(),
+		CounterpartyID: req.GetCounterpartyId(),
+		MinAmount:      req.GetMinAmount(),
+		MaxAmount:      req.GetMaxAmount(),
+		pageRequest:    pageReq,
+	}); err != nil {
+		return nil, apiutil.GRPCError(err)
+	}
+	if req.GetMinAmount() > 0 && req.GetMaxAmount() > 0 && req.GetMinAmount() > req.GetMaxAmount() {
+		return nil, invalidArgumentError(errors.New("min_amount must not be greater than max_amount"))
+	}
+	//未设置的时间是nil,不能直接调用AsTime,否则得到的是1970年
+	var from, to time.Time
+	if req.GetFrom() != nil {
+		from = req.GetFrom().AsTime()
+	}
+	if req.GetTo() != nil {
+		to = req.GetTo().AsTime()
+	}
+	if !from.IsZero() && !to.IsZero() && !from.Before(to) {
+		return nil, invalidArgumentError(errors.New("from must be before to"))
+	}
+
+	account, err := server.ownedAccount(ctx, req.GetAccountId())
+	if err != nil {
+		return nil, err
+	}
+
+	arg := db.ListTransfersParams{
+		AccountID:      account.ID,
+		Direction:      sql.NullString{String: req.GetDirection(), Valid: req.GetDirection() != ""},
+		CounterpartyID: sql.NullInt64{Int64: req.GetCounterpartyId(), Valid: req.GetCounterpartyId() > 0},
+		MinAmount:      sql.NullInt64{Int64: req.GetMinAmount(), Valid: req.GetMinAmount() > 0},
+		MaxAmount:      sql.NullInt64{Int64: req.GetMaxAmount(), Valid: req.GetMaxAmount() > 0},
+		FromTime:       sql.NullTime{Time: from, Valid: !from.IsZero()},
+		ToTime:         sql.NullTime{Time: to, Valid: !to.IsZero()},
+	}
+	var page apiutil.CursorPage
+	if pageReq.isOffset() {
+		arg.LimitCount = pageReq.PageSize
+		arg.OffsetCount = pageReq.offset()
+	} else {
+		page, err = server.cursorPage(req.GetAfter(), req.GetLimit())
+		if err != nil {
+			return nil, err
+		}
+		arg.AfterID = page.AfterID
+		arg.LimitCount = page.QueryLimit()
+	}
+
+	transfers, err := server.store.ListTransfers(ctx, arg)
+	if err != nil {
+		return nil, apiutil.GRPCError(err)
+	}
+
+	resp := &pb.ListTransfersResponse{}
+	if !pageReq.isOffset() && page.HasMore(len(transfers)) {
+		transfers = transfers[:page.Limit]
+		resp.NextCursor = apiutil.EncodePageCursor(transfers[len(transfers)-1].ID)
+	}
+
+	//对方账户的币种需要单独查询,同一页中相同的对方账户只查一次
+	currencies := map[int64]string{account.ID: account.Currency}
+	currencyOf := func(accountID int64) (string, error) {
+		if currency, ok := currencies[accountID]; ok {
+			return currency, nil
+		}
+		counterparty, err := server.store.GetAccount(ctx, accountID)
+		if err != nil {
+			return "", err
+		}
+		currencies[accountID] = counterparty.Currency
+		return counterparty.Currency, nil
+	}
+
+	resp.Transfers = make([]*pb.Transfer, 0, len(transfers))
+	for _, transfer := range transfers {
+		fromCurrency, err := currencyOf(transfer.FromAccountID)
+		if err != nil {
+			return nil, apiutil.GRPCError(err)
+		}
+		toCurrency, err := currencyOf(transfer.ToAccountID)
+		if err != nil {
+			return nil, apiutil.GRPCError(err)
+		}
+		resp.Transfers = append(resp.Transfers, convertTransfer(transfer, fromCurrency, toCurrency))
+	}
+	return resp, nil
+}
@@ -0,0 +1,365 @@
+package gapi
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/leilei3167/bank/apiutil"
+	mockdb "github.com/leilei3167/bank/db/mock"
+	db "github.com/leilei3167/bank/db/sqlc"
+	"github.com/leilei3167/bank/db/util"
+	"github.com/leilei3167/bank/pb"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func TestCreateTransferRPC(t *testing.T) {
+	owner := util.RandOwner()
+	account1 := randomAccount(owner)
+	account2 := randomAccount(util.RandOwner())
+	account2.ID = account1.ID + 1
+	frozen := account2
+	frozen.IsFrozen = true
+	amount := int64(10)
+
+	arg := db.TransferTxParams{FromAccountID: account1.ID, ToAccountID: account2.ID, Amount: amount}
+	result := db.TransferTxResult{
+		Transfer:    db.Transfer{ID: 1, FromAccountID: account1.ID, ToAccountID: account2.ID, Amount: amount, CreditedAmount: amount},
+		FromAccount: account1,
+		ToAccount:   account2,
+		FromEntry:   db.Entry{ID: 1, AccountID: account1.ID, Amount: -amount},
+		ToEntry:     db.Entry{ID: 2, AccountID: account2.ID, Amount: amount},
+	}
+	//和HTTP接口相同的哈希,两种接口可以用同一个幂等键重试
+	requestHash := apiutil.HashTransferRequest(account1.ID, account2.ID, amount, util.USD)
+	storedResult, err := json.Marshal(result)
+	require.NoError(t, err)
+
+	request := func(key string) *pb.CreateTransferRequest {
+		return &pb.CreateTransferRequest{
+			FromAccountId:  account1.ID,
+			ToAccountId:    account2.ID,
+			Amount:         amount,
+			Currency:       util.USD,
+			IdempotencyKey: key,
+		}
+	}
+
+	testCases := []struct {
+		name          string
+		req           *pb.CreateTransferRequest
+		username      string
+		buildStubs    func(store *mockdb.MockStore)
+		checkResponse func(t *testing.T, res *pb.CreateTransferResponse, err error)
+	}{
+		{
+			name:     "OK",
+			req:      request(""),
+			username: owner,
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(account1.ID)).Times(1).Return(account1, nil)
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(account2.ID)).Times(1).Return(account2, nil)
+				store.EXPECT().TransferTx(gomock.Any(), gomock.Eq(arg)).Times(1).Return(result, nil)
+			},
+			checkResponse: func(t *testing.T, res *pb.CreateTransferResponse, err error) {
+				require.NoError(t, err)
+				require.Equal(t, result.Transfer.ID, res.GetTransfer().GetId())
+				require.Equal(t, -amount, res.GetFromEntry().GetAmount())
+				require.False(t, res.GetReplayed())
+			},
+		},
+		{
+			name:     "InvalidCurrency",
+			req:      &pb.CreateTransferRequest{FromAccountId: account1.ID, ToAccountId: account2.ID, Amount: amount, Currency: "XYZ"},
+			username: owner,
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(t *testing.T, res *pb.CreateTransferResponse, err error) {
+				require.Equal(t, codes.InvalidArgument, status.Code(err))
+			},
+		},
+		{
+			name:     "CurrencyMismatch",
+			req:      &pb.CreateTransferRequest{FromAccountId: account1.ID, ToAccountId: account2.ID, Amount: amount, Currency: util.EUR},
+			username: owner,
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(account1.ID)).Times(1).Return(account1, nil)
+				store.EXPECT().TransferTx(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(t *testing.T, res *pb.CreateTransferResponse, err error) {
+				require.Equal(t, codes.InvalidArgument, status.Code(err))
+			},
+		},
+		{
+			name:     "UnauthorizedUser",
+			req:      request(""),
+			username: "unauthorized_user",
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(account1.ID)).Times(1).Return(account1, nil)
+				store.EXPECT().TransferTx(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(t *testing.T, res *pb.CreateTransferResponse, err error) {
+				require.Equal(t, codes.PermissionDenied, status.Code(err))
+			},
+		},
+		{
+			name:     "FrozenAccount",
+			req:      request(""),
+			username: owner,
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(account1.ID)).Times(1).Return(account1, nil)
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(account2.ID)).Times(1).Return(frozen, nil)
+				store.EXPECT().TransferTx(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(t *testing.T, res *pb.CreateTransferResponse, err error) {
+				//与HTTP接口的403一致
+				require.Equal(t, codes.PermissionDenied, status.Code(err))
+			},
+		},
+		{
+			name:     "SystemAccount",
+			req:      request(""),
+			username: owner,
+			buildStubs: func(store *mockdb.MockStore) {
+				system := account2
+				system.Owner = db.FeeAccountOwner
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(account1.ID)).Times(1).Return(account1, nil)
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(account2.ID)).Times(1).Return(system, nil)
+				store.EXPECT().TransferTx(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(t *testing.T, res *pb.CreateTransferResponse, err error) {
+				require.Equal(t, codes.InvalidArgument, status.Code(err))
+			},
+		},
+		{
+			name:     "InsufficientBalance",
+			req:      request(""),
+			username: owner,
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(account1.ID)).Times(1).Return(account1, nil)
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(account2.ID)).Times(1).Return(account2, nil)
+				store.EXPECT().TransferTx(gomock.Any(), gomock.Any()).Times(1).
+					Return(db.TransferTxResult{}, fmt.Errorf("account [%v]: %w", account1.ID, db.ErrInsufficientBalance))
+			},
+			checkResponse: func(t *testing.T, res *pb.CreateTransferResponse, err error) {
+				require.Equal(t, codes.InvalidArgument, status.Code(err))
+			},
+		},
+		{
+			name:     "IdempotentFirstRequest",
+			req:      request("key"),
+			username: owner,
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetIdempotencyKey(gomock.Any(), gomock.Any()).Times(1).Return(db.IdempotencyKey{}, sql.ErrNoRows)
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(account1.ID)).Times(1).Return(account1, nil)
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(account2.ID)).Times(1).Return(account2, nil)
+				store.EXPECT().IdempotentTransferTx(gomock.Any(), gomock.Eq(db.IdempotentTransferTxParams{
+					TransferTxParams: arg,
+					Username:         owner,
+					Key:              "key",
+					RequestHash:      requestHash,
+				})).Times(1).Return(db.IdempotentTransferTxResult{TransferTxResult: result}, nil)
+			},
+			checkResponse: func(t *testing.T, res *pb.CreateTransferResponse, err error) {
+				require.NoError(t, err)
+				require.False(t, res.GetReplayed())
+			},
+		},
+		{
+			name:     "IdempotentReplay",
+			req:      request("key"),
+			username: owner,
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetIdempotencyKey(gomock.Any(), gomock.Eq(db.GetIdempotencyKeyParams{Username: owner, Key: "key"})).Times(1).
+					Return(db.IdempotencyKey{Username: owner, Key: "key", RequestHash: requestHash, Response: storedResult}, nil)
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Any()).Times(0)
+				store.EXPECT().IdempotentTransferTx(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(t *testing.T, res *pb.CreateTransferResponse, err error) {
+				require.NoError(t, err)
+				require.True(t, res.GetReplayed())
+				require.Equal(t, result.Transfer.ID, res.GetTransfer().GetId())
+			},
+		},
+		{
+			name:     "IdempotencyKeyReused",
+			req:      request("key"),
+			username: owner,
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetIdempotencyKey(gomock.Any(), gomock.Any()).Times(1).
+					Return(db.IdempotencyKey{Username: owner, Key: "key", RequestHash: "other", Response: storedResult}, nil)
+				store.EXPECT().IdempotentTransferTx(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(t *testing.T, res *pb.CreateTransferResponse, err error) {
+				//HTTP接口返回409
+				require.Equal(t, codes.AlreadyExists, status.Code(err))
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			store := mockdb.NewMockStore(ctrl)
+			stubActiveSession(store)
+			tc.buildStubs(store)
+
+			server := newTestServer(t, store)
+			conn := newTestConn(t, server)
+			ctx := newContextWithBearerToken(t, server.tokenMaker, tc.username, util.DepositorRole)
+			res, err := pb.NewTransferServiceClient(conn).CreateTransfer(ctx, tc.req)
+			tc.checkResponse(t, res, err)
+		})
+	}
+}
+
+func TestGetTransferRPC(t *testing.T) {
+	owner := util.RandOwner()
+	account1 := randomAccount(owner)
+	account2 := randomAccount(util.RandOwner())
+	transfer := db.Transfer{ID: 7, FromAccountID: account1.ID, ToAccountID: account2.ID, Amount: 100, CreditedAmount: 100}
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	store := mockdb.NewMockStore(ctrl)
+	stubActiveSession(store)
+	store.EXPECT().GetTransfer(gomock.Any(), gomock.Eq(transfer.ID)).Times(2).Return(transfer, nil)
+	store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(account1.ID)).Times(2).Return(account1, nil)
+	store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(account2.ID)).Times(2).Return(account2, nil)
+
+	server := newTestServer(t, store)
+	client := pb.NewTransferServiceClient(newTestConn(t, server))
+
+	res, err := client.GetTransfer(newContextWithBearerToken(t, server.tokenMaker, owner, util.DepositorRole), &pb.GetTransferRequest{Id: transfer.ID})
+	require.NoError(t, err)
+	require.Equal(t, transfer.ID, res.GetTransfer().GetId())
+	require.Equal(t, "1.00", res.GetTransfer().GetAmountDecimal())
+
+	//双方账户都不属于当前用户
+	_, err = client.GetTransfer(newContextWithBearerToken(t, server.tokenMaker, "other_user", util.DepositorRole), &pb.GetTransferRequest{Id: transfer.ID})
+	require.Equal(t, codes.PermissionDenied, status.Code(err))
+}
+
+func TestListTransfersRPC(t *testing.T) {
+	owner := util.RandOwner()
+	account := randomAccount(owner)
+	counterparty := randomAccount(util.RandOwner())
+	counterparty.ID = account.ID + 1
+	counterparty.Currency = util.EUR
+	transfers := []db.Transfer{
+		{ID: 1, FromAccountID: account.ID, ToAccountID: counterparty.ID, Amount: 100, CreditedAmount: 90},
+		{ID: 2, FromAccountID: counterparty.ID, ToAccountID: account.ID, Amount: 50, CreditedAmount: 55},
+	}
+	from := time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+	testCases := []struct {
+		name          string
+		req           *pb.ListTransfersRequest
+		username      string
+		buildStubs    func(store *mockdb.MockStore)
+		checkResponse func(t *testing.T, res *pb.ListTransfersResponse, err error)
+	}{
+		{
+			name:     "OK",
+			req:      &pb.ListTransfersRequest{AccountId: account.ID, Direction: "outgoing", From: timestamppb.New(from), Limit: 1},
+			username: owner,
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(account.ID)).Times(1).Return(account, nil)
+				arg := db.ListTransfersParams{
+					AccountID:  account.ID,
+					Direction:  sql.NullString{String: "outgoing", Valid: true},
+					FromTime:   sql.NullTime{Time: from, Valid: true},
+					LimitCount: 2,
+				}
+				store.EXPECT().ListTransfers(gomock.Any(), gomock.Eq(arg)).Times(1).Return(transfers, nil)
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(counterparty.ID)).Times(1).Return(counterparty, nil)
+			},
+			checkResponse: func(t *testing.T, res *pb.ListTransfersResponse, err error) {
+				require.NoError(t, err)
+				require.Len(t, res.GetTransfers(), 1)
+				require.Equal(t, "0.90", res.GetTransfers()[0].GetCreditedAmountDecimal())
+				require.Equal(t, apiutil.EncodePageCursor(1), res.GetNextCursor())
+			},
+		},
+		{
+			name:     "OffsetPage",
+			req:      &pb.ListTransfersRequest{AccountId: account.ID, PageId: 2, PageSize: 5},
+			username: owner,
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(account.ID)).Times(1).Return(account, nil)
+				arg := db.ListTransfersParams{AccountID: account.ID, LimitCount: 5, OffsetCount: 5}
+				store.EXPECT().ListTransfers(gomock.Any(), gomock.Eq(arg)).Times(1).Return(transfers, nil)
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(counterparty.ID)).Times(1).Return(counterparty, nil)
+			},
+			checkResponse: func(t *testing.T, res *pb.ListTransfersResponse, err error) {
+				require.NoError(t, err)
+				require.Len(t, res.GetTransfers(), 2)
+				require.Empty(t, res.GetNextCursor())
+			},
+		},
+		{
+			name:     "InvalidAmountRange",
+			req:      &pb.ListTransfersRequest{AccountId: account.ID, MinAmount: 10, MaxAmount: 5},
+			username: owner,
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().ListTransfers(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(t *testing.T, res *pb.ListTransfersResponse, err error) {
+				require.Equal(t, codes.InvalidArgument, status.Code(err))
+			},
+		},
+		{
+			name:     "InvalidDirection",
+			req:      &pb.ListTransfersRequest{AccountId: account.ID, Direction: "sideways"},
+			username: owner,
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().ListTransfers(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(t *testing.T, res *pb.ListTransfersResponse, err error) {
+				require.Equal(t, codes.InvalidArgument, status.Code(err))
+			},
+		},
+		{
+			name:     "UnauthorizedUser",
+			req:      &pb.ListTransfersRequest{AccountId: account.ID},
+			username: "unauthorized_user",
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetAccount(gomock.Any(), gomock.Eq(account.ID)).Times(1).Return(account, nil)
+				store.EXPECT().ListTransfers(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(t *testing.T, res *pb.ListTransfersResponse, err error) {
+				require.Equal(t, codes.PermissionDenied, status.Code(err))
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			store := mockdb.NewMockStore(ctrl)
+			stubActiveSession(store)
+			tc.buildStubs(store)
+
+			server := newTestServer(t, store)
+			conn := newTestConn(t, server)
+			ctx := newContextWithBearerToken(t, server.tokenMaker, tc.username, util.DepositorRole)
+			res, err := pb.NewTransferServiceClient(conn).ListTransfers(ctx, tc.req)
+			tc.checkResponse(t, res, err)
+		})
+	}
+}
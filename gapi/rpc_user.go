@@ -0,0 +1,182 @@
+package gapi
+
+import (
+	"context"
+	"errors"
+	"net"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/leilei3167/bank/apiutil"
+	db "github.com/leilei3167/bank/db/sqlc"
+	"github.com/leilei3167/bank/db/util"
+	"github.com/leilei3167/bank/pb"
+	"github.com/leilei3167/bank/token"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+//校验规则与HTTP接口的createUserRequest相同
+type createUserRequest struct {
+	Username string `binding:"required,alphanum"`
+	Password string `binding:"required,min=6"`
+	FullName string `binding:"required"`
+	Email    string `binding:"required,email"`
+}
+
+func (server *Server) CreateUser(ctx context.Context, req *pb.CreateUserRequest) (*pb.CreateUserResponse, error) {
+	if err := apiutil.ValidateStruct(createUserRequest{
+		Username: req.GetUsername(),
+		Password: req.GetPassword(),
+		FullName: req.GetFullName(),
+		Email:    req.GetEmail(),
+	}); err != nil {
+		return nil, apiutil.GRPCError(err)
+	}
+
+	hashedPassword, err := util.HashPassword(req.GetPassword())
+	if err != nil {
+		return nil, apiutil.GRPCError(err)
+	}
+	user, err := server.store.CreateUser(ctx, db.CreateUserParams{
+		Username:       req.GetUsername(),
+		HashedPassword: hashedPassword,
+		FullName:       req.GetFullName(),
+		Email:          req.GetEmail(),
+	})
+	if err != nil {
+		return nil, apiutil.GRPCError(err)
+	}
+	return &pb.CreateUserResponse{User: convertUser(user)}, nil
+}
+
+type loginUserRequest struct {
+	Username string `binding:"required,alphanum"`
+	Password string `binding:"required,min=6"`
+}
+
+//每次登录都是一个新的会话,该会话签发的token都携带会话id
+func (server *Server) LoginUser(ctx context.Context, req *pb.LoginUserRequest) (*pb.LoginUserResponse, error) {
+	if err := apiutil.ValidateStruct(loginUserRequest{
+		Username: req.GetUsername(),
+		Password: req.GetPassword(),
+	}); err != nil {
+		return nil, apiutil.GRPCError(err)
+	}
+
+	user, err := server.store.GetUser(ctx, req.GetUsername())
+	if err != nil {
+		return nil, apiutil.GRPCError(err)
+	}
+	if err := util.CheckPassword(req.GetPassword(), user.HashedPassword); err != nil {
+		return nil, apiutil.GRPCError(err)
+	}
+
+	sessionID, err := uuid.NewRandom()
+	if err != nil {
+		return nil, apiutil.GRPCError(err)
+	}
+	accessToken, accessPayload, err := server.tokenMaker.CreateToken(user.Username, user.Role, sessionID, token.TokenTypeAccess, server.config.AccessTokenDuration)
+	if err != nil {
+		return nil, apiutil.GRPCError(err)
+	}
+	refreshToken, refreshPayload, err := server.tokenMaker.CreateToken(user.Username, user.Role, sessionID, token.TokenTypeRefresh, server.config.RefreshTokenDuration)
+	if err != nil {
+		return nil, apiutil.GRPCError(err)
+	}
+
+	userAgent, clientIP := clientInfo(ctx)
+	session, err := server.store.CreateSession(ctx, db.CreateSessionParams{
+		ID:           sessionID,
+		Username:     user.Username,
+		RefreshToken: refreshToken,
+		UserAgent:    userAgent,
+		ClientIp:     clientIP,
+		IsBlocked:    false,
+		ExpiresAt:    refreshPayload.ExpiredAt,
+	})
+	if err != nil {
+		return nil, apiutil.GRPCError(err)
+	}
+
+	return &pb.LoginUserResponse{
+		SessionId:             session.ID.String(),
+		AccessToken:           accessToken,
+		AccessTokenExpiresAt:  timestamppb.New(accessPayload.ExpiredAt),
+		RefreshToken:          refreshToken,
+		RefreshTokenExpiresAt: timestamppb.New(refreshPayload.ExpiredAt),
+		User:                  convertUser(user),
+	}, nil
+}
+
+type renewAccessTokenRequest struct {
+	RefreshToken string `binding:"required"`
+}
+
+//与HTTP接口的renewAccessToken规则相同:被封禁,不属于该用户,token不一致或已过期的会话都不能再续期
+func (server *Server) RenewAccessToken(ctx context.Context, req *pb.RenewAccessTokenRequest) (*pb.RenewAccessTokenResponse, error) {
+	if err := apiutil.ValidateStruct(renewAccessTokenRequest{RefreshToken: req.GetRefreshToken()}); err != nil {
+		return nil, apiutil.GRPCError(err)
+	}
+
+	refreshPayload, err := server.tokenMaker.VerifyToken(req.GetRefreshToken(), token.TokenTypeRefresh)
+	if err != nil {
+		return nil, unauthenticatedError(err)
+	}
+	session, err := server.store.GetSession(ctx, refreshPayload.SessionID)
+	if err != nil {
+		return nil, apiutil.GRPCError(err)
+	}
+
+	switch {
+	case session.IsBlocked:
+		return nil, unauthenticatedError(errors.New("blocked session"))
+	case session.Username != refreshPayload.Username:
+		return nil, unauthenticatedError(errors.New("incorrect session user"))
+	case session.RefreshToken != req.GetRefreshToken():
+		return nil, unauthenticatedError(errors.New("mismatched session token"))
+	case time.Now().After(session.ExpiresAt):
+		return nil, unauthenticatedError(errors.New("expired session"))
+	}
+
+	//新的access token仍属于同一个会话
+	accessToken, accessPayload, err := server.tokenMaker.CreateToken(
+		refreshPayload.Username,
+		refreshPayload.Role,
+		session.ID,
+		token.TokenTypeAccess,
+		server.config.AccessTokenDuration,
+	)
+	if err != nil {
+		return nil, apiutil.GRPCError(err)
+	}
+	return &pb.RenewAccessTokenResponse{
+		AccessToken:          accessToken,
+		AccessTokenExpiresAt: timestamppb.New(accessPayload.ExpiredAt),
+	}, nil
+}
+
+//封禁当前access token所属的会话,该会话的access token和refresh token都不能再使用
+func (server *Server) LogoutUser(ctx context.Context, req *pb.LogoutUserRequest) (*pb.LogoutUserResponse, error) {
+	if _, err := server.store.BlockSession(ctx, authPayload(ctx).SessionID); err != nil {
+		return nil, apiutil.GRPCError(err)
+	}
+	return &pb.LogoutUserResponse{}, nil
+}
+
+//会话中记录的客户端信息,user agent来自metadata,ip来自连接的对端地址
+func clientInfo(ctx context.Context) (userAgent, clientIP string) {
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get("user-agent"); len(values) > 0 {
+			userAgent = values[0]
+		}
+	}
+	if p, ok := peer.FromContext(ctx); ok {
+		clientIP = p.Addr.String()
+		if host, _, err := net.SplitHostPort(clientIP); err == nil {
+			clientIP = host
+		}
+	}
+	return userAgent, clientIP
+}
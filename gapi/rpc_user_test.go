@@ -0,0 +1,305 @@
+package gapi
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/google/uuid"
+	mockdb "github.com/leilei3167/bank/db/mock"
+	db "github.com/leilei3167/bank/db/sqlc"
+	"github.com/leilei3167/bank/db/util"
+	"github.com/leilei3167/bank/pb"
+	"github.com/leilei3167/bank/token"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestCreateUserRPC(t *testing.T) {
+	username := util.RandOwner()
+	email := util.RandomEmail()
+	//处理器在服务端的goroutine中执行,参数保存下来在客户端检查
+	var created db.CreateUserParams
+
+	testCases := []struct {
+		name          string
+		req           *pb.CreateUserRequest
+		buildStubs    func(store *mockdb.MockStore)
+		checkResponse func(t *testing.T, res *pb.CreateUserResponse, err error)
+	}{
+		{
+			name: "OK",
+			req:  &pb.CreateUserRequest{Username: username, Password: "secret", FullName: "Full Name", Email: email},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().CreateUser(gomock.Any(), gomock.Any()).Times(1).
+					DoAndReturn(func(_ context.Context, arg db.CreateUserParams) (db.User, error) {
+						created = arg
+						return db.User{Username: arg.Username, FullName: arg.FullName, Email: arg.Email, Role: util.DepositorRole}, nil
+					})
+			},
+			checkResponse: func(t *testing.T, res *pb.CreateUserResponse, err error) {
+				require.NoError(t, err)
+				require.Equal(t, username, res.GetUser().GetUsername())
+				require.Equal(t, email, res.GetUser().GetEmail())
+				require.Equal(t, util.DepositorRole, res.GetUser().GetRole())
+				//保存的是哈希后的密码
+				require.NoError(t, util.CheckPassword("secret", created.HashedPassword))
+			},
+		},
+		{
+			name: "InvalidEmail",
+			req:  &pb.CreateUserRequest{Username: username, Password: "secret", FullName: "Full Name", Email: "invalid"},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().CreateUser(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(t *testing.T, res *pb.CreateUserResponse, err error) {
+				require.Equal(t, codes.InvalidArgument, status.Code(err))
+			},
+		},
+		{
+			name: "DuplicateUsername",
+			req:  &pb.CreateUserRequest{Username: username, Password: "secret", FullName: "Full Name", Email: email},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().CreateUser(gomock.Any(), gomock.Any()).Times(1).
+					Return(db.User{}, &pq.Error{Code: "23505"})
+			},
+			checkResponse: func(t *testing.T, res *pb.CreateUserResponse, err error) {
+				require.Equal(t, codes.AlreadyExists, status.Code(err))
+			},
+		},
+		{
+			name: "InternalError",
+			req:  &pb.CreateUserRequest{Username: username, Password: "secret", FullName: "Full Name", Email: email},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().CreateUser(gomock.Any(), gomock.Any()).Times(1).Return(db.User{}, sql.ErrConnDone)
+			},
+			checkResponse: func(t *testing.T, res *pb.CreateUserResponse, err error) {
+				require.Equal(t, codes.Internal, status.Code(err))
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			store := mockdb.NewMockStore(ctrl)
+			tc.buildStubs(store)
+
+			//不需要鉴权,也不会查询会话
+			conn := newTestConn(t, newTestServer(t, store))
+			res, err := pb.NewUserServiceClient(conn).CreateUser(context.Background(), tc.req)
+			tc.checkResponse(t, res, err)
+		})
+	}
+}
+
+func TestLoginUserRPC(t *testing.T) {
+	password := util.RandomString(6)
+	hashedPassword, err := util.HashPassword(password)
+	require.NoError(t, err)
+	user := db.User{Username: util.RandOwner(), HashedPassword: hashedPassword, Role: util.DepositorRole}
+	var session db.CreateSessionParams
+
+	testCases := []struct {
+		name          string
+		req           *pb.LoginUserRequest
+		buildStubs    func(store *mockdb.MockStore)
+		checkResponse func(t *testing.T, server *Server, res *pb.LoginUserResponse, err error)
+	}{
+		{
+			name: "OK",
+			req:  &pb.LoginUserRequest{Username: user.Username, Password: password},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetUser(gomock.Any(), gomock.Eq(user.Username)).Times(1).Return(user, nil)
+				store.EXPECT().CreateSession(gomock.Any(), gomock.Any()).Times(1).
+					DoAndReturn(func(_ context.Context, arg db.CreateSessionParams) (db.Session, error) {
+						session = arg
+						return db.Session{ID: arg.ID, Username: arg.Username, RefreshToken: arg.RefreshToken}, nil
+					})
+			},
+			checkResponse: func(t *testing.T, server *Server, res *pb.LoginUserResponse, err error) {
+				require.NoError(t, err)
+				payload, err := server.tokenMaker.VerifyToken(res.GetAccessToken(), token.TokenTypeAccess)
+				require.NoError(t, err)
+				require.Equal(t, user.Username, payload.Username)
+				require.Equal(t, payload.SessionID.String(), res.GetSessionId())
+				//客户端的user agent由grpc-go设置
+				require.Contains(t, session.UserAgent, "grpc-go")
+				require.NotEmpty(t, session.ClientIp)
+			},
+		},
+		{
+			name: "UserNotFound",
+			req:  &pb.LoginUserRequest{Username: user.Username, Password: password},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetUser(gomock.Any(), gomock.Any()).Times(1).Return(db.User{}, sql.ErrNoRows)
+				store.EXPECT().CreateSession(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(t *testing.T, server *Server, res *pb.LoginUserResponse, err error) {
+				require.Equal(t, codes.NotFound, status.Code(err))
+			},
+		},
+		{
+			name: "IncorrectPassword",
+			req:  &pb.LoginUserRequest{Username: user.Username, Password: "incorrect"},
+			buildStubs: func(store *mockdb.MockStore) {
+				store.EXPECT().GetUser(gomock.Any(), gomock.Any()).Times(1).Return(user, nil)
+				store.EXPECT().CreateSession(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(t *testing.T, server *Server, res *pb.LoginUserResponse, err error) {
+				require.Equal(t, codes.Unauthenticated, status.Code(err))
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			store := mockdb.NewMockStore(ctrl)
+			tc.buildStubs(store)
+
+			server := newTestServer(t, store)
+			conn := newTestConn(t, server)
+			res, err := pb.NewUserServiceClient(conn).LoginUser(context.Background(), tc.req)
+			tc.checkResponse(t, server, res, err)
+		})
+	}
+}
+
+func TestRenewAccessTokenRPC(t *testing.T) {
+	username := util.RandOwner()
+
+	//生成一个有效的refresh token以及与之匹配的会话
+	validSession := func(t *testing.T, tokenMaker token.Maker) (string, db.Session) {
+		refreshToken, payload, err := tokenMaker.CreateToken(username, util.DepositorRole, uuid.New(), token.TokenTypeRefresh, time.Hour)
+		require.NoError(t, err)
+		return refreshToken, db.Session{
+			ID:           payload.SessionID,
+			Username:     username,
+			RefreshToken: refreshToken,
+			ExpiresAt:    payload.ExpiredAt,
+		}
+	}
+
+	testCases := []struct {
+		name          string
+		buildSession  func(t *testing.T, tokenMaker token.Maker) (string, db.Session)
+		buildStubs    func(store *mockdb.MockStore, session db.Session)
+		checkResponse func(t *testing.T, server *Server, res *pb.RenewAccessTokenResponse, err error)
+	}{
+		{
+			name:         "OK",
+			buildSession: validSession,
+			buildStubs: func(store *mockdb.MockStore, session db.Session) {
+				store.EXPECT().GetSession(gomock.Any(), gomock.Eq(session.ID)).Times(1).Return(session, nil)
+			},
+			checkResponse: func(t *testing.T, server *Server, res *pb.RenewAccessTokenResponse, err error) {
+				require.NoError(t, err)
+				payload, err := server.tokenMaker.VerifyToken(res.GetAccessToken(), token.TokenTypeAccess)
+				require.NoError(t, err)
+				require.Equal(t, username, payload.Username)
+			},
+		},
+		{
+			name: "AccessToken",
+			buildSession: func(t *testing.T, tokenMaker token.Maker) (string, db.Session) {
+				accessToken, _, err := tokenMaker.CreateToken(username, util.DepositorRole, uuid.New(), token.TokenTypeAccess, time.Hour)
+				require.NoError(t, err)
+				return accessToken, db.Session{}
+			},
+			buildStubs: func(store *mockdb.MockStore, session db.Session) {
+				store.EXPECT().GetSession(gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(t *testing.T, server *Server, res *pb.RenewAccessTokenResponse, err error) {
+				require.Equal(t, codes.Unauthenticated, status.Code(err))
+			},
+		},
+		{
+			name: "BlockedSession",
+			buildSession: func(t *testing.T, tokenMaker token.Maker) (string, db.Session) {
+				refreshToken, session := validSession(t, tokenMaker)
+				session.IsBlocked = true
+				return refreshToken, session
+			},
+			buildStubs: func(store *mockdb.MockStore, session db.Session) {
+				store.EXPECT().GetSession(gomock.Any(), gomock.Eq(session.ID)).Times(1).Return(session, nil)
+			},
+			checkResponse: func(t *testing.T, server *Server, res *pb.RenewAccessTokenResponse, err error) {
+				require.Equal(t, codes.Unauthenticated, status.Code(err))
+			},
+		},
+		{
+			name: "MismatchedToken",
+			buildSession: func(t *testing.T, tokenMaker token.Maker) (string, db.Session) {
+				refreshToken, session := validSession(t, tokenMaker)
+				session.RefreshToken = "another token"
+				return refreshToken, session
+			},
+			buildStubs: func(store *mockdb.MockStore, session db.Session) {
+				store.EXPECT().GetSession(gomock.Any(), gomock.Eq(session.ID)).Times(1).Return(session, nil)
+			},
+			checkResponse: func(t *testing.T, server *Server, res *pb.RenewAccessTokenResponse, err error) {
+				require.Equal(t, codes.Unauthenticated, status.Code(err))
+			},
+		},
+		{
+			name:         "SessionNotFound",
+			buildSession: validSession,
+			buildStubs: func(store *mockdb.MockStore, session db.Session) {
+				store.EXPECT().GetSession(gomock.Any(), gomock.Any()).Times(1).Return(db.Session{}, sql.ErrNoRows)
+			},
+			checkResponse: func(t *testing.T, server *Server, res *pb.RenewAccessTokenResponse, err error) {
+				require.Equal(t, codes.NotFound, status.Code(err))
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			store := mockdb.NewMockStore(ctrl)
+			server := newTestServer(t, store)
+			refreshToken, session := tc.buildSession(t, server.tokenMaker)
+			tc.buildStubs(store, session)
+
+			conn := newTestConn(t, server)
+			res, err := pb.NewUserServiceClient(conn).RenewAccessToken(context.Background(), &pb.RenewAccessTokenRequest{RefreshToken: refreshToken})
+			tc.checkResponse(t, server, res, err)
+		})
+	}
+}
+
+func TestLogoutUserRPC(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	store := mockdb.NewMockStore(ctrl)
+	stubActiveSession(store)
+	store.EXPECT().BlockSession(gomock.Any(), gomock.Any()).Times(1).Return(db.Session{IsBlocked: true}, nil)
+
+	server := newTestServer(t, store)
+	client := pb.NewUserServiceClient(newTestConn(t, server))
+
+	_, err := client.LogoutUser(newContextWithBearerToken(t, server.tokenMaker, util.RandOwner(), util.DepositorRole), &pb.LogoutUserRequest{})
+	require.NoError(t, err)
+
+	//退出登录需要鉴权
+	_, err = client.LogoutUser(context.Background(), &pb.LogoutUserRequest{})
+	require.Equal(t, codes.Unauthenticated, status.Code(err))
+}
@@ -0,0 +1,77 @@
+package gapi
+
+import (
+	"context"
+	"fmt"
+	"net"
+
+	db "github.com/leilei3167/bank/db/sqlc"
+	"github.com/leilei3167/bank/db/util"
+	"github.com/leilei3167/bank/pb"
+	"github.com/leilei3167/bank/token"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/reflection"
+)
+
+//gRPC接口,与api包中的HTTP接口共用同一个store,处理逻辑和状态码与HTTP接口保持一致
+type Server struct {
+	pb.UnimplementedUserServiceServer
+	pb.UnimplementedAccountServiceServer
+	pb.UnimplementedTransferServiceServer
+	config     util.Config
+	store      db.Store
+	tokenMaker token.Maker
+	grpcServer *grpc.Server
+}
+
+func NewServer(config util.Config, store db.Store) (*Server, error) {
+	tokenMaker, err := token.NewPasetoMaker(config.TokenSymmetricKey)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create token maker: %w", err)
+	}
+
+	server := &Server{
+		config:     config,
+		store:      store,
+		tokenMaker: tokenMaker,
+	}
+	//日志在最外层,鉴权失败的请求同样会被记录
+	server.grpcServer = grpc.NewServer(grpc.ChainUnaryInterceptor(requestLogger, server.authInterceptor))
+	pb.RegisterUserServiceServer(server.grpcServer, server)
+	pb.RegisterAccountServiceServer(server.grpcServer, server)
+	pb.RegisterTransferServiceServer(server.grpcServer, server)
+	//方便用grpcurl等工具调试
+	reflection.Register(server.grpcServer)
+	return server, nil
+}
+
+//在指定地址开启服务,阻塞直到服务出错或者被Shutdown关闭,被关闭时返回nil
+func (server *Server) Start(addr string) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return server.Serve(listener)
+}
+
+//在已经监听的listener上开启服务,测试时可以监听随机端口
+func (server *Server) Serve(listener net.Listener) error {
+	return server.grpcServer.Serve(listener)
+}
+
+//优雅关闭:停止接受新的请求,等待正在处理的请求完成,ctx到期时强制关闭所有连接
+func (server *Server) Shutdown(ctx context.Context) error {
+	stopped := make(chan struct{})
+	go func() {
+		server.grpcServer.GracefulStop()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+		return nil
+	case <-ctx.Done():
+		server.grpcServer.Stop()
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,90 @@
+package logger
+
+import (
+	"context"
+	"io"
+	"os"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+//请求ID在context中的键
+//gin1.7的Context.Value只会用string类型的键去c.Keys中取值,所以这里不能使用自定义类型的键,
+//这样处理器把*gin.Context直接传给store时也能取到请求ID
+const RequestIDKey = "request_id"
+
+//后台任务名在context中的键,和请求ID一样使用string类型
+const WorkerKey = "worker"
+
+//日志的输出格式
+const (
+	FormatJSON    = "json"
+	FormatConsole = "console"
+)
+
+//按照配置创建日志,format为console时输出便于阅读的彩色文本,否则输出JSON,level为空时使用info
+func New(w io.Writer, format, level string) (zerolog.Logger, error) {
+	lvl := zerolog.InfoLevel
+	if level != "" {
+		var err error
+		lvl, err = zerolog.ParseLevel(level)
+		if err != nil {
+			return zerolog.Logger{}, err
+		}
+	}
+	if format == FormatConsole {
+		w = zerolog.ConsoleWriter{Out: w, TimeFormat: time.RFC3339}
+	}
+	return zerolog.New(w).Level(lvl).With().Timestamp().Logger(), nil
+}
+
+//创建日志并设置为全局日志,没有ctx的地方(如main)直接使用全局日志
+//和标准库的log一样输出到标准错误,标准输出留给命令行子命令的结果
+func Setup(format, level string) error {
+	l, err := New(os.Stderr, format, level)
+	if err != nil {
+		return err
+	}
+	log.Logger = l
+	return nil
+}
+
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, RequestIDKey, requestID)
+}
+
+//没有请求ID时返回空字符串
+func RequestID(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	requestID, _ := ctx.Value(RequestIDKey).(string)
+	return requestID
+}
+
+func WithWorker(ctx context.Context, name string) context.Context {
+	return context.WithValue(ctx, WorkerKey, name)
+}
+
+//不在后台任务中时返回空字符串
+func Worker(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	name, _ := ctx.Value(WorkerKey).(string)
+	return name
+}
+
+//返回带有请求ID和后台任务名的日志,ctx中都没有时返回全局日志
+func Ctx(ctx context.Context) *zerolog.Logger {
+	l := log.Logger
+	if requestID := RequestID(ctx); requestID != "" {
+		l = l.With().Str(RequestIDKey, requestID).Logger()
+	}
+	if name := Worker(ctx); name != "" {
+		l = l.With().Str(WorkerKey, name).Logger()
+	}
+	return &l
+}
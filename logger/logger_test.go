@@ -0,0 +1,71 @@
+package logger
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/rs/zerolog/log"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNew(t *testing.T) {
+	var buf bytes.Buffer
+	l, err := New(&buf, FormatJSON, "warn")
+	require.NoError(t, err)
+
+	l.Info().Msg("ignored")
+	require.Zero(t, buf.Len())
+
+	l.Warn().Int64("account_id", 1).Msg("hello")
+	var line map[string]interface{}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &line))
+	require.Equal(t, "hello", line["message"])
+	require.Equal(t, "warn", line["level"])
+	require.EqualValues(t, 1, line["account_id"])
+
+	//控制台格式不是JSON
+	buf.Reset()
+	l, err = New(&buf, FormatConsole, "")
+	require.NoError(t, err)
+	l.Info().Msg("hello")
+	require.Contains(t, buf.String(), "hello")
+	require.Error(t, json.Unmarshal(buf.Bytes(), &line))
+
+	_, err = New(&buf, FormatJSON, "verbose")
+	require.Error(t, err)
+}
+
+func TestCtx(t *testing.T) {
+	var buf bytes.Buffer
+	global := log.Logger
+	defer func() { log.Logger = global }()
+	log.Logger, _ = New(&buf, FormatJSON, "debug")
+
+	ctx := WithRequestID(context.Background(), "req-1")
+	require.Equal(t, "req-1", RequestID(ctx))
+	Ctx(ctx).Info().Msg("with id")
+
+	var line map[string]interface{}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &line))
+	require.Equal(t, "req-1", line[RequestIDKey])
+
+	//没有请求ID时不带该字段
+	buf.Reset()
+	require.Empty(t, RequestID(context.Background()))
+	Ctx(context.Background()).Info().Msg("without id")
+	line = nil
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &line))
+	require.NotContains(t, line, RequestIDKey)
+	require.NotContains(t, line, WorkerKey)
+
+	//后台任务的日志带有任务名
+	buf.Reset()
+	ctx = WithWorker(context.Background(), "reconciler")
+	require.Equal(t, "reconciler", Worker(ctx))
+	Ctx(ctx).Info().Msg("in worker")
+	line = nil
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &line))
+	require.Equal(t, "reconciler", line[WorkerKey])
+}
@@ -1,13 +1,27 @@
 package main
 
 import (
+	"context"
 	"database/sql"
+	"encoding/json"
+	"flag"
+	"fmt"
 	"github.com/leilei3167/bank/db/util"
-	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/leilei3167/bank/api"
 	db "github.com/leilei3167/bank/db/sqlc"
+	"github.com/leilei3167/bank/gapi"
+	"github.com/leilei3167/bank/logger"
+	"github.com/leilei3167/bank/metrics"
+	"github.com/leilei3167/bank/tracing"
+	"github.com/leilei3167/bank/worker"
 	_ "github.com/lib/pq"
+	"github.com/rs/zerolog/log"
 )
 
 /*const (
@@ -16,21 +30,207 @@ import (
 	serverAddr = "0.0.0.0:8080"
 )*/
 
+//没有配置SHUTDOWN_TIMEOUT时等待正在处理的请求完成的时间
+const defaultShutdownTimeout = 30 * time.Second
+
+//没有配置CURRENCY_SYNC_INTERVAL时刷新货币注册表的间隔
+const defaultCurrencySyncInterval = 30 * time.Second
+
 func main() {
 	//先连接数据库
 	config, err := util.LoadConfig(".") //"."代表当前文件夹
 	if err != nil {
-		log.Fatal("读取配置文件失败!", err)
+		log.Fatal().Err(err).Msg("读取配置文件失败")
+	}
+	if err := logger.Setup(config.LogFormat, config.LogLevel); err != nil {
+		log.Fatal().Err(err).Msg("无法创建日志")
 	}
 	conn, err := sql.Open(config.DBDriver, config.DBSource)
 	if err != nil {
-		log.Fatal("无法链接到数据库:", err)
+		log.Fatal().Err(err).Msg("无法链接到数据库")
+	}
+	store := tracing.TraceStore(metrics.InstrumentStore(db.NewStore(conn,
+		db.WithQueryObserver(metrics.ObserveQuery),
+		db.WithQueryTracer(tracing.TraceQuery),
+		db.WithTxRetryHook(func(ctx context.Context, attempt int, err error) {
+			metrics.ObserveTxRetry(ctx, attempt, err)
+			tracing.TraceTxRetry(ctx, attempt, err)
+		}),
+	)))
+	if err := metrics.RegisterDBStats(conn, "bank"); err != nil {
+		log.Fatal().Err(err).Msg("无法注册连接池指标")
+	}
+	//sql.Open不会真正建立连接,启动时先确认数据库可以访问
+	if err := checkDatabase(store, config); err != nil {
+		log.Fatal().Err(err).Msg("无法链接到数据库")
+	}
+
+	//子命令,不启动web服务
+	if len(os.Args) > 1 && os.Args[1] == "reconcile" {
+		runReconcile(store, config, os.Args[2:])
+		return
+	}
+
+	shutdownTracing, err := tracing.Setup(context.Background(), config.TraceExporter, config.OTLPEndpoint, os.Stdout)
+	if err != nil {
+		log.Fatal().Err(err).Msg("无法创建链路追踪")
 	}
+
 	//构建Server
-	store := db.NewStore(conn)
-	server := api.NewServer(store)
-	err = server.Start(config.ServerAdress)
+	server, err := api.NewServer(config, store)
+	if err != nil {
+		log.Fatal().Err(err).Msg("无法创建web服务")
+	}
+	//支持的货币以数据库为准
+	if err := worker.SyncCurrencies(context.Background(), store); err != nil {
+		log.Fatal().Err(err).Msg("无法加载货币")
+	}
+	workers := worker.NewGroup()
+	server.SetWorkers(workers)
+	//其他实例启用或禁用货币后,本实例定期刷新
+	workers.Go("currency-syncer", worker.NewCurrencySyncer(store, util.DurationOrDefault(config.CurrencySyncInterval, defaultCurrencySyncInterval)).Run)
+	//后台定期对账
+	if config.ReconcileInterval > 0 {
+		workers.Go("reconciler", worker.NewReconciler(store, config.ReconcileInterval, config.ReconcileBatchSize).Run)
+	}
+	//执行到期的定时转账
+	if config.SchedulerInterval > 0 {
+		workers.Go("scheduler", worker.NewScheduler(store, config.SchedulerInterval).Run)
+	}
+
+	//收到SIGINT或SIGTERM后开始优雅关闭
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	//gRPC服务和web服务共用同一个store,任何一个启动失败都退出
+	var grpcServer *gapi.Server
+	if config.GRPCServerAddress != "" {
+		grpcServer, err = gapi.NewServer(config, store)
+		if err != nil {
+			log.Fatal().Err(err).Msg("无法创建gRPC服务")
+		}
+	}
+
+	//指标在单独的内部端口上提供,不和客户访问的接口共用端口
+	var metricsServer *http.Server
+	if config.MetricsAddress != "" {
+		metricsServer = metrics.NewServer(config.MetricsAddress)
+	}
+
+	serveErr := make(chan error, 3)
+	go func() {
+		log.Info().Str("address", config.ServerAdress).Msg("web服务启动")
+		if err := server.Start(config.ServerAdress); err != nil {
+			serveErr <- fmt.Errorf("web服务: %w", err)
+		}
+	}()
+	if grpcServer != nil {
+		go func() {
+			log.Info().Str("address", config.GRPCServerAddress).Msg("gRPC服务启动")
+			if err := grpcServer.Start(config.GRPCServerAddress); err != nil {
+				serveErr <- fmt.Errorf("gRPC服务: %w", err)
+			}
+		}()
+	}
+
+	if metricsServer != nil {
+		go func() {
+			log.Info().Str("address", config.MetricsAddress).Msg("指标服务启动")
+			if err := metricsServer.ListenAndServe(); err != http.ErrServerClosed {
+				serveErr <- fmt.Errorf("指标服务: %w", err)
+			}
+		}()
+	}
+
+	exitCode := 0
+	select {
+	case err := <-serveErr:
+		log.Error().Err(err).Msg("服务异常退出")
+		exitCode = 1
+	case <-ctx.Done():
+		//恢复信号的默认处理,关闭过程中再次收到信号时直接退出
+		stop()
+		log.Info().Msg("开始关闭服务,等待正在处理的请求完成")
+	}
+
+	//所有服务共用同一个关闭期限,没有配置时不能为0,否则所有正在处理的请求都会被立即中断
+	shutdownTimeout := util.DurationOrDefault(config.ShutdownTimeout, defaultShutdownTimeout)
+	//web服务先等待SHUTDOWN_GRACE_PERIOD再停止接受连接,这段时间不占用处理请求的期限
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), config.ShutdownGracePeriod+shutdownTimeout)
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Error().Err(err).Msg("web服务未能在期限内处理完所有请求")
+		exitCode = 1
+	}
+	if grpcServer != nil {
+		if err := grpcServer.Shutdown(shutdownCtx); err != nil {
+			log.Error().Err(err).Msg("gRPC服务未能在期限内处理完所有请求")
+			exitCode = 1
+		}
+	}
+	//指标服务最后关闭,关闭过程中仍然可以被抓取
+	if metricsServer != nil {
+		if err := metricsServer.Shutdown(shutdownCtx); err != nil {
+			log.Error().Err(err).Msg("关闭指标服务失败")
+		}
+	}
+	cancel()
+
+	//请求处理完之后再停止后台任务,正在执行的定时转账和对账在期限内提交,到期时回滚,然后关闭连接池
+	stopCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	if err := workers.Stop(stopCtx); err != nil {
+		log.Error().Err(err).Msg("后台任务未能在期限内完成,未完成的事务已回滚")
+		exitCode = 1
+	}
+	cancel()
+	if err := conn.Close(); err != nil {
+		log.Error().Err(err).Msg("关闭数据库连接失败")
+	}
+	//发送还没有导出的span
+	flushCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	if err := shutdownTracing(flushCtx); err != nil {
+		log.Error().Err(err).Msg("导出链路追踪数据失败")
+	}
+	cancel()
+	log.Info().Msg("服务已关闭")
+	os.Exit(exitCode)
+}
+
+//数据库无法访问时返回错误;迁移版本不一致只记录警告,就绪检查会一直失败直到执行完迁移
+func checkDatabase(store db.Store, config util.Config) error {
+	ctx, cancel := context.WithTimeout(context.Background(), util.DurationOrDefault(config.HealthCheckTimeout, 5*time.Second))
+	defer cancel()
+
+	if err := store.Ping(ctx); err != nil {
+		return err
+	}
+	version, err := store.GetMigrationVersion(ctx)
+	if err == nil {
+		err = version.Check()
+	}
+	if err != nil {
+		log.Warn().Err(err).Msg("数据库迁移版本不一致")
+	}
+	return nil
+}
+
+//bank reconcile [-batch-size n]
+//执行一次对账,报告以JSON格式输出到标准输出,发现不一致时退出码为1
+func runReconcile(store db.Store, config util.Config, args []string) {
+	flags := flag.NewFlagSet("reconcile", flag.ExitOnError)
+	batchSize := flags.Int("batch-size", int(config.ReconcileBatchSize), "每批扫描的行数")
+	flags.Parse(args)
+
+	report, err := store.ReconcileLedger(context.Background(), db.ReconcileParams{BatchSize: int32(*batchSize)})
 	if err != nil {
-		log.Fatal("无法启动web服务:", err)
+		log.Fatal().Err(err).Msg("对账失败")
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(report); err != nil {
+		log.Fatal().Err(err).Msg("无法输出对账报告")
+	}
+	if report.HasDrift() {
+		os.Exit(1)
 	}
 }
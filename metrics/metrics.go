@@ -0,0 +1,205 @@
+package metrics
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	db "github.com/leilei3167/bank/db/sqlc"
+	"github.com/leilei3167/bank/db/util"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+//所有指标的前缀
+const namespace = "bank"
+
+var (
+	httpRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "request_duration_seconds",
+		Help:      "HTTP request latency by route and status.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+
+	queryDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "store",
+		Name:      "query_duration_seconds",
+		Help:      "Latency of each Querier method, including queries run inside transactions.",
+		Buckets:   []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1},
+	}, []string{"query"})
+
+	queriesTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "store",
+		Name:      "queries_total",
+		Help:      "Number of Querier method calls by outcome.",
+	}, []string{"query", "outcome"})
+
+	txRetriesTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "store",
+		Name:      "tx_retries_total",
+		Help:      "Number of transactions retried after a serialization failure or deadlock.",
+	})
+
+	transferTxDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "store",
+		Name:      "transfer_tx_duration_seconds",
+		Help:      "Latency of transfer, scheduled transfer and reversal transactions by outcome.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"outcome"})
+
+	transfersTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "transfers_total",
+		Help:      "Number of completed transfers, including scheduled transfers and reversals, by source currency.",
+	}, []string{"currency"})
+
+	transferAmountTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "transfer_amount_total",
+		Help:      "Sum of completed transfer amounts in minor units of the source currency.",
+	}, []string{"currency"})
+)
+
+//转账的结果,用作outcome标签
+const (
+	OutcomeSuccess  = "success"
+	OutcomeReplayed = "replayed"
+	OutcomeError    = "error"
+	OutcomeRejected = "rejected" //定时转账因为客户的问题记录为失败的执行
+)
+
+//在请求结束后记录,route为路由模板(如/accounts/:id),没有匹配的路由时为空
+func ObserveHTTPRequest(method, route string, status int, duration time.Duration) {
+	if route == "" {
+		route = "unmatched"
+	}
+	httpRequestDuration.WithLabelValues(method, route, strconv.Itoa(status)).Observe(duration.Seconds())
+}
+
+//用作db.WithQueryObserver的回调
+func ObserveQuery(_ context.Context, name string, duration time.Duration, err error) {
+	outcome := OutcomeSuccess
+	if err != nil {
+		outcome = OutcomeError
+	}
+	queryDuration.WithLabelValues(name).Observe(duration.Seconds())
+	queriesTotal.WithLabelValues(name, outcome).Inc()
+}
+
+//用作db.WithTxRetryHook的回调
+func ObserveTxRetry(_ context.Context, _ int, _ error) {
+	txRetriesTotal.Inc()
+}
+
+//注册连接池的统计,包括打开、使用中、空闲的连接数和等待连接的次数,name作为db_name标签
+func RegisterDBStats(conn *sql.DB, name string) error {
+	return prometheus.Register(collectors.NewDBStatsCollector(conn, name))
+}
+
+//只提供/metrics的内部服务,和面向客户的端口分开监听,不对外暴露也不需要鉴权
+func NewServer(addr string) *http.Server {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+	return &http.Server{
+		Addr:              addr,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+}
+
+//客户的问题使用各自的标签,方便区分异常的失败
+func transferOutcome(err error) string {
+	switch {
+	case err == nil:
+		return OutcomeSuccess
+	case errors.Is(err, db.ErrInsufficientBalance):
+		return "insufficient_balance"
+	case errors.Is(err, db.ErrAccountFrozen):
+		return "account_frozen"
+	case errors.Is(err, db.ErrExchangeRateNotFound):
+		return "exchange_rate_not_found"
+	case errors.Is(err, util.ErrConvertedAmountZero):
+		return "amount_too_small"
+	case errors.Is(err, db.ErrIdempotencyKeyReused):
+		return "idempotency_key_reused"
+	case errors.Is(err, db.ErrTransferAlreadyReversed),
+		errors.Is(err, db.ErrRefundExceedsAmount),
+		errors.Is(err, db.ErrReverseReversal):
+		return "invalid_reversal"
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return "canceled"
+	}
+	return OutcomeError
+}
+
+func observeTransfer(result db.TransferTxResult, outcome string, duration time.Duration) {
+	transferTxDuration.WithLabelValues(outcome).Observe(duration.Seconds())
+	if outcome != OutcomeSuccess {
+		return
+	}
+	currency := result.FromAccount.Currency
+	transfersTotal.WithLabelValues(currency).Inc()
+	transferAmountTotal.WithLabelValues(currency).Add(float64(result.Transfer.Amount))
+}
+
+//在Store之外统计转账的结果和金额,其他方法直接交给内嵌的Store
+type instrumentedStore struct {
+	db.Store
+}
+
+func InstrumentStore(store db.Store) db.Store {
+	return instrumentedStore{Store: store}
+}
+
+func (s instrumentedStore) TransferTx(ctx context.Context, arg db.TransferTxParams) (db.TransferTxResult, error) {
+	start := time.Now()
+	result, err := s.Store.TransferTx(ctx, arg)
+	observeTransfer(result, transferOutcome(err), time.Since(start))
+	return result, err
+}
+
+//重放之前的结果不算作新的转账
+func (s instrumentedStore) IdempotentTransferTx(ctx context.Context, arg db.IdempotentTransferTxParams) (db.IdempotentTransferTxResult, error) {
+	start := time.Now()
+	result, err := s.Store.IdempotentTransferTx(ctx, arg)
+	outcome := transferOutcome(err)
+	if err == nil && result.Replayed {
+		outcome = OutcomeReplayed
+	}
+	observeTransfer(result.TransferTxResult, outcome, time.Since(start))
+	return result, err
+}
+
+//没有到期的定时转账时不记录,客户的问题记录为失败的执行,使用rejected标签
+func (s instrumentedStore) RunScheduledTransferTx(ctx context.Context, now time.Time) (db.RunScheduledTransferResult, error) {
+	start := time.Now()
+	result, err := s.Store.RunScheduledTransferTx(ctx, now)
+	if errors.Is(err, sql.ErrNoRows) && result.Scheduled.ID == 0 {
+		return result, err
+	}
+	outcome := transferOutcome(err)
+	if err == nil && result.Run.Status == db.ScheduledRunFailed {
+		outcome = OutcomeRejected
+	}
+	observeTransfer(result.Transfer, outcome, time.Since(start))
+	return result, err
+}
+
+//冲正是从原转入方转出的新转账,按原转入方的货币统计
+func (s instrumentedStore) ReverseTransferTx(ctx context.Context, arg db.ReverseTransferTxParams) (db.ReverseTransferTxResult, error) {
+	start := time.Now()
+	result, err := s.Store.ReverseTransferTx(ctx, arg)
+	observeTransfer(result.TransferTxResult, transferOutcome(err), time.Since(start))
+	return result, err
+}
@@ -0,0 +1,131 @@
+package metrics
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	mockdb "github.com/leilei3167/bank/db/mock"
+	db "github.com/leilei3167/bank/db/sqlc"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInstrumentStore(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	store := mockdb.NewMockStore(ctrl)
+	instrumented := InstrumentStore(store)
+
+	result := db.TransferTxResult{
+		Transfer:    db.Transfer{ID: 1, Amount: 250},
+		FromAccount: db.Account{ID: 1, Currency: "JPY"},
+	}
+	transfers := testutil.ToFloat64(transfersTotal.WithLabelValues("JPY"))
+	amount := testutil.ToFloat64(transferAmountTotal.WithLabelValues("JPY"))
+
+	//成功的转账计入次数和金额
+	store.EXPECT().TransferTx(gomock.Any(), gomock.Any()).Return(result, nil)
+	_, err := instrumented.TransferTx(context.Background(), db.TransferTxParams{})
+	require.NoError(t, err)
+	require.Equal(t, transfers+1, testutil.ToFloat64(transfersTotal.WithLabelValues("JPY")))
+	require.Equal(t, amount+250, testutil.ToFloat64(transferAmountTotal.WithLabelValues("JPY")))
+
+	//失败的转账只记录耗时
+	store.EXPECT().TransferTx(gomock.Any(), gomock.Any()).Return(db.TransferTxResult{}, db.ErrInsufficientBalance)
+	_, err = instrumented.TransferTx(context.Background(), db.TransferTxParams{})
+	require.ErrorIs(t, err, db.ErrInsufficientBalance)
+	require.Equal(t, transfers+1, testutil.ToFloat64(transfersTotal.WithLabelValues("JPY")))
+
+	//重放之前的结果不算作新的转账
+	store.EXPECT().IdempotentTransferTx(gomock.Any(), gomock.Any()).
+		Return(db.IdempotentTransferTxResult{TransferTxResult: result, Replayed: true}, nil)
+	_, err = instrumented.IdempotentTransferTx(context.Background(), db.IdempotentTransferTxParams{})
+	require.NoError(t, err)
+	require.Equal(t, transfers+1, testutil.ToFloat64(transfersTotal.WithLabelValues("JPY")))
+	require.Equal(t, amount+250, testutil.ToFloat64(transferAmountTotal.WithLabelValues("JPY")))
+
+	//定时转账和冲正同样计入转账的次数和金额
+	store.EXPECT().RunScheduledTransferTx(gomock.Any(), gomock.Any()).
+		Return(db.RunScheduledTransferResult{Run: db.ScheduledTransferRun{Status: db.ScheduledRunSucceeded}, Transfer: result}, nil)
+	_, err = instrumented.RunScheduledTransferTx(context.Background(), time.Now())
+	require.NoError(t, err)
+	store.EXPECT().ReverseTransferTx(gomock.Any(), gomock.Any()).
+		Return(db.ReverseTransferTxResult{TransferTxResult: result}, nil)
+	_, err = instrumented.ReverseTransferTx(context.Background(), db.ReverseTransferTxParams{})
+	require.NoError(t, err)
+	require.Equal(t, transfers+3, testutil.ToFloat64(transfersTotal.WithLabelValues("JPY")))
+	require.Equal(t, amount+750, testutil.ToFloat64(transferAmountTotal.WithLabelValues("JPY")))
+
+	//失败的执行和没有到期的转账都不计入
+	store.EXPECT().RunScheduledTransferTx(gomock.Any(), gomock.Any()).
+		Return(db.RunScheduledTransferResult{Run: db.ScheduledTransferRun{Status: db.ScheduledRunFailed}}, nil)
+	_, err = instrumented.RunScheduledTransferTx(context.Background(), time.Now())
+	require.NoError(t, err)
+	store.EXPECT().RunScheduledTransferTx(gomock.Any(), gomock.Any()).
+		Return(db.RunScheduledTransferResult{}, sql.ErrNoRows)
+	_, err = instrumented.RunScheduledTransferTx(context.Background(), time.Now())
+	require.ErrorIs(t, err, sql.ErrNoRows)
+	require.Equal(t, transfers+3, testutil.ToFloat64(transfersTotal.WithLabelValues("JPY")))
+
+	//其他方法直接交给内嵌的Store
+	store.EXPECT().GetAccount(gomock.Any(), int64(1)).Return(result.FromAccount, nil)
+	account, err := instrumented.GetAccount(context.Background(), 1)
+	require.NoError(t, err)
+	require.Equal(t, result.FromAccount, account)
+}
+
+func TestTransferOutcome(t *testing.T) {
+	testCases := []struct {
+		err     error
+		outcome string
+	}{
+		{nil, OutcomeSuccess},
+		{db.ErrInsufficientBalance, "insufficient_balance"},
+		{db.ErrExchangeRateNotFound, "exchange_rate_not_found"},
+		{db.ErrAccountFrozen, "account_frozen"},
+		{db.ErrIdempotencyKeyReused, "idempotency_key_reused"},
+		{db.ErrRefundExceedsAmount, "invalid_reversal"},
+		{context.DeadlineExceeded, "canceled"},
+		{errors.New("connection refused"), OutcomeError},
+	}
+
+	for _, tc := range testCases {
+		require.Equal(t, tc.outcome, transferOutcome(tc.err))
+	}
+}
+
+func TestObserveQuery(t *testing.T) {
+	succeeded := testutil.ToFloat64(queriesTotal.WithLabelValues("GetAccount", OutcomeSuccess))
+	failed := testutil.ToFloat64(queriesTotal.WithLabelValues("GetAccount", OutcomeError))
+
+	ObserveQuery(context.Background(), "GetAccount", time.Millisecond, nil)
+	ObserveQuery(context.Background(), "GetAccount", time.Millisecond, errors.New("bad connection"))
+
+	require.Equal(t, succeeded+1, testutil.ToFloat64(queriesTotal.WithLabelValues("GetAccount", OutcomeSuccess)))
+	require.Equal(t, failed+1, testutil.ToFloat64(queriesTotal.WithLabelValues("GetAccount", OutcomeError)))
+}
+
+func TestMetricsServer(t *testing.T) {
+	ObserveQuery(context.Background(), "GetAccount", time.Millisecond, nil)
+
+	recorder := httptest.NewRecorder()
+	request, err := http.NewRequest(http.MethodGet, "/metrics", nil)
+	require.NoError(t, err)
+	NewServer("127.0.0.1:0").Handler.ServeHTTP(recorder, request)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	require.Contains(t, recorder.Body.String(), `bank_store_queries_total{outcome="success",query="GetAccount"}`)
+
+	//只提供指标,不转发到其他接口
+	recorder = httptest.NewRecorder()
+	request, err = http.NewRequest(http.MethodGet, "/accounts", nil)
+	require.NoError(t, err)
+	NewServer("127.0.0.1:0").Handler.ServeHTTP(recorder, request)
+	require.Equal(t, http.StatusNotFound, recorder.Code)
+}
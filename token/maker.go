@@ -0,0 +1,15 @@
+package token
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+//Maker 用于管理token的接口,方便在JWT和PASETO之间切换
+type Maker interface {
+	//为指定用户的会话创建一个有期限的指定类型的token,同时返回其负载(包含token id和过期时间)
+	CreateToken(username string, role string, sessionID uuid.UUID, tokenType TokenType, duration time.Duration) (string, *Payload, error)
+	//验证token是否有效并且是指定的类型,有效则返回其中的负载
+	VerifyToken(token string, tokenType TokenType) (*Payload, error)
+}
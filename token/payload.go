@@ -0,0 +1,69 @@
+package token
+
+import (
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+//token验证时可能返回的错误
+var (
+	ErrInvalidToken = errors.New("token is invalid")
+	ErrExpiredToken = errors.New("token has expired")
+)
+
+//TokenType 区分access token和refresh token,两者不能混用
+//否则泄露的refresh token在整个有效期内都能当作access token访问接口
+type TokenType string
+
+const (
+	TokenTypeAccess  TokenType = "access"
+	TokenTypeRefresh TokenType = "refresh"
+)
+
+//Payload 是token中携带的数据
+type Payload struct {
+	ID        uuid.UUID `json:"id"`         //每个token唯一的id
+	SessionID uuid.UUID `json:"session_id"` //token所属的会话,吊销会话后该会话签发的token都失效
+	Type      TokenType `json:"token_type"`
+	Username  string    `json:"username"`
+	Role      string    `json:"role"` //用户角色,用于权限控制
+	IssuedAt  time.Time `json:"issued_at"`
+	ExpiredAt time.Time `json:"expired_at"`
+}
+
+//根据用户名,角色,所属会话,token类型和有效时长创建一个新的负载
+func NewPayload(username string, role string, sessionID uuid.UUID, tokenType TokenType, duration time.Duration) (*Payload, error) {
+	tokenID, err := uuid.NewRandom()
+	if err != nil {
+		return nil, err
+	}
+
+	payload := &Payload{
+		ID:        tokenID,
+		SessionID: sessionID,
+		Type:      tokenType,
+		Username:  username,
+		Role:      role,
+		IssuedAt:  time.Now(),
+		ExpiredAt: time.Now().Add(duration),
+	}
+	return payload, nil
+}
+
+//Valid 检查负载是否过期,同时实现了jwt.Claims接口
+func (payload *Payload) Valid() error {
+	if time.Now().After(payload.ExpiredAt) {
+		return ErrExpiredToken
+	}
+	return nil
+}
+
+//检查负载的类型,类型不符的token和无效的token一样处理
+func (payload *Payload) checkType(tokenType TokenType) error {
+	if payload.Type != tokenType {
+		return ErrInvalidToken
+	}
+	return nil
+}
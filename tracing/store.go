@@ -0,0 +1,155 @@
+package tracing
+
+import (
+	"context"
+	"time"
+
+	db "github.com/leilei3167/bank/db/sqlc"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.7.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+//span的属性
+const (
+	OutcomeKey       = attribute.Key("bank.outcome")
+	AccountIDKey     = attribute.Key("bank.account_id")
+	FromAccountIDKey = attribute.Key("bank.from_account_id")
+	ToAccountIDKey   = attribute.Key("bank.to_account_id")
+	TransferIDKey    = attribute.Key("bank.transfer_id")
+	AmountKey        = attribute.Key("bank.amount")
+	ReplayedKey      = attribute.Key("bank.replayed")
+	TxAttemptKey     = attribute.Key("bank.tx.attempt")
+	RequestIDKey     = attribute.Key("bank.request_id")
+)
+
+//用作db.WithQueryTracer的回调,为每条SQL创建span,事务中的SQL是事务所在Store方法的子span
+//span的名称为Querier的方法名,锁等待的时间体现在SELECT ... FOR UPDATE的span上
+func TraceQuery(ctx context.Context, name string) (context.Context, func(err error)) {
+	ctx, span := Start(ctx, name,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(semconv.DBSystemPostgreSQL, semconv.DBOperationKey.String(name)),
+	)
+	return ctx, func(err error) {
+		End(span, err)
+	}
+}
+
+//用作db.WithTxRetryHook的回调,在事务所在的span上记录每次重试
+func TraceTxRetry(ctx context.Context, attempt int, err error) {
+	SpanFromContext(ctx).AddEvent("tx retry", trace.WithAttributes(
+		TxAttemptKey.Int(attempt),
+		attribute.String("error", err.Error()),
+	))
+}
+
+//为Store中由多条SQL组成的方法创建span,单条SQL的Querier方法由TraceQuery创建span
+//GetAccount额外记录账户ID,处理器校验账户时可以区分是哪个账户
+type tracedStore struct {
+	db.Store
+}
+
+func TraceStore(store db.Store) db.Store {
+	return tracedStore{Store: store}
+}
+
+func (s tracedStore) GetAccount(ctx context.Context, id int64) (db.Account, error) {
+	ctx, span := Start(ctx, "Store.GetAccount", trace.WithAttributes(AccountIDKey.Int64(id)))
+	account, err := s.Store.GetAccount(ctx, id)
+	End(span, err)
+	return account, err
+}
+
+func transferAttributes(arg db.TransferTxParams) trace.SpanStartOption {
+	return trace.WithAttributes(
+		FromAccountIDKey.Int64(arg.FromAccountID),
+		ToAccountIDKey.Int64(arg.ToAccountID),
+		AmountKey.Int64(arg.Amount),
+	)
+}
+
+func (s tracedStore) TransferTx(ctx context.Context, arg db.TransferTxParams) (db.TransferTxResult, error) {
+	ctx, span := Start(ctx, "Store.TransferTx", transferAttributes(arg))
+	result, err := s.Store.TransferTx(ctx, arg)
+	if err == nil {
+		span.SetAttributes(TransferIDKey.Int64(result.Transfer.ID))
+	}
+	End(span, err)
+	return result, err
+}
+
+func (s tracedStore) IdempotentTransferTx(ctx context.Context, arg db.IdempotentTransferTxParams) (db.IdempotentTransferTxResult, error) {
+	ctx, span := Start(ctx, "Store.IdempotentTransferTx", transferAttributes(arg.TransferTxParams))
+	result, err := s.Store.IdempotentTransferTx(ctx, arg)
+	if err == nil {
+		span.SetAttributes(TransferIDKey.Int64(result.Transfer.ID), ReplayedKey.Bool(result.Replayed))
+	}
+	End(span, err)
+	return result, err
+}
+
+func (s tracedStore) ReverseTransferTx(ctx context.Context, arg db.ReverseTransferTxParams) (db.ReverseTransferTxResult, error) {
+	ctx, span := Start(ctx, "Store.ReverseTransferTx", trace.WithAttributes(
+		TransferIDKey.Int64(arg.TransferID),
+		AmountKey.Int64(arg.Amount),
+	))
+	result, err := s.Store.ReverseTransferTx(ctx, arg)
+	if err == nil {
+		span.SetAttributes(
+			FromAccountIDKey.Int64(result.Transfer.FromAccountID),
+			ToAccountIDKey.Int64(result.Transfer.ToAccountID),
+		)
+	}
+	End(span, err)
+	return result, err
+}
+
+func (s tracedStore) RunScheduledTransferTx(ctx context.Context, now time.Time) (db.RunScheduledTransferResult, error) {
+	ctx, span := Start(ctx, "Store.RunScheduledTransferTx")
+	result, err := s.Store.RunScheduledTransferTx(ctx, now)
+	if err == nil {
+		span.SetAttributes(
+			attribute.Int64("bank.scheduled_transfer_id", result.Scheduled.ID),
+			FromAccountIDKey.Int64(result.Scheduled.FromAccountID),
+			ToAccountIDKey.Int64(result.Scheduled.ToAccountID),
+			attribute.String("bank.run_status", result.Run.Status),
+		)
+	}
+	End(span, err)
+	return result, err
+}
+
+func (s tracedStore) DepositTx(ctx context.Context, arg db.CashTxParams) (db.CashTxResult, error) {
+	ctx, span := Start(ctx, "Store.DepositTx", trace.WithAttributes(AccountIDKey.Int64(arg.AccountID), AmountKey.Int64(arg.Amount)))
+	result, err := s.Store.DepositTx(ctx, arg)
+	End(span, err)
+	return result, err
+}
+
+func (s tracedStore) WithdrawTx(ctx context.Context, arg db.CashTxParams) (db.CashTxResult, error) {
+	ctx, span := Start(ctx, "Store.WithdrawTx", trace.WithAttributes(AccountIDKey.Int64(arg.AccountID), AmountKey.Int64(arg.Amount)))
+	result, err := s.Store.WithdrawTx(ctx, arg)
+	End(span, err)
+	return result, err
+}
+
+func (s tracedStore) ListEntriesWithBalance(ctx context.Context, arg db.ListEntriesWithBalanceParams) ([]db.EntryWithBalance, error) {
+	ctx, span := Start(ctx, "Store.ListEntriesWithBalance", trace.WithAttributes(AccountIDKey.Int64(arg.AccountID)))
+	entries, err := s.Store.ListEntriesWithBalance(ctx, arg)
+	End(span, err)
+	return entries, err
+}
+
+func (s tracedStore) AccountStatementTx(ctx context.Context, arg db.AccountStatementParams) (db.AccountStatement, error) {
+	ctx, span := Start(ctx, "Store.AccountStatementTx", trace.WithAttributes(AccountIDKey.Int64(arg.AccountID)))
+	statement, err := s.Store.AccountStatementTx(ctx, arg)
+	End(span, err)
+	return statement, err
+}
+
+func (s tracedStore) ReconcileLedger(ctx context.Context, arg db.ReconcileParams) (db.ReconciliationReport, error) {
+	ctx, span := Start(ctx, "Store.ReconcileLedger")
+	report, err := s.Store.ReconcileLedger(ctx, arg)
+	End(span, err)
+	return report, err
+}
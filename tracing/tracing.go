@@ -0,0 +1,101 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.7.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+//支持的exporter
+const (
+	ExporterOTLP   = "otlp"   //通过gRPC发送到OTLP collector
+	ExporterStdout = "stdout" //输出到w,用于本地调试
+	ExporterNone   = "none"   //不导出,span不会被记录
+)
+
+const (
+	serviceName = "bank"
+	//tracer的名称,同时作为instrumentation library
+	instrumentationName = "github.com/leilei3167/bank"
+)
+
+//gin 1.7的Context.Value只能取到字符串的键,所以请求的span同时以这个键保存在gin的Keys中
+//处理器把*gin.Context当作context.Context传给store时,store的span仍然能找到父span
+const SpanKey = "otel_span"
+
+//span的结果,以outcome属性记录
+const (
+	OutcomeSuccess = "success"
+	OutcomeError   = "error"
+)
+
+//设置全局的TracerProvider和传播格式,返回的函数在退出前调用,发送还没有导出的span
+//endpoint为OTLP collector的地址,只有exporter为otlp时使用
+func Setup(ctx context.Context, exporter, endpoint string, w io.Writer) (func(context.Context) error, error) {
+	var spanExporter sdktrace.SpanExporter
+	var err error
+	switch exporter {
+	case "", ExporterNone:
+		return func(context.Context) error { return nil }, nil
+	case ExporterOTLP:
+		spanExporter, err = otlptracegrpc.New(ctx, otlptracegrpc.WithEndpoint(endpoint), otlptracegrpc.WithInsecure())
+	case ExporterStdout:
+		spanExporter, err = stdouttrace.New(stdouttrace.WithWriter(w))
+	default:
+		return nil, fmt.Errorf("unsupported trace exporter: %q", exporter)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(spanExporter),
+		sdktrace.WithResource(resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceNameKey.String(serviceName))),
+	)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	return provider.Shutdown, nil
+}
+
+//每次从全局的TracerProvider获取,Setup之前创建的span使用默认的空实现
+func tracer() trace.Tracer {
+	return otel.Tracer(instrumentationName)
+}
+
+//ctx中的span,没有时使用gin的Keys中保存的请求span
+func SpanFromContext(ctx context.Context) trace.Span {
+	if span := trace.SpanFromContext(ctx); span.SpanContext().IsValid() {
+		return span
+	}
+	if span, ok := ctx.Value(SpanKey).(trace.Span); ok {
+		return span
+	}
+	return trace.SpanFromContext(ctx)
+}
+
+//创建ctx中span的子span
+func Start(ctx context.Context, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	return tracer().Start(trace.ContextWithSpan(ctx, SpanFromContext(ctx)), name, opts...)
+}
+
+//记录结果并结束span,err不为nil时span的状态为Error
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		span.SetAttributes(OutcomeKey.String(OutcomeError))
+	} else {
+		span.SetAttributes(OutcomeKey.String(OutcomeSuccess))
+	}
+	span.End()
+}
@@ -0,0 +1,153 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	mockdb "github.com/leilei3167/bank/db/mock"
+	db "github.com/leilei3167/bank/db/sqlc"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+//把全局的TracerProvider换成写入内存的exporter,测试结束后恢复
+func newTestExporter(t *testing.T) *tracetest.InMemoryExporter {
+	exporter := tracetest.NewInMemoryExporter()
+	global := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)))
+	t.Cleanup(func() { otel.SetTracerProvider(global) })
+	return exporter
+}
+
+//按名称查找已经结束的span
+func findSpan(t *testing.T, exporter *tracetest.InMemoryExporter, name string) tracetest.SpanStub {
+	for _, span := range exporter.GetSpans() {
+		if span.Name == name {
+			return span
+		}
+	}
+	t.Fatalf("span %q not found", name)
+	return tracetest.SpanStub{}
+}
+
+func attributeValue(span tracetest.SpanStub, key attribute.Key) attribute.Value {
+	for _, kv := range span.Attributes {
+		if kv.Key == key {
+			return kv.Value
+		}
+	}
+	return attribute.Value{}
+}
+
+func TestTraceStore(t *testing.T) {
+	exporter := newTestExporter(t)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	store := mockdb.NewMockStore(ctrl)
+	traced := TraceStore(store)
+
+	ctx, parent := Start(context.Background(), "parent")
+	arg := db.TransferTxParams{FromAccountID: 1, ToAccountID: 2, Amount: 100}
+
+	//Store方法的ctx中带有新的span,其中执行的SQL是它的子span
+	store.EXPECT().TransferTx(gomock.Any(), gomock.Eq(arg)).Times(1).
+		DoAndReturn(func(ctx context.Context, _ db.TransferTxParams) (db.TransferTxResult, error) {
+			_, finish := TraceQuery(ctx, "GetAccountForUpdate")
+			finish(nil)
+			return db.TransferTxResult{Transfer: db.Transfer{ID: 7}}, nil
+		})
+	_, err := traced.TransferTx(ctx, arg)
+	require.NoError(t, err)
+
+	store.EXPECT().DepositTx(gomock.Any(), gomock.Any()).Times(1).Return(db.CashTxResult{}, db.ErrInsufficientBalance)
+	_, err = traced.DepositTx(ctx, db.CashTxParams{AccountID: 3, Amount: 100})
+	require.ErrorIs(t, err, db.ErrInsufficientBalance)
+	parent.End()
+
+	transfer := findSpan(t, exporter, "Store.TransferTx")
+	require.Equal(t, parent.SpanContext().SpanID(), transfer.Parent.SpanID())
+	require.Equal(t, int64(1), attributeValue(transfer, FromAccountIDKey).AsInt64())
+	require.Equal(t, int64(2), attributeValue(transfer, ToAccountIDKey).AsInt64())
+	require.Equal(t, int64(7), attributeValue(transfer, TransferIDKey).AsInt64())
+	require.Equal(t, OutcomeSuccess, attributeValue(transfer, OutcomeKey).AsString())
+	require.Equal(t, codes.Unset, transfer.Status.Code)
+
+	query := findSpan(t, exporter, "GetAccountForUpdate")
+	require.Equal(t, transfer.SpanContext.SpanID(), query.Parent.SpanID())
+	require.Equal(t, trace.SpanKindClient, query.SpanKind)
+
+	deposit := findSpan(t, exporter, "Store.DepositTx")
+	require.Equal(t, int64(3), attributeValue(deposit, AccountIDKey).AsInt64())
+	require.Equal(t, OutcomeError, attributeValue(deposit, OutcomeKey).AsString())
+	require.Equal(t, codes.Error, deposit.Status.Code)
+	require.Len(t, deposit.Events, 1) //RecordError记录的异常
+}
+
+func TestTraceTxRetry(t *testing.T) {
+	exporter := newTestExporter(t)
+
+	ctx, span := Start(context.Background(), "Store.TransferTx")
+	TraceTxRetry(ctx, 1, errors.New("could not serialize access"))
+	span.End()
+
+	spans := exporter.GetSpans()
+	require.Len(t, spans, 1)
+	require.Len(t, spans[0].Events, 1)
+	require.Equal(t, "tx retry", spans[0].Events[0].Name)
+}
+
+//gin 1.7的Context.Value只能取到字符串的键,请求的span需要通过SpanKey找到
+type stringKeyContext struct {
+	context.Context
+	span trace.Span
+}
+
+func (c stringKeyContext) Value(key interface{}) interface{} {
+	if key == SpanKey {
+		return c.span
+	}
+	return nil
+}
+
+func TestStartFromSpanKey(t *testing.T) {
+	exporter := newTestExporter(t)
+
+	_, request := Start(context.Background(), "GET /accounts/:id")
+	_, child := Start(stringKeyContext{Context: context.Background(), span: request}, "Store.GetAccount")
+	child.End()
+	request.End()
+
+	span := findSpan(t, exporter, "Store.GetAccount")
+	require.Equal(t, request.SpanContext().TraceID(), span.SpanContext.TraceID())
+	require.Equal(t, request.SpanContext().SpanID(), span.Parent.SpanID())
+}
+
+func TestSetup(t *testing.T) {
+	global := otel.GetTracerProvider()
+	defer otel.SetTracerProvider(global)
+
+	shutdown, err := Setup(context.Background(), ExporterNone, "", nil)
+	require.NoError(t, err)
+	require.NoError(t, shutdown(context.Background()))
+
+	_, err = Setup(context.Background(), "zipkin", "", nil)
+	require.Error(t, err)
+
+	//关闭时导出还没有发送的span
+	var buf bytes.Buffer
+	shutdown, err = Setup(context.Background(), ExporterStdout, "", &buf)
+	require.NoError(t, err)
+	_, span := Start(context.Background(), "Store.TransferTx")
+	span.End()
+	require.NoError(t, shutdown(context.Background()))
+	require.Contains(t, buf.String(), "Store.TransferTx")
+}
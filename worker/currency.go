@@ -0,0 +1,60 @@
+package worker
+
+import (
+	"context"
+	"time"
+
+	db "github.com/leilei3167/bank/db/sqlc"
+	"github.com/leilei3167/bank/db/util"
+	"github.com/leilei3167/bank/logger"
+)
+
+//从currencies表加载货币,替换本进程的注册表,HTTP和gRPC服务的currency验证器共用这个注册表
+func SyncCurrencies(ctx context.Context, store db.Store) error {
+	currencies, err := store.ListCurrencies(ctx)
+	if err != nil {
+		return err
+	}
+
+	registry := make([]util.Currency, 0, len(currencies))
+	for _, currency := range currencies {
+		registry = append(registry, currency.RegistryCurrency())
+	}
+	util.Currencies.Replace(registry)
+	return nil
+}
+
+//定期刷新货币注册表,在其他实例上启用或禁用货币后,最多interval之后在本实例生效
+type CurrencySyncer struct {
+	store    db.Store
+	interval time.Duration
+}
+
+func NewCurrencySyncer(store db.Store, interval time.Duration) *CurrencySyncer {
+	return &CurrencySyncer{
+		store:    store,
+		interval: interval,
+	}
+}
+
+//每隔interval刷新一次,直到开始停止;启动时的第一次同步由调用方完成,失败时不启动服务
+func (s *CurrencySyncer) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-Stopping(ctx):
+			return
+		case <-ticker.C:
+		}
+		s.RunOnce(ctx)
+	}
+}
+
+//刷新失败时保留原来的注册表,只记录日志
+func (s *CurrencySyncer) RunOnce(ctx context.Context) {
+	if err := SyncCurrencies(ctx, s.store); err != nil && ctx.Err() == nil {
+		logger.Ctx(ctx).Error().Err(err).Msg("刷新货币失败")
+	}
+}
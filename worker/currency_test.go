@@ -0,0 +1,74 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	mockdb "github.com/leilei3167/bank/db/mock"
+	db "github.com/leilei3167/bank/db/sqlc"
+	"github.com/leilei3167/bank/db/util"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSyncCurrencies(t *testing.T) {
+	defer util.Currencies.Replace(util.DefaultCurrencies)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	store := mockdb.NewMockStore(ctrl)
+	store.EXPECT().
+		ListCurrencies(gomock.Any()).
+		Times(1).
+		Return([]db.Currency{
+			{Code: util.USD, Exponent: 2, Symbol: "$", Enabled: true},
+			{Code: "JPY", Exponent: 0, Symbol: "¥", Enabled: true},
+		}, nil)
+
+	err := SyncCurrencies(context.Background(), store)
+	require.NoError(t, err)
+
+	require.True(t, util.IsSupportedCurrency("JPY"))
+	require.False(t, util.IsSupportedCurrency(util.EUR))
+	require.Equal(t, "1500", util.Currencies.FormatAmount(1500, "JPY"))
+}
+
+func TestCurrencySyncerRun(t *testing.T) {
+	defer util.Currencies.Replace(util.DefaultCurrencies)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	store := mockdb.NewMockStore(ctrl)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	//刷新失败时保留原来的注册表,其他实例禁用的货币在下一次刷新时生效
+	var keptAfterFailure bool
+	gomock.InOrder(
+		store.EXPECT().ListCurrencies(gomock.Any()).Times(1).Return(nil, errors.New("connection refused")),
+		store.EXPECT().ListCurrencies(gomock.Any()).Times(1).
+			DoAndReturn(func(_ context.Context) ([]db.Currency, error) {
+				keptAfterFailure = util.IsSupportedCurrency(util.EUR)
+				cancel()
+				return []db.Currency{{Code: util.EUR, Exponent: 2, Symbol: "€", Enabled: false}}, nil
+			}),
+	)
+
+	done := make(chan struct{})
+	go func() {
+		NewCurrencySyncer(store, time.Millisecond).Run(ctx)
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("currency syncer did not stop after context was canceled")
+	}
+	require.True(t, keptAfterFailure)
+	require.False(t, util.IsSupportedCurrency(util.EUR))
+}
@@ -0,0 +1,112 @@
+package worker
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/leilei3167/bank/logger"
+)
+
+//统一启动和停止后台任务,停止时先通知任务不再开始新的工作,等待正在执行的事务完成,到期之后再取消任务的ctx
+type Group struct {
+	ctx      context.Context //任务执行查询使用的ctx,停止的期限到期之后才取消
+	cancel   context.CancelFunc
+	stopping chan struct{}
+	stopOnce sync.Once
+	wg       sync.WaitGroup
+
+	mu      sync.Mutex
+	workers map[string]*Status
+}
+
+//后台任务的运行状态,Running为false说明任务已经返回,不会再执行
+type Status struct {
+	Name      string     `json:"name"`
+	Running   bool       `json:"running"`
+	StartedAt time.Time  `json:"started_at"`
+	StoppedAt *time.Time `json:"stopped_at,omitempty"`
+}
+
+type stoppingKey struct{}
+
+func NewGroup() *Group {
+	stopping := make(chan struct{})
+	ctx, cancel := context.WithCancel(context.WithValue(context.Background(), stoppingKey{}, stopping))
+	return &Group{ctx: ctx, cancel: cancel, stopping: stopping, workers: make(map[string]*Status)}
+}
+
+//任务所在的Group开始停止时关闭,任务在两次执行之间检查它,不在Group中执行时等同于ctx.Done()
+func Stopping(ctx context.Context) <-chan struct{} {
+	if stopping, ok := ctx.Value(stoppingKey{}).(chan struct{}); ok {
+		return stopping
+	}
+	return ctx.Done()
+}
+
+func stopped(ctx context.Context) bool {
+	select {
+	case <-Stopping(ctx):
+		return true
+	default:
+		return false
+	}
+}
+
+//在新的goroutine中执行run,run需要在Stopping(ctx)关闭后完成当前的工作并返回,
+//name用于报告任务的状态,并且会带在logger.Ctx(ctx)返回的日志中
+func (g *Group) Go(name string, run func(ctx context.Context)) {
+	status := &Status{Name: name, Running: true, StartedAt: time.Now()}
+	g.mu.Lock()
+	g.workers[name] = status
+	g.mu.Unlock()
+
+	g.wg.Add(1)
+	go func() {
+		defer g.wg.Done()
+		defer func() {
+			stoppedAt := time.Now()
+			g.mu.Lock()
+			status.Running = false
+			status.StoppedAt = &stoppedAt
+			g.mu.Unlock()
+		}()
+		run(logger.WithWorker(g.ctx, name))
+	}()
+}
+
+//所有任务的状态,按名称排序
+func (g *Group) Status() []Status {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	statuses := make([]Status, 0, len(g.workers))
+	for _, status := range g.workers {
+		statuses = append(statuses, *status)
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Name < statuses[j].Name })
+	return statuses
+}
+
+//停止所有任务并等待它们返回:正在执行的事务可以在ctx到期之前完成,
+//ctx到期时取消任务的ctx,还没有完成的事务回滚,返回ctx的错误
+func (g *Group) Stop(ctx context.Context) error {
+	g.stopOnce.Do(func() { close(g.stopping) })
+
+	done := make(chan struct{})
+	go func() {
+		g.wg.Wait()
+		close(done)
+	}()
+
+	var err error
+	select {
+	case <-done:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	g.cancel()
+	<-done
+	return err
+}
@@ -0,0 +1,101 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/leilei3167/bank/logger"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGroupStop(t *testing.T) {
+	group := NewGroup()
+
+	var stopped int32
+	for i := 0; i < 3; i++ {
+		group.Go(fmt.Sprintf("worker-%d", i), func(ctx context.Context) {
+			<-Stopping(ctx)
+			atomic.AddInt32(&stopped, 1)
+		})
+	}
+
+	//Stop返回时所有任务都已经返回
+	require.NoError(t, group.Stop(context.Background()))
+	require.Equal(t, int32(3), atomic.LoadInt32(&stopped))
+}
+
+func TestGroupStopDrain(t *testing.T) {
+	group := NewGroup()
+
+	//开始停止时正在执行的工作仍然可以使用ctx完成
+	started := make(chan struct{})
+	var workErr error
+	group.Go("scheduler", func(ctx context.Context) {
+		close(started)
+		<-Stopping(ctx)
+		time.Sleep(20 * time.Millisecond)
+		workErr = ctx.Err()
+	})
+	<-started
+
+	require.NoError(t, group.Stop(context.Background()))
+	require.NoError(t, workErr)
+}
+
+func TestGroupStopDeadline(t *testing.T) {
+	group := NewGroup()
+
+	//没有在期限内完成的任务被取消
+	var canceled int32
+	group.Go("reconciler", func(ctx context.Context) {
+		<-ctx.Done()
+		atomic.StoreInt32(&canceled, 1)
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	err := group.Stop(ctx)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	require.Equal(t, int32(1), atomic.LoadInt32(&canceled))
+}
+
+func TestGroupStatus(t *testing.T) {
+	group := NewGroup()
+	defer group.Stop(context.Background())
+
+	exited := make(chan struct{})
+	group.Go("scheduler", func(ctx context.Context) {
+		<-Stopping(ctx)
+	})
+	group.Go("reconciler", func(ctx context.Context) {
+		close(exited)
+	})
+	<-exited
+
+	//提前返回的任务报告为没有运行
+	require.Eventually(t, func() bool {
+		statuses := group.Status()
+		require.Len(t, statuses, 2)
+		require.Equal(t, "reconciler", statuses[0].Name)
+		require.Equal(t, "scheduler", statuses[1].Name)
+		require.True(t, statuses[1].Running)
+		require.Nil(t, statuses[1].StoppedAt)
+		return !statuses[0].Running && statuses[0].StoppedAt != nil
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestGroupWorkerLogger(t *testing.T) {
+	group := NewGroup()
+
+	//任务的ctx带有任务名,logger.Ctx(ctx)的日志会带上它
+	names := make(chan string, 1)
+	group.Go("reconciler", func(ctx context.Context) {
+		names <- logger.Worker(ctx)
+	})
+
+	require.NoError(t, group.Stop(context.Background()))
+	require.Equal(t, "reconciler", <-names)
+}
@@ -0,0 +1,55 @@
+package worker
+
+import (
+	"context"
+	"time"
+
+	db "github.com/leilei3167/bank/db/sqlc"
+	"github.com/leilei3167/bank/logger"
+)
+
+//后台定期对账,每次的结果由ReconcileLedger保存,后台管理接口可以查看最近一次的报告
+type Reconciler struct {
+	store     db.Store
+	interval  time.Duration
+	batchSize int32
+}
+
+func NewReconciler(store db.Store, interval time.Duration, batchSize int32) *Reconciler {
+	return &Reconciler{
+		store:     store,
+		interval:  interval,
+		batchSize: batchSize,
+	}
+}
+
+//启动时先执行一次,之后每隔interval执行一次,直到开始停止
+func (r *Reconciler) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		r.RunOnce(ctx)
+		select {
+		case <-Stopping(ctx):
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+//执行一次对账,失败或者发现不一致时只记录日志,不影响下一次执行
+func (r *Reconciler) RunOnce(ctx context.Context) {
+	report, err := r.store.ReconcileLedger(ctx, db.ReconcileParams{BatchSize: r.batchSize})
+	if err != nil {
+		logger.Ctx(ctx).Error().Err(err).Msg("对账失败")
+		return
+	}
+	if report.HasDrift() {
+		logger.Ctx(ctx).Warn().
+			Int64("run_id", report.RunID).
+			Int("account_drifts", len(report.AccountDrifts)).
+			Int("transfer_drifts", len(report.TransferDrifts)).
+			Msg("对账发现不一致")
+	}
+}
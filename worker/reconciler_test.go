@@ -0,0 +1,77 @@
+package worker
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	mockdb "github.com/leilei3167/bank/db/mock"
+	db "github.com/leilei3167/bank/db/sqlc"
+	"github.com/leilei3167/bank/logger"
+	"github.com/rs/zerolog/log"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReconcilerRun(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	store := mockdb.NewMockStore(ctrl)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	//第一次失败不影响之后的执行,第二次执行时取消
+	calls := 0
+	store.EXPECT().
+		ReconcileLedger(gomock.Any(), gomock.Eq(db.ReconcileParams{BatchSize: 100})).
+		MinTimes(2).
+		DoAndReturn(func(_ context.Context, _ db.ReconcileParams) (db.ReconciliationReport, error) {
+			calls++
+			if calls == 1 {
+				return db.ReconciliationReport{}, errors.New("connection refused")
+			}
+			if calls == 2 {
+				cancel()
+			}
+			return db.ReconciliationReport{AccountDrifts: []db.AccountDrift{{AccountID: 1, Drift: 10}}}, nil
+		})
+
+	done := make(chan struct{})
+	go func() {
+		NewReconciler(store, time.Millisecond, 100).Run(ctx)
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("reconciler did not stop after context was canceled")
+	}
+	require.GreaterOrEqual(t, calls, 2)
+}
+
+func TestReconcilerRunOnceLogger(t *testing.T) {
+	var buf bytes.Buffer
+	global := log.Logger
+	defer func() { log.Logger = global }()
+	log.Logger, _ = logger.New(&buf, logger.FormatJSON, "debug")
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	store := mockdb.NewMockStore(ctrl)
+	store.EXPECT().ReconcileLedger(gomock.Any(), gomock.Any()).Times(1).Return(db.ReconciliationReport{}, errors.New("connection refused"))
+
+	//失败的日志使用ctx中的日志,带有任务名
+	ctx := logger.WithWorker(context.Background(), "reconciler")
+	NewReconciler(store, time.Minute, 100).RunOnce(ctx)
+
+	var line map[string]interface{}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &line))
+	require.Equal(t, "reconciler", line[logger.WorkerKey])
+	require.Equal(t, "error", line["level"])
+}
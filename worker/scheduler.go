@@ -0,0 +1,71 @@
+package worker
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	db "github.com/leilei3167/bank/db/sqlc"
+	"github.com/leilei3167/bank/logger"
+)
+
+//执行到期的定时转账,每次唤醒时逐笔执行所有到期的转账
+//每笔转账在单独的事务中执行,停止时正在执行的事务要么提交要么回滚,不会留下执行了一半的转账
+type Scheduler struct {
+	store    db.Store
+	interval time.Duration
+	now      func() time.Time
+}
+
+func NewScheduler(store db.Store, interval time.Duration) *Scheduler {
+	return &Scheduler{
+		store:    store,
+		interval: interval,
+		now:      time.Now,
+	}
+}
+
+//启动时先执行一次,之后每隔interval执行一次,直到开始停止
+func (s *Scheduler) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		s.RunOnce(ctx)
+		select {
+		case <-Stopping(ctx):
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+//执行所有到期的转账,返回执行的笔数
+//某一笔出错并且已经被推迟时跳过它继续执行后面的转账,没能领取或推迟时只记录日志,剩下的转账留到下一次
+func (s *Scheduler) RunOnce(ctx context.Context) int {
+	count := 0
+	//开始停止之后不再领取新的转账,正在执行的这笔照常提交
+	for !stopped(ctx) {
+		result, err := s.store.RunScheduledTransferTx(ctx, s.now())
+		if err != nil {
+			if err == sql.ErrNoRows || ctx.Err() != nil {
+				return count
+			}
+			logger.Ctx(ctx).Error().Err(err).Int64("scheduled_transfer_id", result.Scheduled.ID).Msg("执行定时转账失败")
+			if result.Scheduled.ID == 0 {
+				return count
+			}
+			count++
+			continue
+		}
+		count++
+		if result.Run.Status == db.ScheduledRunFailed {
+			logger.Ctx(ctx).Warn().
+				Int64("scheduled_transfer_id", result.Scheduled.ID).
+				Int64("run_id", result.Run.ID).
+				Str("error", result.Run.Error).
+				Msg("定时转账未能完成")
+		}
+	}
+	return count
+}
@@ -0,0 +1,93 @@
+package worker
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	mockdb "github.com/leilei3167/bank/db/mock"
+	db "github.com/leilei3167/bank/db/sqlc"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSchedulerRunOnce(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	store := mockdb.NewMockStore(ctrl)
+	scheduler := NewScheduler(store, time.Minute)
+	now := time.Now()
+	scheduler.now = func() time.Time { return now }
+
+	//逐笔执行直到没有到期的转账,失败的执行同样计数
+	gomock.InOrder(
+		store.EXPECT().RunScheduledTransferTx(gomock.Any(), gomock.Eq(now)).Times(1).
+			Return(db.RunScheduledTransferResult{Run: db.ScheduledTransferRun{Status: db.ScheduledRunSucceeded}}, nil),
+		store.EXPECT().RunScheduledTransferTx(gomock.Any(), gomock.Eq(now)).Times(1).
+			Return(db.RunScheduledTransferResult{Run: db.ScheduledTransferRun{Status: db.ScheduledRunFailed}}, nil),
+		store.EXPECT().RunScheduledTransferTx(gomock.Any(), gomock.Eq(now)).Times(1).
+			Return(db.RunScheduledTransferResult{}, sql.ErrNoRows),
+	)
+	require.Equal(t, 2, scheduler.RunOnce(context.Background()))
+
+	//没能领取或推迟时停止本次执行
+	store.EXPECT().RunScheduledTransferTx(gomock.Any(), gomock.Any()).Times(1).
+		Return(db.RunScheduledTransferResult{}, errors.New("connection refused"))
+	require.Equal(t, 0, scheduler.RunOnce(context.Background()))
+}
+
+func TestSchedulerSkipsFailedTransfer(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	store := mockdb.NewMockStore(ctrl)
+	scheduler := NewScheduler(store, time.Minute)
+
+	//第一笔出错之后已经被推迟,第二笔照常执行
+	gomock.InOrder(
+		store.EXPECT().RunScheduledTransferTx(gomock.Any(), gomock.Any()).Times(1).
+			Return(db.RunScheduledTransferResult{
+				Scheduled: db.ScheduledTransfer{ID: 1},
+				Run:       db.ScheduledTransferRun{ID: 1, ScheduledTransferID: 1, Status: db.ScheduledRunFailed},
+			}, errors.New("journal is not balanced")),
+		store.EXPECT().RunScheduledTransferTx(gomock.Any(), gomock.Any()).Times(1).
+			Return(db.RunScheduledTransferResult{
+				Scheduled: db.ScheduledTransfer{ID: 2},
+				Run:       db.ScheduledTransferRun{ID: 2, ScheduledTransferID: 2, Status: db.ScheduledRunSucceeded},
+			}, nil),
+		store.EXPECT().RunScheduledTransferTx(gomock.Any(), gomock.Any()).Times(1).
+			Return(db.RunScheduledTransferResult{}, sql.ErrNoRows),
+	)
+	require.Equal(t, 2, scheduler.RunOnce(context.Background()))
+}
+
+func TestSchedulerStop(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	store := mockdb.NewMockStore(ctrl)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	//执行中被取消时当前这笔完成后就停止,不会再领取下一笔
+	store.EXPECT().RunScheduledTransferTx(gomock.Any(), gomock.Any()).Times(1).
+		DoAndReturn(func(_ context.Context, _ time.Time) (db.RunScheduledTransferResult, error) {
+			cancel()
+			return db.RunScheduledTransferResult{}, nil
+		})
+
+	done := make(chan struct{})
+	go func() {
+		NewScheduler(store, time.Millisecond).Run(ctx)
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("scheduler did not stop after context was canceled")
+	}
+}